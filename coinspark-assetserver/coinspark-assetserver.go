@@ -0,0 +1,83 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package main serves an asset web page locally, at the path a wallet will look for it.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	coinspark "github.com/bitcartel/go-coinspark/coinspark"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	genesisHex := flag.String("genesis", "", "genesis metadata, in hex")
+	txID := flag.String("txid", "", "txid spent by the first input of the genesis transaction")
+	vout := flag.Int("vout", 0, "output index spent by the first input of the genesis transaction")
+	pagePath := flag.String("page", "", "asset web page JSON file")
+	contractPath := flag.String("contract", "", "contract file, if the page has a contract_url")
+	domainName := flag.String("domain", "", "domain name this server answers for, checked against the genesis")
+	flag.Parse()
+
+	metadata, err := hex.DecodeString(*genesisHex)
+	if err != nil {
+		fmt.Println("Genesis metadata is not hex")
+		os.Exit(1)
+	}
+
+	genesis := coinspark.CoinSparkGenesis{}
+	if err := genesis.DecodeErr(metadata); err != nil {
+		fmt.Println("Cannot decode genesis:", err)
+		os.Exit(1)
+	}
+
+	pageJSON, err := os.ReadFile(*pagePath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var contract []byte
+	if *contractPath != "" {
+		contract, err = os.ReadFile(*contractPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	server := coinspark.NewCoinSparkAssetPageServer(nil)
+	server.DomainName = *domainName
+	err, assetURL := server.Publish(&genesis, *txID, *vout, pageJSON, contract)
+	if err != nil {
+		fmt.Println("Cannot publish asset page:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Asset web page: " + assetURL)
+	fmt.Println("Listening on " + *listen)
+	fmt.Println(http.ListenAndServe(*listen, server))
+	os.Exit(1)
+}
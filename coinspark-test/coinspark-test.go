@@ -34,6 +34,9 @@ import (
 	"math/rand"
 )
 
+// Networks to check addresses against, all known networks unless one is given on the command line
+var networks = coinspark.CoinSparkNetworks()
+
 func ProcessInput(path string) {
 	file, err := os.Open(path)
 
@@ -232,7 +235,14 @@ func ProcessAddressTests(scanner *bufio.Scanner) {
 		}
 
 		address := new(coinspark.CoinSparkAddress)
-		if address.Decode(inputLine) {
+		decoded := false
+		for _, network := range networks {
+			address.Network = network
+			if decoded = address.Decode(inputLine); decoded {
+				break
+			}
+		}
+		if decoded {
 			fmt.Printf(address.String())
 		} else {
 			fmt.Println("Failed to decode address: " + inputLine)
@@ -647,6 +657,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	if numArgs > 2 {
+		network := coinspark.CoinSparkNetworkByName(os.Args[2])
+		networks = []*coinspark.CoinSparkNetwork{network}
+		if network == nil {
+			fmt.Println("Unknown network: " + os.Args[2])
+			os.Exit(1)
+		}
+	}
+
 	ProcessInput(os.Args[1])
 
 }
@@ -0,0 +1,265 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The JSON file on an asset web page, as described in the CoinSpark specification. Its key fields
+// are hashed into the genesis metadata, so every party must read them in exactly the same way.
+
+// The contents of an asset web page JSON file. Unknown keys are ignored.
+type CoinSparkAssetPage struct {
+	Name          string  `json:"name"`
+	NameShort     string  `json:"name_short,omitempty"`
+	Issuer        string  `json:"issuer,omitempty"`
+	Description   string  `json:"description,omitempty"`
+	Units         string  `json:"units,omitempty"`
+	IssueDate     string  `json:"issue_date,omitempty"`    // ISO 8601
+	ExpiryDate    string  `json:"expiry_date,omitempty"`   // ISO 8601
+	InterestRate  float64 `json:"interest_rate,omitempty"` // percent per year
+	Multiple      float64 `json:"multiple,omitempty"`      // display multiple for quantities, 0 means 1
+	Format        string  `json:"format,omitempty"`        // display format, with * for the quantity
+	Format1       string  `json:"format_1,omitempty"`      // display format when the quantity is 1
+	IconURL       string  `json:"icon_url,omitempty"`
+	ImageURL      string  `json:"image_url,omitempty"`
+	FeedURL       string  `json:"feed_url,omitempty"`
+	RedemptionURL string  `json:"redemption_url,omitempty"`
+	ContractURL   string  `json:"contract_url,omitempty"`
+}
+
+// A key in an asset web page JSON file which is missing or has an invalid value.
+type ErrAssetPageField struct {
+	Field  string // JSON key, e.g. "issue_date"
+	Reason string
+}
+
+func (e ErrAssetPageField) Error() string {
+	return fmt.Sprintf("coinspark: asset page %s %s", e.Field, e.Reason)
+}
+
+// Every invalid key in an asset web page JSON file, in the order of the specification.
+type ErrAssetPageFields []ErrAssetPageField
+
+func (e ErrAssetPageFields) Error() string {
+	reasons := make([]string, len(e))
+	for i, field := range e {
+		reasons[i] = field.Field + " " + field.Reason
+	}
+	return "coinspark: asset page " + strings.Join(reasons, "; ")
+}
+
+// Allows errors.As to find each ErrAssetPageField.
+func (e ErrAssetPageFields) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, field := range e {
+		errs[i] = field
+	}
+	return errs
+}
+
+// Parses and validates asset web page JSON. The page is returned whenever the JSON itself could
+// be read, even if err is an ErrAssetPageFields listing keys with the wrong type or invalid values.
+// Returns ErrBadFormat if data is not a JSON object.
+func ParseCoinSparkAssetPage(data []byte) (err error, page *CoinSparkAssetPage) {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(data, &object) != nil || object == nil {
+		return ErrBadFormat, nil
+	}
+
+	page = new(CoinSparkAssetPage)
+	var fieldErrors ErrAssetPageFields
+
+	for _, field := range page.stringFields() {
+		if raw, found := object[field.key]; found && string(raw) != "null" {
+			if json.Unmarshal(raw, field.value) != nil {
+				fieldErrors = append(fieldErrors, ErrAssetPageField{field.key, "must be a string"})
+			}
+		}
+	}
+
+	for _, field := range page.numberFields() {
+		if raw, found := object[field.key]; found && string(raw) != "null" {
+			if json.Unmarshal(raw, field.value) != nil {
+				fieldErrors = append(fieldErrors, ErrAssetPageField{field.key, "must be a number"})
+			}
+		}
+	}
+
+	if err := page.Validate(); err != nil {
+		fieldErrors = append(fieldErrors, err.(ErrAssetPageFields)...)
+	}
+
+	if len(fieldErrors) > 0 {
+		return fieldErrors.sorted(), page
+	}
+	return nil, page
+}
+
+// Returns an ErrAssetPageFields for every field which breaks the specification, or nil if the
+// page is valid. See Warnings for values which are allowed but probably mistaken.
+func (p *CoinSparkAssetPage) Validate() error {
+	var fieldErrors ErrAssetPageFields
+
+	if strings.TrimSpace(p.Name) == "" {
+		fieldErrors = append(fieldErrors, ErrAssetPageField{"name", "is required"})
+	}
+
+	if _, valid := parseAssetPageDate(p.IssueDate); !valid {
+		fieldErrors = append(fieldErrors, ErrAssetPageField{"issue_date", "must be an ISO 8601 date"})
+	}
+
+	if _, valid := parseAssetPageDate(p.ExpiryDate); !valid {
+		fieldErrors = append(fieldErrors, ErrAssetPageField{"expiry_date", "must be an ISO 8601 date"})
+	}
+
+	if math.IsNaN(p.InterestRate) || math.IsInf(p.InterestRate, 0) {
+		fieldErrors = append(fieldErrors, ErrAssetPageField{"interest_rate", "must be a number"})
+	}
+
+	if math.IsNaN(p.Multiple) || math.IsInf(p.Multiple, 0) || p.Multiple < 0 {
+		fieldErrors = append(fieldErrors, ErrAssetPageField{"multiple", "must be a positive number"})
+	}
+
+	if len(fieldErrors) > 0 {
+		return fieldErrors
+	}
+	return nil
+}
+
+// Returns fields whose values the specification allows but which are probably mistaken, such as
+// an expiry date before the issue date, in the order of the specification. Returns nil if there
+// are none. Warnings do not stop a page from being verified or published.
+func (p *CoinSparkAssetPage) Warnings() ErrAssetPageFields {
+	var warnings ErrAssetPageFields
+
+	issueDate, issueDateValid := parseAssetPageDate(p.IssueDate)
+	expiryDate, expiryDateValid := parseAssetPageDate(p.ExpiryDate)
+	if issueDateValid && expiryDateValid && !issueDate.IsZero() && !expiryDate.IsZero() && !expiryDate.After(issueDate) {
+		warnings = append(warnings, ErrAssetPageField{"expiry_date", "is not after issue_date"})
+	}
+
+	if p.InterestRate <= -100 {
+		warnings = append(warnings, ErrAssetPageField{"interest_rate", "is -100 or below"})
+	}
+
+	for _, field := range []struct{ key, value string }{{"format", p.Format}, {"format_1", p.Format1}} {
+		if field.value != "" && !strings.Contains(field.value, "*") {
+			warnings = append(warnings, ErrAssetPageField{field.key, "has no * for the quantity"})
+		}
+	}
+
+	for _, field := range []struct{ key, value string }{{"icon_url", p.IconURL}, {"image_url", p.ImageURL},
+		{"feed_url", p.FeedURL}, {"redemption_url", p.RedemptionURL}, {"contract_url", p.ContractURL}} {
+		if field.value != "" && !isAssetPageURL(field.value) {
+			warnings = append(warnings, ErrAssetPageField{field.key, "is not an http or https URL"})
+		}
+	}
+
+	return warnings
+}
+
+// Calculates the asset hash for the page and the contract content (not its URL), as for
+// CoinSparkCalcAssetHash.
+func (p *CoinSparkAssetPage) CalcAssetHash(contractContent []byte) [sha256.Size]byte {
+	return CoinSparkCalcAssetHash(p.Name, p.Issuer, p.Description, p.Units, p.IssueDate, p.ExpiryDate,
+		p.InterestRate, p.Multiple, contractContent)
+}
+
+type assetPageStringField struct {
+	key   string
+	value *string
+}
+
+type assetPageNumberField struct {
+	key   string
+	value *float64
+}
+
+func (p *CoinSparkAssetPage) stringFields() []assetPageStringField {
+	return []assetPageStringField{
+		{"name", &p.Name},
+		{"name_short", &p.NameShort},
+		{"issuer", &p.Issuer},
+		{"description", &p.Description},
+		{"units", &p.Units},
+		{"issue_date", &p.IssueDate},
+		{"expiry_date", &p.ExpiryDate},
+		{"format", &p.Format},
+		{"format_1", &p.Format1},
+		{"icon_url", &p.IconURL},
+		{"image_url", &p.ImageURL},
+		{"feed_url", &p.FeedURL},
+		{"redemption_url", &p.RedemptionURL},
+		{"contract_url", &p.ContractURL},
+	}
+}
+
+func (p *CoinSparkAssetPage) numberFields() []assetPageNumberField {
+	return []assetPageNumberField{
+		{"interest_rate", &p.InterestRate},
+		{"multiple", &p.Multiple},
+	}
+}
+
+// Orders field errors as the keys appear in the specification, keeping only the first for each key.
+func (e ErrAssetPageFields) sorted() ErrAssetPageFields {
+	order := []string{"name", "name_short", "issuer", "description", "units", "issue_date", "expiry_date",
+		"interest_rate", "multiple", "format", "format_1", "icon_url", "image_url", "feed_url",
+		"redemption_url", "contract_url"}
+
+	var sorted ErrAssetPageFields
+	for _, key := range order {
+		for _, field := range e {
+			if field.Field == key {
+				sorted = append(sorted, field)
+				break
+			}
+		}
+	}
+	return sorted
+}
+
+// Accepts an empty string, a date, or a date and time with a time zone.
+func parseAssetPageDate(date string) (time.Time, bool) {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		return time.Time{}, true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func isAssetPageURL(rawURL string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+func TestAssetPageWarningsAreNotErrors(t *testing.T) {
+	err, page := ParseCoinSparkAssetPage([]byte(`{"name": "Gold", "issue_date": "2020-01-01",
+		"expiry_date": "2019-01-01", "interest_rate": -150, "format": "grams", "icon_url": "ftp://example.com/"}`))
+	if err != nil {
+		t.Fatalf("page outside the specification's rules only: %v", err)
+	}
+
+	warnings := page.Warnings()
+	wantKeys := []string{"expiry_date", "interest_rate", "format", "icon_url"}
+	if len(warnings) != len(wantKeys) {
+		t.Fatalf("got warnings %v, want one for each of %v", warnings, wantKeys)
+	}
+	for index, key := range wantKeys {
+		if warnings[index].Field != key {
+			t.Errorf("warning %d is for %s, want %s", index, warnings[index].Field, key)
+		}
+	}
+}
+
+func TestAssetPageFieldErrors(t *testing.T) {
+	err, page := ParseCoinSparkAssetPage([]byte(`{"issuer": 5, "issue_date": "yesterday", "multiple": -1}`))
+	if page == nil {
+		t.Fatal("page was not returned with its field errors")
+	}
+	fieldErrors, isFieldErrors := err.(ErrAssetPageFields)
+	if !isFieldErrors {
+		t.Fatalf("got %v, want ErrAssetPageFields", err)
+	}
+
+	wantKeys := []string{"name", "issuer", "issue_date", "multiple"}
+	if len(fieldErrors) != len(wantKeys) {
+		t.Fatalf("got %v, want errors for %v", fieldErrors, wantKeys)
+	}
+	for index, key := range wantKeys {
+		if fieldErrors[index].Field != key {
+			t.Errorf("error %d is for %s, want %s", index, fieldErrors[index].Field, key)
+		}
+	}
+
+	if err, _ := ParseCoinSparkAssetPage([]byte(`[1, 2]`)); err != ErrBadFormat {
+		t.Errorf("JSON array: got %v, want %v", err, ErrBadFormat)
+	}
+}
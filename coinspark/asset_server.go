@@ -0,0 +1,229 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Serves asset web pages at exactly the URL given by CoinSparkGenesis.CalcAssetURL. Publish
+// checks the page JSON and contract against the genesis before anything is stored, then the
+// handler serves the JSON file, the contract (if contract_url is on this server) and a simple
+// HTML page. One server is meant for one domain, so files are stored by URL path alone.
+//
+//	server := NewCoinSparkAssetPageServer(nil)
+//	err, assetURL := server.Publish(genesis, firstSpentTxID, firstSpentVout, pageJSON, contract)
+//	http.ListenAndServe(":80", server)
+
+// A file to be served, stored by URL path.
+type CoinSparkAssetFile struct {
+	Content     []byte
+	ContentType string // detected from Content if empty
+}
+
+// Storage for published files. Implementations must be safe for concurrent use.
+type CoinSparkAssetPageStore interface {
+	Get(urlPath string) (error, *CoinSparkAssetFile) // nil file if there is none at urlPath
+	Put(urlPath string, file *CoinSparkAssetFile) error
+}
+
+// Keeps published files in memory.
+type CoinSparkMemoryAssetPageStore struct {
+	mutex sync.RWMutex
+	files map[string]*CoinSparkAssetFile
+}
+
+func NewCoinSparkMemoryAssetPageStore() *CoinSparkMemoryAssetPageStore {
+	return &CoinSparkMemoryAssetPageStore{files: map[string]*CoinSparkAssetFile{}}
+}
+
+func (p *CoinSparkMemoryAssetPageStore) Get(urlPath string) (error, *CoinSparkAssetFile) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return nil, copyAssetFile(p.files[urlPath])
+}
+
+func (p *CoinSparkMemoryAssetPageStore) Put(urlPath string, file *CoinSparkAssetFile) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.files[urlPath] = copyAssetFile(file)
+	return nil
+}
+
+// Copies file so that callers of Get and Put cannot change what is stored.
+func copyAssetFile(file *CoinSparkAssetFile) *CoinSparkAssetFile {
+	if file == nil {
+		return nil
+	}
+	return &CoinSparkAssetFile{append([]byte(nil), file.Content...), file.ContentType}
+}
+
+type CoinSparkAssetPageServer struct {
+	Store      CoinSparkAssetPageStore
+	DomainName string // if set, Publish only accepts genesis with this domain name
+	JSONFile   string // COINSPARK_ASSET_PAGE_JSON_FILE if empty
+}
+
+// Returns a server using store, or a CoinSparkMemoryAssetPageStore if store is nil.
+func NewCoinSparkAssetPageServer(store CoinSparkAssetPageStore) *CoinSparkAssetPageServer {
+	if store == nil {
+		store = NewCoinSparkMemoryAssetPageStore()
+	}
+	return &CoinSparkAssetPageServer{Store: store}
+}
+
+// Checks that pageJSON and contract (nil if the page has no contract_url) match the asset hash
+// in genesis, then stores them at the paths of the asset web page URL for the genesis
+// transaction, whose first input spends firstSpentVout of firstSpentTxID. The contract is only
+// stored if contract_url points to the genesis domain. Returns the asset web page URL.
+func (p *CoinSparkAssetPageServer) Publish(genesis *CoinSparkGenesis, firstSpentTxID string, firstSpentVout int, pageJSON []byte, contract []byte) (err error, assetURL string) {
+	if p.DomainName != "" && !sameDomainName(genesis.DomainName, p.DomainName) {
+		return ErrBadDomainPath, ""
+	}
+
+	// Verify exactly as a wallet would, but fetching from what we were given.
+	assetURL = genesis.CalcAssetURL(firstSpentTxID, firstSpentVout)
+	jsonURL := assetURL + p.jsonFile()
+	fetcher := publishFetcher{jsonURL: pageJSON}
+	_, page := ParseCoinSparkAssetPage(pageJSON)
+	if page != nil && page.ContractURL != "" && contract != nil {
+		fetcher[page.ContractURL] = contract
+	}
+
+	verifier := CoinSparkAssetVerifier{Fetcher: fetcher, JSONFile: p.jsonFile()}
+	result := verifier.Verify(context.Background(), genesis, firstSpentTxID, firstSpentVout)
+	switch result.Verdict {
+	case COINSPARK_ASSET_VERIFIED:
+		if result.PageErr != nil {
+			return result.PageErr, ""
+		}
+	case COINSPARK_ASSET_MISMATCH:
+		return ErrAssetHashMismatch, ""
+	default:
+		return result.Err, ""
+	}
+
+	parsedAssetURL, err := url.Parse(assetURL)
+	if err != nil {
+		return err, ""
+	}
+
+	// Contract first, so the page never refers to a file which is not there yet.
+	if parsedContractURL, err := url.Parse(page.ContractURL); err == nil && page.ContractURL != "" &&
+		sameDomainName(parsedContractURL.Hostname(), parsedAssetURL.Hostname()) {
+		if err := p.Store.Put(parsedContractURL.Path, &CoinSparkAssetFile{Content: append([]byte(nil), contract...)}); err != nil {
+			return err, ""
+		}
+	}
+
+	if err := p.Store.Put(parsedAssetURL.Path+p.jsonFile(), &CoinSparkAssetFile{append([]byte(nil), pageJSON...), "application/json"}); err != nil {
+		return err, ""
+	}
+
+	html := strings.Builder{}
+	if err := assetPageTemplate.Execute(&html, struct {
+		Page     *CoinSparkAssetPage
+		JSONFile string
+	}{page, p.jsonFile()}); err != nil {
+		return err, ""
+	}
+	if err := p.Store.Put(parsedAssetURL.Path, &CoinSparkAssetFile{[]byte(html.String()), "text/html; charset=utf-8"}); err != nil {
+		return err, ""
+	}
+
+	return nil, assetURL
+}
+
+// Serves published files for GET and HEAD requests.
+func (p *CoinSparkAssetPageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err, file := p.Store.Get(r.URL.Path)
+	if err != nil {
+		http.Error(w, "store unavailable", http.StatusInternalServerError)
+		return
+	}
+	if file == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(file.Content)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(file.Content)))
+	if r.Method == http.MethodGet {
+		w.Write(file.Content)
+	}
+}
+
+func (p *CoinSparkAssetPageServer) jsonFile() string {
+	if p.JSONFile == "" {
+		return COINSPARK_ASSET_PAGE_JSON_FILE
+	}
+	return p.JSONFile
+}
+
+// Returns true if the two domain names are the same once written in ASCII, whether either is
+// given in Unicode or punycode.
+func sameDomainName(domainName1 string, domainName2 string) bool {
+	err1, asciiName1 := DomainNameToASCII(domainName1)
+	err2, asciiName2 := DomainNameToASCII(domainName2)
+	return err1 == nil && err2 == nil && asciiName1 == asciiName2
+}
+
+// Serves the files passed to Publish, so they can be checked before anything is stored.
+type publishFetcher map[string][]byte
+
+func (f publishFetcher) Fetch(ctx context.Context, url string) (error, []byte) {
+	content, found := f[url]
+	if !found {
+		return fmt.Errorf("coinspark: no content given for %s", url), nil
+	}
+	return nil, content
+}
+
+var assetPageTemplate = template.Must(template.New("asset").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Page.Name}}</title></head>
+<body>
+<h1>{{.Page.Name}}</h1>
+{{if .Page.Issuer}}<p>Issued by {{.Page.Issuer}}</p>
+{{end}}{{if .Page.Description}}<p>{{.Page.Description}}</p>
+{{end}}{{if .Page.ImageURL}}<p><img src="{{.Page.ImageURL}}" alt=""></p>
+{{end}}{{if .Page.ContractURL}}<p><a href="{{.Page.ContractURL}}">Contract</a></p>
+{{end}}<p><a href="{{.JSONFile}}">Asset specification</a></p>
+</body>
+</html>
+`))
@@ -0,0 +1,69 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAssetPageServerUnicodeContractHost(t *testing.T) {
+	contract := []byte("terms and conditions")
+	pageJSON := []byte(`{"name": "Gold", "contract_url": "http://Bücher.example/contract.txt"}`)
+	_, page := ParseCoinSparkAssetPage(pageJSON)
+	assetHash := page.CalcAssetHash(contract)
+
+	builder := NewCoinSparkGenesisBuilder()
+	builder.Qty = 1000
+	builder.DomainName = "bücher.example"
+	builder.AssetHash = assetHash[:]
+	err, _, report := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewCoinSparkAssetPageServer(nil)
+	server.DomainName = "xn--bcher-kva.example"
+	err, assetURL := server.Publish(report.Genesis, assetVerifierTestTxID, 0, pageJSON, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedAssetURL, _ := url.Parse(assetURL)
+	if parsedAssetURL.Hostname() != "xn--bcher-kva.example" {
+		t.Errorf("asset URL %s is not written in ASCII", assetURL)
+	}
+
+	for _, path := range []string{"/contract.txt", parsedAssetURL.Path, parsedAssetURL.Path + COINSPARK_ASSET_PAGE_JSON_FILE} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d", path, recorder.Code)
+		}
+	}
+
+	server.DomainName = "example.com"
+	if err, _ := server.Publish(report.Genesis, assetVerifierTestTxID, 0, pageJSON, contract); err != ErrBadDomainPath {
+		t.Errorf("other domain: got %v, want %v", err, ErrBadDomainPath)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Checks a genesis against its asset web page. The JSON file and contract are fetched, the asset
+// hash recomputed, and its first AssetHashLen bytes compared with the genesis. Until the verdict
+// is COINSPARK_ASSET_VERIFIED, nothing from the page (including the asset name) should be shown.
+
+const (
+	COINSPARK_ASSET_PAGE_JSON_FILE = "coinspark.json" // appended to the asset web page URL
+	COINSPARK_FETCH_MAX_BYTES      = 16 * 1024 * 1024 // limit for CoinSparkHTTPFetcher by default
+)
+
+// Retrieves the content at a URL. Implementations should stop when ctx is done.
+type CoinSparkFetcher interface {
+	Fetch(ctx context.Context, url string) (error, []byte)
+}
+
+// Fetches over HTTP(S), failing for any status other than 200.
+type CoinSparkHTTPFetcher struct {
+	Client   *http.Client // http.DefaultClient if nil
+	MaxBytes int64        // COINSPARK_FETCH_MAX_BYTES if zero
+}
+
+func (f *CoinSparkHTTPFetcher) Fetch(ctx context.Context, url string) (error, []byte) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	maxBytes := f.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = COINSPARK_FETCH_MAX_BYTES
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err, nil
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err, nil
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("coinspark: fetching %s: %s", url, response.Status), nil
+	}
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxBytes+1))
+	if err != nil {
+		return err, nil
+	}
+	if int64(len(content)) > maxBytes {
+		return fmt.Errorf("coinspark: fetching %s: more than %d bytes", url, maxBytes), nil
+	}
+	return nil, content
+}
+
+type CoinSparkAssetVerdict int
+
+const (
+	COINSPARK_ASSET_UNVERIFIED  CoinSparkAssetVerdict = iota // not checked
+	COINSPARK_ASSET_VERIFIED                                 // page and contract match the asset hash
+	COINSPARK_ASSET_MISMATCH                                 // page or contract differ from what was issued
+	COINSPARK_ASSET_UNREACHABLE                              // page or contract could not be fetched
+	COINSPARK_ASSET_MALFORMED                                // genesis or page JSON is not valid
+)
+
+func (v CoinSparkAssetVerdict) String() string {
+	switch v {
+	case COINSPARK_ASSET_UNVERIFIED:
+		return "unverified"
+	case COINSPARK_ASSET_VERIFIED:
+		return "verified"
+	case COINSPARK_ASSET_MISMATCH:
+		return "mismatch"
+	case COINSPARK_ASSET_UNREACHABLE:
+		return "unreachable"
+	case COINSPARK_ASSET_MALFORMED:
+		return "malformed"
+	}
+	return fmt.Sprintf("verdict%d", int(v))
+}
+
+// The outcome of verifying a genesis, with whatever was learned along the way.
+type CoinSparkAssetVerification struct {
+	Verdict      CoinSparkAssetVerdict
+	AssetURL     string              // asset web page, from CalcAssetURL
+	JSONURL      string              // JSON file fetched
+	ContractURL  string              // contract fetched, if the page has one
+	Page         *CoinSparkAssetPage // set only if Verdict is COINSPARK_ASSET_VERIFIED
+	PageErr      error               // ErrAssetPageFields for keys which break the specification, whatever the verdict
+	ExpectedHash []byte              // AssetHash from the genesis, cut to AssetHashLen
+	ActualHash   []byte              // full hash of the page and contract, if they were fetched
+	Err          error               // reason for COINSPARK_ASSET_UNREACHABLE or COINSPARK_ASSET_MALFORMED
+}
+
+// Returns true if the asset page may be shown.
+func (p *CoinSparkAssetVerification) IsVerified() bool {
+	return p.Verdict == COINSPARK_ASSET_VERIFIED
+}
+
+func (p *CoinSparkAssetVerification) String() string {
+	if p.Err != nil {
+		return fmt.Sprintf("%s: %s (%v)", p.Verdict, p.AssetURL, p.Err)
+	}
+	return fmt.Sprintf("%s: %s", p.Verdict, p.AssetURL)
+}
+
+type CoinSparkAssetVerifier struct {
+	Fetcher  CoinSparkFetcher
+	JSONFile string // COINSPARK_ASSET_PAGE_JSON_FILE if empty
+}
+
+// Returns a verifier using fetcher, or a CoinSparkHTTPFetcher if fetcher is nil.
+func NewCoinSparkAssetVerifier(fetcher CoinSparkFetcher) *CoinSparkAssetVerifier {
+	if fetcher == nil {
+		fetcher = &CoinSparkHTTPFetcher{}
+	}
+	return &CoinSparkAssetVerifier{Fetcher: fetcher}
+}
+
+// Verifies genesis, whose asset web page URL depends on the first input spent by the genesis
+// transaction, against its published JSON and contract.
+func (p *CoinSparkAssetVerifier) Verify(ctx context.Context, genesis *CoinSparkGenesis, firstSpentTxID string, firstSpentVout int) CoinSparkAssetVerification {
+	var result CoinSparkAssetVerification
+
+	if err := genesis.Validate(); err != nil {
+		return result.finish(COINSPARK_ASSET_MALFORMED, err)
+	}
+	if genesis.AssetHashLen > len(genesis.AssetHash) {
+		return result.finish(COINSPARK_ASSET_MALFORMED, ErrOutOfRange{"AssetHashLen"})
+	}
+	result.ExpectedHash = append([]byte(nil), genesis.AssetHash[:genesis.AssetHashLen]...)
+
+	result.AssetURL = genesis.CalcAssetURL(firstSpentTxID, firstSpentVout)
+	if result.AssetURL == "" {
+		return result.finish(COINSPARK_ASSET_MALFORMED, ErrBadDomainPath)
+	}
+
+	jsonFile := p.JSONFile
+	if jsonFile == "" {
+		jsonFile = COINSPARK_ASSET_PAGE_JSON_FILE
+	}
+	result.JSONURL = result.AssetURL + jsonFile
+
+	err, pageJSON := p.Fetcher.Fetch(ctx, result.JSONURL)
+	if err != nil {
+		return result.finish(COINSPARK_ASSET_UNREACHABLE, err)
+	}
+
+	// Only the hash decides the verdict, so field problems are reported alongside it.
+	err, page := ParseCoinSparkAssetPage(pageJSON)
+	if page == nil {
+		return result.finish(COINSPARK_ASSET_MALFORMED, err)
+	}
+	result.PageErr = err
+
+	var contractContent []byte
+	if page.ContractURL != "" {
+		result.ContractURL = page.ContractURL
+		err, contractContent = p.Fetcher.Fetch(ctx, result.ContractURL)
+		if err != nil {
+			return result.finish(COINSPARK_ASSET_UNREACHABLE, err)
+		}
+	}
+
+	actualHash := page.CalcAssetHash(contractContent)
+	result.ActualHash = actualHash[:]
+	if !bytes.Equal(result.ActualHash[:genesis.AssetHashLen], result.ExpectedHash) {
+		return result.finish(COINSPARK_ASSET_MISMATCH, nil)
+	}
+
+	result.Page = page
+	return result.finish(COINSPARK_ASSET_VERIFIED, nil)
+}
+
+func (p CoinSparkAssetVerification) finish(verdict CoinSparkAssetVerdict, err error) CoinSparkAssetVerification {
+	p.Verdict = verdict
+	p.Err = err
+	return p
+}
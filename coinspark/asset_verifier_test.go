@@ -0,0 +1,100 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const assetVerifierTestTxID = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+// Serves the content given for each URL, and fails for any other.
+type assetVerifierTestFetcher map[string][]byte
+
+func (f assetVerifierTestFetcher) Fetch(ctx context.Context, url string) (error, []byte) {
+	content, found := f[url]
+	if !found {
+		return errors.New("no content for " + url), nil
+	}
+	return nil, content
+}
+
+// Returns a genesis whose asset hash matches pageJSON, which must be readable as a JSON object.
+func assetVerifierTestGenesis(t *testing.T, pageJSON string) *CoinSparkGenesis {
+	_, page := ParseCoinSparkAssetPage([]byte(pageJSON))
+	assetHash := page.CalcAssetHash(nil)
+
+	builder := NewCoinSparkGenesisBuilder()
+	builder.Qty = 1000
+	builder.DomainName = "example.com"
+	builder.AssetHash = assetHash[:]
+	err, _, report := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report.Genesis
+}
+
+func TestAssetVerifierComparesHashBeforeFields(t *testing.T) {
+	pageJSON := `{"issuer": "Example Bank", "multiple": -1}` // no name and a negative multiple
+	genesis := assetVerifierTestGenesis(t, pageJSON)
+	jsonURL := genesis.CalcAssetURL(assetVerifierTestTxID, 0) + COINSPARK_ASSET_PAGE_JSON_FILE
+
+	verifier := NewCoinSparkAssetVerifier(assetVerifierTestFetcher{jsonURL: []byte(pageJSON)})
+	result := verifier.Verify(context.Background(), genesis, assetVerifierTestTxID, 0)
+	if result.Verdict != COINSPARK_ASSET_VERIFIED || result.Err != nil {
+		t.Errorf("matching hash: got %s", result.String())
+	}
+	if fieldErrors, isFieldErrors := result.PageErr.(ErrAssetPageFields); !isFieldErrors || len(fieldErrors) != 2 {
+		t.Errorf("field problems: got %v", result.PageErr)
+	}
+
+	verifier = NewCoinSparkAssetVerifier(assetVerifierTestFetcher{jsonURL: []byte(`{"issuer": "Someone Else"}`)})
+	result = verifier.Verify(context.Background(), genesis, assetVerifierTestTxID, 0)
+	if result.Verdict != COINSPARK_ASSET_MISMATCH || result.PageErr == nil {
+		t.Errorf("different page without a name: got %s, page error %v", result.String(), result.PageErr)
+	}
+}
+
+func TestAssetVerifierFailures(t *testing.T) {
+	genesis := assetVerifierTestGenesis(t, `{"name": "Gold"}`)
+	jsonURL := genesis.CalcAssetURL(assetVerifierTestTxID, 0) + COINSPARK_ASSET_PAGE_JSON_FILE
+
+	for _, test := range []struct {
+		fetcher assetVerifierTestFetcher
+		verdict CoinSparkAssetVerdict
+	}{
+		{assetVerifierTestFetcher{jsonURL: []byte(`{"name": "Gold"}`)}, COINSPARK_ASSET_VERIFIED},
+		{assetVerifierTestFetcher{jsonURL: []byte(`not json`)}, COINSPARK_ASSET_MALFORMED},
+		{assetVerifierTestFetcher{}, COINSPARK_ASSET_UNREACHABLE},
+		{assetVerifierTestFetcher{jsonURL: []byte(`{"name": "Gold", "contract_url": "http://example.com/contract.pdf"}`)}, COINSPARK_ASSET_UNREACHABLE},
+	} {
+		result := NewCoinSparkAssetVerifier(test.fetcher).Verify(context.Background(), genesis, assetVerifierTestTxID, 0)
+		if result.Verdict != test.verdict {
+			t.Errorf("got %s, want %s", result.String(), test.verdict)
+		}
+		if (result.Page != nil) != (test.verdict == COINSPARK_ASSET_VERIFIED) {
+			t.Errorf("%s: page set to %v", result.Verdict, result.Page)
+		}
+	}
+}
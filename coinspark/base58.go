@@ -0,0 +1,130 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+const (
+	COINSPARK_BASE58CHECK_CHECKSUM_LEN = 4
+	COINSPARK_HASH160_LEN              = 20
+)
+
+// Decodes a base58 string into raw bytes, keeping leading '1' characters as zero bytes.
+// Returns nil if the string contains a character outside the base58 alphabet.
+func Base58Decode(base58String string) []byte {
+	var leadingZeros int
+	for leadingZeros < len(base58String) && base58String[leadingZeros] == integerToBase58[0] {
+		leadingZeros++
+	}
+
+	// big-endian base 256 accumulator, multiplied by 58 for each character
+	decoded := make([]byte, 0, len(base58String))
+	for charIndex := leadingZeros; charIndex < len(base58String); charIndex++ {
+		charValue := Base58ToInteger(base58String[charIndex])
+		if charValue < 0 {
+			return nil
+		}
+
+		carry := charValue
+		for byteIndex := len(decoded) - 1; byteIndex >= 0; byteIndex-- {
+			carry += 58 * int(decoded[byteIndex])
+			decoded[byteIndex] = byte(carry % 256)
+			carry /= 256
+		}
+		for carry > 0 {
+			decoded = append([]byte{byte(carry % 256)}, decoded...)
+			carry /= 256
+		}
+	}
+
+	return append(make([]byte, leadingZeros), decoded...)
+}
+
+// Encodes raw bytes as a base58 string, writing leading zero bytes as '1' characters.
+func Base58Encode(raw []byte) string {
+	var leadingZeros int
+	for leadingZeros < len(raw) && raw[leadingZeros] == 0 {
+		leadingZeros++
+	}
+
+	// little-endian base 58 accumulator, multiplied by 256 for each byte
+	digits := make([]byte, 0, len(raw)*138/100+1)
+	for _, b := range raw[leadingZeros:] {
+		carry := int(b)
+		for digitIndex := 0; digitIndex < len(digits); digitIndex++ {
+			carry += 256 * int(digits[digitIndex])
+			digits[digitIndex] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	for i := 0; i < leadingZeros; i++ {
+		buffer.WriteByte(integerToBase58[0])
+	}
+	for digitIndex := len(digits) - 1; digitIndex >= 0; digitIndex-- {
+		buffer.WriteByte(integerToBase58[digits[digitIndex]])
+	}
+	return buffer.String()
+}
+
+// Returns the first 4 bytes of the double SHA-256 of payload, as used by base58check.
+func Base58CheckChecksum(payload []byte) [COINSPARK_BASE58CHECK_CHECKSUM_LEN]byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	var checksum [COINSPARK_BASE58CHECK_CHECKSUM_LEN]byte
+	copy(checksum[:], second[:COINSPARK_BASE58CHECK_CHECKSUM_LEN])
+	return checksum
+}
+
+// Decodes a base58check string into its version byte and payload.
+// Returns false if the string is not base58 or the checksum does not match.
+func Base58CheckDecode(base58String string) (success bool, version byte, payload []byte) {
+	decoded := Base58Decode(base58String)
+	if len(decoded) < 1+COINSPARK_BASE58CHECK_CHECKSUM_LEN {
+		return false, 0, nil
+	}
+
+	dataLen := len(decoded) - COINSPARK_BASE58CHECK_CHECKSUM_LEN
+	checksum := Base58CheckChecksum(decoded[:dataLen])
+	if !bytes.Equal(checksum[:], decoded[dataLen:]) {
+		return false, 0, nil
+	}
+
+	return true, decoded[0], decoded[1:dataLen]
+}
+
+// Encodes a version byte and payload as a base58check string.
+func Base58CheckEncode(version byte, payload []byte) string {
+	data := make([]byte, 0, 1+len(payload)+COINSPARK_BASE58CHECK_CHECKSUM_LEN)
+	data = append(data, version)
+	data = append(data, payload...)
+	checksum := Base58CheckChecksum(data)
+	data = append(data, checksum[:]...)
+	return Base58Encode(data)
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestBase58CheckRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		encoded string
+		version byte
+		payload string
+	}{
+		{"1111111111111111111114oLvT2", 0, "0000000000000000000000000000000000000000"},
+		{"149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS", 0, "229904dfe83e32b12d576d4b83f02565f9c1084b"},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", 5, "b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", 111, "243f1394f44554f4ce3fd68649c19adc483ce924"},
+	} {
+		success, version, payload := Base58CheckDecode(test.encoded)
+		if !success || version != test.version || hex.EncodeToString(payload) != test.payload {
+			t.Errorf("decode %s: got %v %d %x", test.encoded, success, version, payload)
+		}
+		payload, _ = hex.DecodeString(test.payload)
+		if encoded := Base58CheckEncode(test.version, payload); encoded != test.encoded {
+			t.Errorf("encode %d %s: got %s, want %s", test.version, test.payload, encoded, test.encoded)
+		}
+	}
+
+	for _, encoded := range []string{
+		"149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnT", // last character changed, so the checksum fails
+		"149wHUMa41Xm2jnZtqgRx94uGbZD9kPXn0", // '0' is not base58
+		"1111",
+		"",
+	} {
+		if success, _, _ := Base58CheckDecode(encoded); success {
+			t.Errorf("decoded %q", encoded)
+		}
+	}
+}
+
+func TestAddressBitcoinAddressChecks(t *testing.T) {
+	var hash160 [COINSPARK_HASH160_LEN]byte
+	copy(hash160[:], []byte("twenty byte hash 160"))
+
+	for _, test := range []struct {
+		name           string
+		bitcoinAddress string
+		wantErr        error
+	}{
+		{"bad checksum", "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnT", ErrBadBitcoinAddress},
+		{"unknown version byte", Base58CheckEncode(0x30, hash160[:]), ErrBadBitcoinAddress},
+		{"21 byte payload", Base58CheckEncode(0, append(hash160[:], 1)), ErrBadBitcoinAddress},
+		{"testnet version byte", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", ErrWrongNetwork},
+		{"empty", "", ErrBadBitcoinAddress},
+	} {
+		address := CoinSparkAddress{BitcoinAddress: test.bitcoinAddress}
+		if err := address.Validate(); err != test.wantErr {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.wantErr)
+		}
+		if encoded := address.Encode(); encoded != "" {
+			t.Errorf("%s: encoded as %s", test.name, encoded)
+		}
+	}
+
+	// The sample address used before checksums were checked holds a mistyped bitcoin address.
+	var address CoinSparkAddress
+	if err := address.DecodeErr("s6GUHy69HWkwFqzFhJCY49seL8EFv"); err != ErrBadBitcoinAddress {
+		t.Errorf("old sample address: got %v, want %v", err, ErrBadBitcoinAddress)
+	}
+}
+
+func TestAddressTypeAndHash160(t *testing.T) {
+	for _, test := range []struct {
+		bitcoinAddress string
+		addressType    CoinSparkAddressType
+		hash160        string
+	}{
+		{"149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS", COINSPARK_ADDRESS_TYPE_P2PKH, "229904dfe83e32b12d576d4b83f02565f9c1084b"},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", COINSPARK_ADDRESS_TYPE_P2SH, "b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+	} {
+		address := CoinSparkAddress{BitcoinAddress: test.bitcoinAddress, AddressFlags: COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_PAYMENT_REFS}
+		address.PaymentRef.Ref = 12345
+		encoded := address.Encode()
+
+		var decoded CoinSparkAddress
+		if err := decoded.DecodeErr(encoded); err != nil {
+			t.Fatalf("%s: %v", encoded, err)
+		}
+		if decoded.BitcoinAddress != test.bitcoinAddress || decoded.AddressFlags != address.AddressFlags || decoded.PaymentRef != address.PaymentRef {
+			t.Errorf("%s decoded to %+v", encoded, decoded)
+		}
+		if decoded.AddressType != test.addressType || hex.EncodeToString(decoded.Hash160[:]) != test.hash160 {
+			t.Errorf("%s: type %d and hash160 %x, want %d and %s", test.bitcoinAddress, decoded.AddressType, decoded.Hash160, test.addressType, test.hash160)
+		}
+	}
+}
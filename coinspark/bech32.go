@@ -0,0 +1,503 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Bech32 (BIP173) and bech32m (BIP350) encodings, plus the CoinSpark address extension
+// which wraps a segwit address.
+//
+// A CoinSpark segwit address is written as 's', the marker '0' (which never appears in
+// base58, so these cannot be confused with regular CoinSpark addresses), a format version
+// character, and then a body of bech32 characters:
+//
+//	body[0]   index of the bech32 human-readable part in bech32HRPs
+//	body[1]   number of characters for the address flags
+//	body[2]   number of characters for the payment reference
+//	...       address flags, then payment reference, in little endian base 32
+//	...       data part of the segwit address (after the '1'), offset by
+//	          COINSPARK_ADDRESS_CHAR_INCREMENT plus the extra data characters in turn
+//
+// The first half of the body is then obfuscated using the second half, as for regular
+// CoinSpark addresses. The result is case insensitive and always encoded in lower case.
+
+const (
+	COINSPARK_BECH32_ENCODING_NONE    = 0
+	COINSPARK_BECH32_ENCODING_BECH32  = 1
+	COINSPARK_BECH32_ENCODING_BECH32M = 2
+
+	COINSPARK_BECH32_CONST        = 1
+	COINSPARK_BECH32M_CONST       = 0x2bc830a3
+	COINSPARK_BECH32_CHECKSUM_LEN = 6
+	COINSPARK_BECH32_MAX_LEN      = 90
+	COINSPARK_BECH32_SEPARATOR    = '1'
+
+	COINSPARK_WITNESS_VERSION_MAX     = 16
+	COINSPARK_WITNESS_PROGRAM_MIN_LEN = 2
+	COINSPARK_WITNESS_PROGRAM_MAX_LEN = 40
+
+	COINSPARK_ADDRESS_BECH32_MARKER  = '0'
+	COINSPARK_ADDRESS_BECH32_VERSION = 0
+	COINSPARK_ADDRESS_BECH32_HEADER  = 3 // body characters before the extra data
+
+	COINSPARK_ADDRESS_BECH32_FLAG_CHARS_MAX = 5  // enough for COINSPARK_ADDRESS_FLAG_MASK
+	COINSPARK_ADDRESS_BECH32_REF_CHARS_MAX  = 11 // enough for COINSPARK_PAYMENT_REF_MAX
+)
+
+var bech32Charset = []byte("qpzry9x8gf2tvdw0s3jn54khce6mua7l")
+
+// Human-readable parts which can be wrapped in a CoinSpark address. The order is part of
+// the encoding, so new entries may only be added to the end.
+var bech32HRPs = []string{"bc", "tb", "bcrt"}
+
+// returns -1 if invalid
+func Bech32ToInteger(bech32Character byte) int {
+	if bech32Character >= 'A' && bech32Character <= 'Z' {
+		bech32Character += 'a' - 'A'
+	}
+	return bytes.IndexByte(bech32Charset, bech32Character)
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, value := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32EncodingConst(encoding int) uint32 {
+	if encoding == COINSPARK_BECH32_ENCODING_BECH32M {
+		return COINSPARK_BECH32M_CONST
+	}
+	return COINSPARK_BECH32_CONST
+}
+
+// Encodes a human-readable part and 5-bit data values as a bech32 or bech32m string.
+// Returns empty string if any of the inputs are out of range.
+func Bech32Encode(hrp string, data []byte, encoding int) string {
+	if hrp == "" || encoding == COINSPARK_BECH32_ENCODING_NONE {
+		return ""
+	}
+	hrp = strings.ToLower(hrp)
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return ""
+		}
+	}
+
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, make([]byte, COINSPARK_BECH32_CHECKSUM_LEN)...)
+	polymod := bech32Polymod(values) ^ bech32EncodingConst(encoding)
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString(hrp)
+	buffer.WriteByte(COINSPARK_BECH32_SEPARATOR)
+	for _, value := range data {
+		if value > 31 {
+			return ""
+		}
+		buffer.WriteByte(bech32Charset[value])
+	}
+	for i := 0; i < COINSPARK_BECH32_CHECKSUM_LEN; i++ {
+		buffer.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+
+	if buffer.Len() > COINSPARK_BECH32_MAX_LEN {
+		return ""
+	}
+	return buffer.String()
+}
+
+// Decodes a bech32 or bech32m string into its human-readable part and 5-bit data values,
+// without the checksum. Returns false if the string or its checksum is invalid.
+func Bech32Decode(bech32String string) (success bool, hrp string, data []byte, encoding int) {
+	if len(bech32String) > COINSPARK_BECH32_MAX_LEN {
+		return false, "", nil, COINSPARK_BECH32_ENCODING_NONE
+	}
+
+	lower := strings.ToLower(bech32String)
+	if lower != bech32String && strings.ToUpper(bech32String) != bech32String {
+		return false, "", nil, COINSPARK_BECH32_ENCODING_NONE // mixed case is not allowed
+	}
+
+	separatorPos := strings.LastIndexByte(lower, COINSPARK_BECH32_SEPARATOR)
+	if separatorPos < 1 || separatorPos+1+COINSPARK_BECH32_CHECKSUM_LEN > len(lower) {
+		return false, "", nil, COINSPARK_BECH32_ENCODING_NONE
+	}
+
+	hrp = lower[:separatorPos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return false, "", nil, COINSPARK_BECH32_ENCODING_NONE
+		}
+	}
+
+	values := make([]byte, 0, len(lower)-separatorPos-1)
+	for charIndex := separatorPos + 1; charIndex < len(lower); charIndex++ {
+		charValue := Bech32ToInteger(lower[charIndex])
+		if charValue < 0 {
+			return false, "", nil, COINSPARK_BECH32_ENCODING_NONE
+		}
+		values = append(values, byte(charValue))
+	}
+
+	switch bech32Polymod(append(bech32HRPExpand(hrp), values...)) {
+	case COINSPARK_BECH32_CONST:
+		encoding = COINSPARK_BECH32_ENCODING_BECH32
+	case COINSPARK_BECH32M_CONST:
+		encoding = COINSPARK_BECH32_ENCODING_BECH32M
+	default:
+		return false, "", nil, COINSPARK_BECH32_ENCODING_NONE
+	}
+
+	return true, hrp, values[:len(values)-COINSPARK_BECH32_CHECKSUM_LEN], encoding
+}
+
+// Regroups a sequence of fromBits-bit values into toBits-bit values.
+// Returns nil if padding is not allowed and there are leftover non-zero bits.
+func Bech32ConvertBits(data []byte, fromBits uint, toBits uint, pad bool) []byte {
+	var acc, bits uint
+	maxv := uint(1)<<toBits - 1
+	result := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+
+	for _, value := range data {
+		if uint(value)>>fromBits != 0 {
+			return nil
+		}
+		acc = acc<<fromBits | uint(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte((acc>>bits)&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte((acc<<(toBits-bits))&maxv))
+		}
+	} else if bits >= fromBits || (acc<<(toBits-bits))&maxv != 0 {
+		return nil
+	}
+
+	return result
+}
+
+// Decodes a segwit address with the given human-readable part, checking that version 0
+// uses bech32 and later versions use bech32m. Returns the witness version and program.
+func DecodeSegwitAddress(hrp string, address string) (success bool, witnessVersion int, witnessProgram []byte) {
+	success, decodedHRP, data, encoding := Bech32Decode(address)
+	if !success || decodedHRP != strings.ToLower(hrp) || len(data) < 1 {
+		return false, 0, nil
+	}
+
+	witnessVersion = int(data[0])
+	if witnessVersion > COINSPARK_WITNESS_VERSION_MAX {
+		return false, 0, nil
+	}
+	if (witnessVersion == 0) != (encoding == COINSPARK_BECH32_ENCODING_BECH32) {
+		return false, 0, nil
+	}
+
+	witnessProgram = Bech32ConvertBits(data[1:], 5, 8, false)
+	if witnessProgram == nil || len(witnessProgram) < COINSPARK_WITNESS_PROGRAM_MIN_LEN || len(witnessProgram) > COINSPARK_WITNESS_PROGRAM_MAX_LEN {
+		return false, 0, nil
+	}
+	if witnessVersion == 0 && len(witnessProgram) != 20 && len(witnessProgram) != 32 {
+		return false, 0, nil
+	}
+
+	return true, witnessVersion, witnessProgram
+}
+
+// Encodes a witness version and program as a segwit address with the given human-readable part.
+// Returns empty string if the version or program is invalid.
+func EncodeSegwitAddress(hrp string, witnessVersion int, witnessProgram []byte) string {
+	if witnessVersion < 0 || witnessVersion > COINSPARK_WITNESS_VERSION_MAX {
+		return ""
+	}
+
+	encoding := COINSPARK_BECH32_ENCODING_BECH32M
+	if witnessVersion == 0 {
+		encoding = COINSPARK_BECH32_ENCODING_BECH32
+	}
+
+	data := append([]byte{byte(witnessVersion)}, Bech32ConvertBits(witnessProgram, 8, 5, true)...)
+	address := Bech32Encode(hrp, data, encoding)
+
+	if success, _, _ := DecodeSegwitAddress(hrp, address); !success {
+		return ""
+	}
+	return address
+}
+
+// Returns the address type for a witness version and program length.
+func WitnessAddressType(witnessVersion int, witnessProgramLen int) CoinSparkAddressType {
+	if witnessVersion == 0 && witnessProgramLen == 20 {
+		return COINSPARK_ADDRESS_TYPE_P2WPKH
+	} else if witnessVersion == 0 && witnessProgramLen == 32 {
+		return COINSPARK_ADDRESS_TYPE_P2WSH
+	} else if witnessVersion == 1 && witnessProgramLen == 32 {
+		return COINSPARK_ADDRESS_TYPE_P2TR
+	}
+	return COINSPARK_ADDRESS_TYPE_WITNESS_UNKNOWN
+}
+
+// Decodes a segwit address whose human-readable part belongs to this network.
+func (p *CoinSparkNetwork) DecodeSegwitAddress(address string) (success bool, witnessVersion int, witnessProgram []byte) {
+	return DecodeSegwitAddress(p.Bech32HRP, address)
+}
+
+// Encodes a witness version and program as a segwit address on this network.
+func (p *CoinSparkNetwork) EncodeSegwitAddress(witnessVersion int, witnessProgram []byte) string {
+	return EncodeSegwitAddress(p.Bech32HRP, witnessVersion, witnessProgram)
+}
+
+// Returns true if the string looks like a bech32 address, rather than a base58 one.
+func isSegwitAddress(bitcoinAddress string) bool {
+	success, _, _, _ := Bech32Decode(bitcoinAddress)
+	return success
+}
+
+// Decodes a segwit address against p.Network.
+func (p *CoinSparkAddress) decodeSegwitAddress() (success bool, witnessVersion int, witnessProgram []byte) {
+	return p.network().DecodeSegwitAddress(p.BitcoinAddress)
+}
+
+// Returns true if the string starts like a CoinSpark address which wraps a segwit address.
+func isBech32CoinSparkAddress(sparkAddress string) bool {
+	return len(sparkAddress) >= 2 &&
+		(sparkAddress[0] == COINSPARK_ADDRESS_PREFIX || sparkAddress[0] == COINSPARK_ADDRESS_PREFIX-'a'+'A') &&
+		sparkAddress[1] == COINSPARK_ADDRESS_BECH32_MARKER
+}
+
+// Decodes a CoinSpark address which wraps a segwit address, as described at the top of this file.
+func (p *CoinSparkAddress) decodeBech32(sparkAddress string) error {
+	var hrpIndex, addressFlagChars, paymentRefChars, extraDataChars int
+	var multiplier uint64
+
+	lower := strings.ToLower(sparkAddress)
+	if lower != sparkAddress && strings.ToUpper(sparkAddress) != sparkAddress {
+		return ErrMixedCase
+	}
+
+	if len(lower) < 3+COINSPARK_ADDRESS_BECH32_HEADER || Bech32ToInteger(lower[2]) != COINSPARK_ADDRESS_BECH32_VERSION {
+		return ErrBadFormat
+	}
+
+	body := make([]byte, len(lower)-3)
+	for charIndex := range body {
+		charValue := Bech32ToInteger(lower[3+charIndex])
+		if charValue < 0 {
+			return ErrBadBech32Char{3 + charIndex, sparkAddress[3+charIndex]}
+		}
+		body[charIndex] = byte(charValue)
+	}
+
+	//  De-obfuscate first half of body using second half
+
+	bodyLen := len(body)
+	for charIndex := 0; charIndex < bodyLen/2; charIndex++ {
+		body[charIndex] = (body[charIndex] + 32 - body[bodyLen-1-charIndex]) % 32
+	}
+
+	//  Get human-readable part and length of extra data
+
+	hrpIndex = int(body[0])
+	addressFlagChars = int(body[1])
+	paymentRefChars = int(body[2])
+	extraDataChars = addressFlagChars + paymentRefChars
+
+	if hrpIndex >= len(bech32HRPs) || bodyLen < COINSPARK_ADDRESS_BECH32_HEADER+extraDataChars {
+		return ErrBadFormat
+	}
+	if addressFlagChars > COINSPARK_ADDRESS_BECH32_FLAG_CHARS_MAX {
+		return ErrOutOfRange{"AddressFlags"}
+	}
+	if paymentRefChars > COINSPARK_ADDRESS_BECH32_REF_CHARS_MAX {
+		return ErrOutOfRange{"PaymentRef"}
+	}
+
+	//  Only one encoding is accepted for each address, so the last digit of each value is not zero
+
+	if (addressFlagChars > 0 && body[COINSPARK_ADDRESS_BECH32_HEADER+addressFlagChars-1] == 0) ||
+		(paymentRefChars > 0 && body[COINSPARK_ADDRESS_BECH32_HEADER+extraDataChars-1] == 0) {
+		return ErrBadFormat
+	}
+
+	//  Read the extra data for address flags and payment reference
+
+	var addressFlags uint64
+	multiplier = 1
+	for charIndex := 0; charIndex < addressFlagChars; charIndex++ {
+		addressFlags += uint64(body[COINSPARK_ADDRESS_BECH32_HEADER+charIndex]) * multiplier
+		multiplier *= 32
+	}
+
+	var paymentRef uint64
+	multiplier = 1
+	for charIndex := 0; charIndex < paymentRefChars; charIndex++ {
+		paymentRef += uint64(body[COINSPARK_ADDRESS_BECH32_HEADER+addressFlagChars+charIndex]) * multiplier
+		multiplier *= 32
+	}
+
+	if addressFlags > COINSPARK_ADDRESS_FLAG_MASK {
+		return ErrOutOfRange{"AddressFlags"}
+	}
+	if paymentRef > COINSPARK_PAYMENT_REF_MAX {
+		return ErrOutOfRange{"PaymentRef"}
+	}
+
+	//  Convert the segwit address
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString(bech32HRPs[hrpIndex])
+	buffer.WriteByte(COINSPARK_BECH32_SEPARATOR)
+
+	for charIndex := 0; charIndex < bodyLen-COINSPARK_ADDRESS_BECH32_HEADER-extraDataChars; charIndex++ {
+		charValue := int(body[COINSPARK_ADDRESS_BECH32_HEADER+extraDataChars+charIndex])
+		charValue += 32*2 - COINSPARK_ADDRESS_CHAR_INCREMENT
+
+		if extraDataChars > 0 {
+			charValue -= int(body[COINSPARK_ADDRESS_BECH32_HEADER+charIndex%extraDataChars])
+		}
+
+		buffer.WriteByte(bech32Charset[charValue%32])
+	}
+
+	p.BitcoinAddress = buffer.String()
+	p.AddressFlags = CoinSparkAddressFlags(addressFlags)
+	p.PaymentRef = CoinSparkPaymentRef{paymentRef}
+
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	p.setSegwitFields()
+	return nil
+}
+
+// Encodes a CoinSpark address which wraps a segwit address, as described at the top of this file.
+func (p *CoinSparkAddress) encodeBech32() string {
+	success, hrp, data, _ := Bech32Decode(p.BitcoinAddress)
+	if !success {
+		return ""
+	}
+
+	hrpIndex := -1
+	for index, knownHRP := range bech32HRPs {
+		if knownHRP == hrp {
+			hrpIndex = index
+		}
+	}
+	if hrpIndex < 0 {
+		return ""
+	}
+
+	//  Build up extra data for address flags and payment reference
+
+	addressFlagDigits := []byte{}
+	for testAddressFlags := p.AddressFlags; testAddressFlags > 0; testAddressFlags /= 32 {
+		addressFlagDigits = append(addressFlagDigits, byte(testAddressFlags%32))
+	}
+
+	paymentRefDigits := []byte{}
+	for testPaymentRef := p.PaymentRef.Ref; testPaymentRef > 0; testPaymentRef /= 32 {
+		paymentRefDigits = append(paymentRefDigits, byte(testPaymentRef%32))
+	}
+
+	//  Add the checksum to the data part of the segwit address
+
+	data = append(data, make([]byte, COINSPARK_BECH32_CHECKSUM_LEN)...)
+	checksumPos := len(p.BitcoinAddress) - COINSPARK_BECH32_CHECKSUM_LEN
+	for charIndex := 0; charIndex < COINSPARK_BECH32_CHECKSUM_LEN; charIndex++ {
+		data[len(data)-COINSPARK_BECH32_CHECKSUM_LEN+charIndex] = byte(Bech32ToInteger(p.BitcoinAddress[checksumPos+charIndex]))
+	}
+
+	return encodeBech32Body(hrpIndex, addressFlagDigits, paymentRefDigits, data)
+}
+
+// Writes a bech32 CoinSpark address from its parts, with the address flags and payment
+// reference as little-endian base 32 digits, and data holding the segwit data and checksum.
+func encodeBech32Body(hrpIndex int, addressFlagDigits []byte, paymentRefDigits []byte, data []byte) string {
+	extraData := append(append([]byte{}, addressFlagDigits...), paymentRefDigits...)
+	extraDataChars := len(extraData)
+
+	body := []byte{byte(hrpIndex), byte(len(addressFlagDigits)), byte(len(paymentRefDigits))}
+	body = append(body, extraData...)
+
+	for charIndex, value := range data {
+		charValue := int(value) + COINSPARK_ADDRESS_CHAR_INCREMENT
+		if extraDataChars > 0 {
+			charValue += int(extraData[charIndex%extraDataChars])
+		}
+		body = append(body, byte(charValue%32))
+	}
+
+	//  Obfuscate first half of body using second half to prevent common prefixes
+
+	bodyLen := len(body)
+	for charIndex := 0; charIndex < bodyLen/2; charIndex++ {
+		body[charIndex] = (body[charIndex] + body[bodyLen-1-charIndex]) % 32
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.WriteByte(COINSPARK_ADDRESS_PREFIX)
+	buffer.WriteByte(COINSPARK_ADDRESS_BECH32_MARKER)
+	buffer.WriteByte(bech32Charset[COINSPARK_ADDRESS_BECH32_VERSION])
+	for _, value := range body {
+		buffer.WriteByte(bech32Charset[value])
+	}
+	return buffer.String()
+}
+
+// Fills in AddressType, Hash160, WitnessVersion and WitnessProgram from a segwit BitcoinAddress.
+func (p *CoinSparkAddress) setSegwitFields() {
+	_, p.WitnessVersion, p.WitnessProgram = p.decodeSegwitAddress()
+	p.AddressType = WitnessAddressType(p.WitnessVersion, len(p.WitnessProgram))
+	p.Hash160 = [COINSPARK_HASH160_LEN]byte{}
+	if p.AddressType == COINSPARK_ADDRESS_TYPE_P2WPKH {
+		copy(p.Hash160[:], p.WitnessProgram)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+const bech32TestBitcoinAddress = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+// Writes a CoinSpark address wrapping bech32TestBitcoinAddress with the digits given, which
+// need not be what Encode would choose.
+func bech32TestAddress(addressFlagDigits []byte, paymentRefDigits []byte) string {
+	_, _, data, _ := Bech32Decode(bech32TestBitcoinAddress)
+	for charIndex := len(bech32TestBitcoinAddress) - COINSPARK_BECH32_CHECKSUM_LEN; charIndex < len(bech32TestBitcoinAddress); charIndex++ {
+		data = append(data, byte(Bech32ToInteger(bech32TestBitcoinAddress[charIndex])))
+	}
+	return encodeBech32Body(0, addressFlagDigits, paymentRefDigits, data)
+}
+
+func TestBech32AddressDigits(t *testing.T) {
+	address := CoinSparkAddress{BitcoinAddress: bech32TestBitcoinAddress, AddressFlags: 0x21, PaymentRef: CoinSparkPaymentRef{32*32 + 7}}
+	if encoded := bech32TestAddress([]byte{1, 1}, []byte{7, 0, 1}); encoded != address.Encode() {
+		t.Fatalf("test encoder wrote %s, Encode wrote %s", encoded, address.Encode())
+	}
+
+	overflow := make([]byte, 14) // 32^13 is 2^65, so the last digit is lost in a uint64
+	overflow[0], overflow[13] = 1, 1
+
+	for _, test := range []struct {
+		name              string
+		addressFlagDigits []byte
+		paymentRefDigits  []byte
+		wantErr           error
+	}{
+		{"minimal", []byte{1, 1}, []byte{7, 0, 1}, nil},
+		{"no extra data", nil, nil, nil},
+		{"largest flags and payment ref", []byte{31, 31, 31, 31, 7}, []byte{31, 31, 31, 31, 31, 31, 31, 31, 31, 31, 3}, nil},
+		{"flags with a trailing zero", []byte{1, 1, 0}, []byte{7, 0, 1}, ErrBadFormat},
+		{"payment ref with a trailing zero", []byte{1, 1}, []byte{7, 0, 1, 0}, ErrBadFormat},
+		{"zero flags written out", []byte{0}, nil, ErrBadFormat},
+		{"flags above the mask", []byte{31, 31, 31, 31, 8}, nil, ErrOutOfRange{"AddressFlags"}},
+		{"payment ref above the maximum", nil, []byte{31, 31, 31, 31, 31, 31, 31, 31, 31, 31, 4}, ErrOutOfRange{"PaymentRef"}},
+		{"flags overflowing", overflow, nil, ErrOutOfRange{"AddressFlags"}},
+		{"payment ref overflowing", nil, overflow, ErrOutOfRange{"PaymentRef"}},
+		{"six flag digits", []byte{1, 0, 0, 0, 0, 1}, nil, ErrOutOfRange{"AddressFlags"}},
+		{"twelve payment ref digits", nil, []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, ErrOutOfRange{"PaymentRef"}},
+	} {
+		encoded := bech32TestAddress(test.addressFlagDigits, test.paymentRefDigits)
+		var decoded CoinSparkAddress
+		err := decoded.DecodeErr(encoded)
+		if err != test.wantErr {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && decoded.Encode() != encoded {
+			t.Errorf("%s: %s encodes back as %s", test.name, encoded, decoded.Encode())
+		}
+	}
+}
+
+// Each of these has the same bitcoin address, flags and payment reference as another string, or
+// would have before the extra data was checked for overflow.
+func TestBech32AddressOnlyOneEncoding(t *testing.T) {
+	for _, test := range []struct {
+		sparkAddress string
+		sameAs       string
+	}{
+		{"s0qzuzc4q2vazadlxvn8asrcvh6cp3ls2het3juvp5uvrq5hlez", "s0qzpzckq2d2sfgjde7x3lflv9jzh7st3q23javp5uv2e4hllz"},     // flags digits end in zero
+		{"s0qfmrhkq2dup7dl8tjgasyhtc63zsls3s623jr9znuv2e4klef", "s0qzpzckq2d2sfgjde7x3lflv9jzh7st3q23javp5uv2e4hllz"},     // payment ref digits end in zero
+		{"s0qzx7h5ertmnzxu3s2679s6ymcsuetc6kr3ps702se2s3uxznmtre5k7cz", "s0qr6lcrkxf3025yj9y48wzp3lst36t3jaxz5uvy64hler"}, // flags 1+2^65
+		{"s0qzcvh5ertmnzxu3s2679s6ymcsuetc6kr3ps702se2s3uxznmtre5k7cz", "s0qreqcrkxf3025yj9y48wzp3lst36t3jaxz5uvy64hler"}, // payment ref 1+2^65
+	} {
+		var address CoinSparkAddress
+		if address.Decode(test.sparkAddress) {
+			t.Errorf("decoded %s to %s", test.sparkAddress, address.String())
+		}
+		if !address.Decode(test.sameAs) || address.Encode() != test.sameAs {
+			t.Errorf("%s does not round trip", test.sameAs)
+		}
+	}
+}
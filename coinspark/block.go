@@ -0,0 +1,263 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Asset references from serialized blocks, as returned by bitcoind's getblock with verbosity 0.
+// TxOffset is the byte offset of the genesis transaction from the start of the block, counting
+// the 80-byte header and transaction count, and any witness data of earlier transactions.
+// TxIDPrefix is the first bytes of the txid as usually displayed, i.e. in reversed byte order.
+
+const (
+	COINSPARK_BLOCK_HEADER_LEN = 80
+	COINSPARK_TXID_LEN         = 32
+)
+
+// A transaction found in a serialized block.
+type CoinSparkBlockTransaction struct {
+	Offset int64  // bytes from the start of the block
+	TxID   string // lowercase hex, as usually displayed
+	Raw    []byte // full serialization, including any witness data
+}
+
+// Splits a serialized block into its transactions, computing the offset and txid of each.
+func BlockTransactions(block []byte) (err error, transactions []CoinSparkBlockTransaction) {
+	reader := blockReader{data: block, pos: COINSPARK_BLOCK_HEADER_LEN}
+	if len(block) < COINSPARK_BLOCK_HEADER_LEN {
+		return ErrTruncated{"block header", len(block)}, nil
+	}
+
+	err, countTransactions := reader.readVarInt("block transaction count")
+	if err != nil {
+		return err, nil
+	}
+
+	for txIndex := uint64(0); txIndex < countTransactions; txIndex++ {
+		err, transaction := reader.readTransaction()
+		if err != nil {
+			return err, nil
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	if reader.pos != len(block) {
+		return ErrBadFormat, nil // trailing bytes after the last transaction
+	}
+
+	return nil, transactions
+}
+
+// Returns the asset reference for the genesis transaction txID (hex, as usually displayed)
+// confirmed in the serialized block at height blockNum.
+func BlockToAssetRef(block []byte, blockNum int64, txID string) (err error, assetRef *CoinSparkAssetRef) {
+	txID = strings.ToLower(txID)
+	if txIDBytes, err := hex.DecodeString(txID); err != nil || len(txIDBytes) != COINSPARK_TXID_LEN {
+		return ErrBadFormat, nil
+	}
+
+	err, transactions := BlockTransactions(block)
+	if err != nil {
+		return err, nil
+	}
+
+	for _, transaction := range transactions {
+		if transaction.TxID == txID {
+			assetRef = new(CoinSparkAssetRef)
+			assetRef.BlockNum = blockNum
+			assetRef.TxOffset = transaction.Offset
+			assetRef.TxIDPrefix = txIDToPrefix(txID)
+			if err := assetRef.Validate(); err != nil {
+				return err, nil
+			}
+			return nil, assetRef
+		}
+	}
+
+	return ErrTxNotFound, nil
+}
+
+// Finds the genesis transaction for the asset reference in its serialized block, checking that a
+// transaction starts at TxOffset and that its txid starts with TxIDPrefix. The caller must supply
+// the block at height BlockNum. Returns the transaction if it matches.
+func (p *CoinSparkAssetRef) FindInBlock(block []byte) (err error, transaction *CoinSparkBlockTransaction) {
+	err, transactions := BlockTransactions(block)
+	if err != nil {
+		return err, nil
+	}
+
+	for transactionIndex := range transactions {
+		if transactions[transactionIndex].Offset == p.TxOffset {
+			if txIDToPrefix(transactions[transactionIndex].TxID) != p.TxIDPrefix {
+				return ErrTxIDMismatch, nil
+			}
+			return nil, &transactions[transactionIndex]
+		}
+	}
+
+	return ErrTxNotFound, nil
+}
+
+func txIDToPrefix(txID string) [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte {
+	var prefix [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte
+	hex.Decode(prefix[:], []byte(txID[:2*COINSPARK_ASSETREF_TXID_PREFIX_LEN]))
+	return prefix
+}
+
+type blockReader struct {
+	data []byte
+	pos  int
+}
+
+func (p *blockReader) read(section string, count uint64) (error, []byte) {
+	if count > uint64(len(p.data)-p.pos) {
+		return ErrTruncated{section, p.pos}, nil
+	}
+	result := p.data[p.pos : p.pos+int(count)]
+	p.pos += int(count)
+	return nil, result
+}
+
+// Reads a bitcoin CompactSize unsigned integer.
+func (p *blockReader) readVarInt(section string) (error, uint64) {
+	err, first := p.read(section, 1)
+	if err != nil {
+		return err, 0
+	}
+
+	var size uint64
+	switch first[0] {
+	case 0xfd:
+		size = 2
+	case 0xfe:
+		size = 4
+	case 0xff:
+		size = 8
+	default:
+		return nil, uint64(first[0])
+	}
+
+	err, value := p.read(section, size)
+	if err != nil {
+		return err, 0
+	}
+
+	var result uint64
+	for i := int(size) - 1; i >= 0; i-- {
+		result = result<<8 | uint64(value[i])
+	}
+	return nil, result
+}
+
+// Reads a length-prefixed byte string.
+func (p *blockReader) readVarBytes(section string) (error, []byte) {
+	err, length := p.readVarInt(section)
+	if err != nil {
+		return err, nil
+	}
+	return p.read(section, length)
+}
+
+// Reads one transaction, computing its txid from the serialization without witness data.
+func (p *blockReader) readTransaction() (err error, transaction CoinSparkBlockTransaction) {
+	start := p.pos
+	transaction.Offset = int64(start)
+
+	if err, _ = p.read("transaction version", 4); err != nil {
+		return err, transaction
+	}
+
+	hasWitness := p.pos+1 < len(p.data) && p.data[p.pos] == 0x00 && p.data[p.pos+1] != 0x00
+	var stripped []byte // serialization without marker, flag and witnesses
+	stripped = append(stripped, p.data[start:p.pos]...)
+	if hasWitness {
+		p.pos += 2
+	}
+	bodyStart := p.pos
+
+	err, countInputs := p.readVarInt("transaction input count")
+	if err != nil {
+		return err, transaction
+	}
+	for inputIndex := uint64(0); inputIndex < countInputs; inputIndex++ {
+		if err, _ = p.read("transaction input", COINSPARK_TXID_LEN+4); err != nil {
+			return err, transaction
+		}
+		if err, _ = p.readVarBytes("transaction input script"); err != nil {
+			return err, transaction
+		}
+		if err, _ = p.read("transaction input sequence", 4); err != nil {
+			return err, transaction
+		}
+	}
+
+	err, countOutputs := p.readVarInt("transaction output count")
+	if err != nil {
+		return err, transaction
+	}
+	for outputIndex := uint64(0); outputIndex < countOutputs; outputIndex++ {
+		if err, _ = p.read("transaction output value", 8); err != nil {
+			return err, transaction
+		}
+		if err, _ = p.readVarBytes("transaction output script"); err != nil {
+			return err, transaction
+		}
+	}
+	stripped = append(stripped, p.data[bodyStart:p.pos]...)
+
+	if hasWitness {
+		for inputIndex := uint64(0); inputIndex < countInputs; inputIndex++ {
+			err, countItems := p.readVarInt("transaction witness")
+			if err != nil {
+				return err, transaction
+			}
+			for itemIndex := uint64(0); itemIndex < countItems; itemIndex++ {
+				if err, _ = p.readVarBytes("transaction witness"); err != nil {
+					return err, transaction
+				}
+			}
+		}
+	}
+
+	err, lockTime := p.read("transaction lock time", 4)
+	if err != nil {
+		return err, transaction
+	}
+	stripped = append(stripped, lockTime...)
+
+	transaction.Raw = p.data[start:p.pos]
+	transaction.TxID = hashToTxID(stripped)
+	return nil, transaction
+}
+
+// Returns the double SHA-256 of data as a txid in the usual reversed byte order.
+func hashToTxID(data []byte) string {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	for i := 0; i < len(second)/2; i++ {
+		second[i], second[len(second)-1-i] = second[len(second)-1-i], second[i]
+	}
+	return hex.EncodeToString(second[:])
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// The coinbase transaction of the bitcoin genesis block.
+const (
+	blockTestTxHex = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+	blockTestTxID  = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+)
+
+// Returns the test transaction with a segwit marker, flag and one witness item added,
+// which must not change its txid.
+func blockTestWitnessTx() []byte {
+	tx, _ := hex.DecodeString(blockTestTxHex)
+	witnessTx := append([]byte{}, tx[:4]...)
+	witnessTx = append(witnessTx, 0x00, 0x01)
+	witnessTx = append(witnessTx, tx[4:len(tx)-4]...)
+	witnessTx = append(witnessTx, 0x01, 0x02, 0xab, 0xcd)
+	return append(witnessTx, tx[len(tx)-4:]...)
+}
+
+func blockTestBlock(countPrefix []byte, transactions ...[]byte) []byte {
+	block := make([]byte, COINSPARK_BLOCK_HEADER_LEN)
+	block = append(block, countPrefix...)
+	for _, transaction := range transactions {
+		block = append(block, transaction...)
+	}
+	return block
+}
+
+func TestBlockTransactions(t *testing.T) {
+	tx, _ := hex.DecodeString(blockTestTxHex)
+	witnessTx := blockTestWitnessTx()
+	block := blockTestBlock([]byte{0x02}, tx, witnessTx)
+
+	err, transactions := BlockTransactions(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("got %d transactions, want 2", len(transactions))
+	}
+
+	wantOffsets := []int64{COINSPARK_BLOCK_HEADER_LEN + 1, COINSPARK_BLOCK_HEADER_LEN + 1 + int64(len(tx))}
+	wantRaw := [][]byte{tx, witnessTx}
+	for index, transaction := range transactions {
+		if transaction.TxID != blockTestTxID {
+			t.Errorf("transaction %d: txid %s, want %s", index, transaction.TxID, blockTestTxID)
+		}
+		if transaction.Offset != wantOffsets[index] {
+			t.Errorf("transaction %d: offset %d, want %d", index, transaction.Offset, wantOffsets[index])
+		}
+		if !bytes.Equal(transaction.Raw, wantRaw[index]) {
+			t.Errorf("transaction %d: raw serialization does not match", index)
+		}
+	}
+
+	if err, _ := BlockTransactions(append(block, 0x00)); err != ErrBadFormat {
+		t.Errorf("trailing byte: got %v, want %v", err, ErrBadFormat)
+	}
+	if err, _ := BlockTransactions(block[:len(block)-1]); err != (ErrTruncated{"transaction lock time", len(block) - 4}) {
+		t.Errorf("truncated block: got %v", err)
+	}
+}
+
+func TestBlockTransactionCountVarInt(t *testing.T) {
+	tx, _ := hex.DecodeString(blockTestTxHex)
+	for _, countPrefix := range [][]byte{
+		{0x01},
+		{0xfd, 0x01, 0x00},
+		{0xfe, 0x01, 0x00, 0x00, 0x00},
+		{0xff, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	} {
+		err, transactions := BlockTransactions(blockTestBlock(countPrefix, tx))
+		if err != nil || len(transactions) != 1 {
+			t.Errorf("count %x: got %d transactions, error %v", countPrefix, len(transactions), err)
+			continue
+		}
+		if want := int64(COINSPARK_BLOCK_HEADER_LEN + len(countPrefix)); transactions[0].Offset != want {
+			t.Errorf("count %x: offset %d, want %d", countPrefix, transactions[0].Offset, want)
+		}
+	}
+
+	reader := blockReader{data: []byte{0xfd, 0x34, 0x12, 0xfe, 0x78, 0x56}}
+	if err, value := reader.readVarInt("test"); err != nil || value != 0x1234 {
+		t.Errorf("readVarInt = %x, %v", value, err)
+	}
+	if err, _ := reader.readVarInt("test"); err != (ErrTruncated{"test", 4}) {
+		t.Errorf("truncated readVarInt: got %v", err)
+	}
+}
+
+func TestBlockToAssetRef(t *testing.T) {
+	tx, _ := hex.DecodeString(blockTestTxHex)
+	block := blockTestBlock([]byte{0x02}, blockTestWitnessTx(), tx)
+
+	err, assetRef := BlockToAssetRef(block, 123456, blockTestTxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assetRef.BlockNum != 123456 || assetRef.TxOffset != COINSPARK_BLOCK_HEADER_LEN+1 {
+		t.Errorf("got block %d offset %d", assetRef.BlockNum, assetRef.TxOffset)
+	}
+	if want := [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x4a, 0x5e}; assetRef.TxIDPrefix != want {
+		t.Errorf("txid prefix %x, want %x", assetRef.TxIDPrefix, want)
+	}
+
+	err, transaction := assetRef.FindInBlock(block)
+	if err != nil || transaction.Offset != assetRef.TxOffset {
+		t.Errorf("FindInBlock: %v", err)
+	}
+
+	if err, _ := BlockToAssetRef(block, 123456, "00"+blockTestTxID[2:]); err != ErrTxNotFound {
+		t.Errorf("unknown txid: got %v, want %v", err, ErrTxNotFound)
+	}
+}
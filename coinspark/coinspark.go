@@ -24,16 +24,16 @@ package coinspark
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
-	"math/rand"
+	"math/big"
 	"net"
 	"strings"
-	"time"
 )
 
 //#define TRUE 1
@@ -122,6 +122,18 @@ type CoinSparkSatoshiQty int64
 type CoinSparkAssetQty int64
 type CoinSparkIOIndex int
 type CoinSparkAddressFlags int32
+type CoinSparkAddressType int
+
+// Bitcoin address types which can be embedded in a CoinSpark address
+const (
+	COINSPARK_ADDRESS_TYPE_UNKNOWN CoinSparkAddressType = iota
+	COINSPARK_ADDRESS_TYPE_P2PKH
+	COINSPARK_ADDRESS_TYPE_P2SH
+	COINSPARK_ADDRESS_TYPE_P2WPKH
+	COINSPARK_ADDRESS_TYPE_P2WSH
+	COINSPARK_ADDRESS_TYPE_P2TR
+	COINSPARK_ADDRESS_TYPE_WITNESS_UNKNOWN // segwit address with a future witness version
+)
 
 type CoinSparkPaymentRef struct {
 	Ref uint64
@@ -131,6 +143,11 @@ type CoinSparkAddress struct {
 	BitcoinAddress string
 	AddressFlags   CoinSparkAddressFlags
 	PaymentRef     CoinSparkPaymentRef
+	AddressType    CoinSparkAddressType        // type of BitcoinAddress, set by Decode
+	Hash160        [COINSPARK_HASH160_LEN]byte // payload of BitcoinAddress for P2PKH, P2SH and P2WPKH, set by Decode
+	WitnessVersion int                         // for segwit addresses only, set by Decode
+	WitnessProgram []byte                      // for segwit addresses only, set by Decode
+	Network        *CoinSparkNetwork           // network BitcoinAddress must belong to, mainnet if nil
 }
 
 type CoinSparkGenesis struct {
@@ -292,6 +309,11 @@ const (
 	COINSPARK_ADDRESS_FLAG_CHARS_MULTIPLE = 10
 	COINSPARK_ADDRESS_CHAR_INCREMENT      = 13
 
+	COINSPARK_ADDRESS_VERSION_P2PKH         = 0x00
+	COINSPARK_ADDRESS_VERSION_P2SH          = 0x05
+	COINSPARK_ADDRESS_VERSION_TESTNET_P2PKH = 0x6F
+	COINSPARK_ADDRESS_VERSION_TESTNET_P2SH  = 0xC4
+
 	COINSPARK_OUTPUTS_MORE_FLAG     = 0x80
 	COINSPARK_OUTPUTS_RESERVED_MASK = 0x60
 	COINSPARK_OUTPUTS_TYPE_MASK     = 0x18
@@ -448,22 +470,72 @@ func Base58ToInteger(base58Character byte) int {
 }
 
 // Set all fields in address to their default/zero values, which are not necessarily valid.
+// The Network setting is kept.
 func (p *CoinSparkAddress) Clear() {
 	p.BitcoinAddress = ""
 	p.AddressFlags = 0
 	p.PaymentRef = CoinSparkPaymentRef{0}
+	p.AddressType = COINSPARK_ADDRESS_TYPE_UNKNOWN
+	p.Hash160 = [COINSPARK_HASH160_LEN]byte{}
+	p.WitnessVersion = 0
+	p.WitnessProgram = nil
+}
+
+// Returns p.Network, or mainnet if it is nil.
+func (p *CoinSparkAddress) network() *CoinSparkNetwork {
+	if p.Network != nil {
+		return p.Network
+	}
+	return &mainNet
+}
+
+// Decodes the bitcoin address against p.Network.
+func (p *CoinSparkAddress) decodeBitcoinAddress() (success bool, addressType CoinSparkAddressType, hash160 [COINSPARK_HASH160_LEN]byte) {
+	return p.network().DecodeBitcoinAddress(p.BitcoinAddress)
 }
 
 // Returns true if all values in the address are in their permitted ranges, false otherwise.
+// The bitcoin address must be valid on p.Network, either as base58check with a matching
+// checksum and version byte, or as a segwit address with a matching checksum and prefix.
 func (p *CoinSparkAddress) IsValid() bool {
+	return p.Validate() == nil
+}
+
+// As IsValid, but returns the reason the address is not valid, or nil if it is.
+func (p *CoinSparkAddress) Validate() error {
 	if p.BitcoinAddress == "" {
-		return false
+		return ErrBadBitcoinAddress
+	}
+	if isSegwitAddress(p.BitcoinAddress) {
+		if success, _, _ := p.decodeSegwitAddress(); !success {
+			return p.bitcoinAddressError()
+		}
+	} else if success, _, _ := p.decodeBitcoinAddress(); !success {
+		return p.bitcoinAddressError()
 	}
 	if (p.AddressFlags & COINSPARK_ADDRESS_FLAG_MASK) != p.AddressFlags {
-		return false
+		return ErrOutOfRange{"AddressFlags"}
+	}
+	if !p.PaymentRef.IsValid() {
+		return ErrOutOfRange{"PaymentRef"}
 	}
 
-	return p.PaymentRef.IsValid()
+	return nil
+}
+
+// Tells apart a bitcoin address which is valid on another network from one which is not valid at all.
+func (p *CoinSparkAddress) bitcoinAddressError() error {
+	for _, network := range knownNetworks {
+		otherNetwork := CoinSparkAddress{BitcoinAddress: p.BitcoinAddress, Network: network}
+		if isSegwitAddress(p.BitcoinAddress) {
+			if success, _, _ := otherNetwork.decodeSegwitAddress(); success {
+				return ErrWrongNetwork
+			}
+		} else if success, _, _ := otherNetwork.decodeBitcoinAddress(); success {
+			return ErrWrongNetwork
+		}
+	}
+	return ErrBadBitcoinAddress
 }
 
 // Returns true if the two CoinSparkAddress structures are identical.
@@ -477,33 +549,43 @@ func (p *CoinSparkAddress) Match(other *CoinSparkAddress) bool {
 }
 
 // Decodes the CoinSpark address string into the fields in address.
+// Addresses wrapping a segwit address (see bech32.go) are accepted in either case.
+// Set p.Network beforehand to accept addresses from networks other than mainnet.
 // Returns true if the address could be successfully read, otherwise false.
 func (p *CoinSparkAddress) Decode(sparkAddress string) bool {
+	return p.DecodeErr(sparkAddress) == nil
+}
 
+// As Decode, but returns the reason the address could not be read, or nil on success.
+func (p *CoinSparkAddress) DecodeErr(sparkAddress string) error {
 	var bitcoinAddressLen, halfLength int
 	var charIndex, charValue, addressFlagChars, paymentRefChars, extraDataChars int
 	var multiplier uint64
 	var stringBase58 [1024]byte
 	bufBase58 := bytes.Buffer{}
 
+	if isBech32CoinSparkAddress(sparkAddress) {
+		return p.decodeBech32(sparkAddress)
+	}
+
 	input := []byte(sparkAddress)
 	inputLen := len(input)
 
 	//  Check for basic validity
 
 	if (inputLen < 2) || (inputLen > len(stringBase58)) {
-		goto cannotDecodeAddress
+		return ErrBadFormat
 	}
 
 	if input[0] != COINSPARK_ADDRESS_PREFIX {
-		goto cannotDecodeAddress
+		return ErrBadPrefix
 	}
 	//  Convert from base 58
 
 	for charIndex = 1; charIndex < inputLen; charIndex++ { // exclude first character
 		charValue = Base58ToInteger(input[charIndex])
 		if charValue < 0 {
-			goto cannotDecodeAddress
+			return ErrBadBase58Char{charIndex, input[charIndex]}
 		}
 		stringBase58[charIndex] = byte(charValue)
 	}
@@ -523,7 +605,7 @@ func (p *CoinSparkAddress) Decode(sparkAddress string) bool {
 	extraDataChars = addressFlagChars + paymentRefChars
 
 	if inputLen < (2 + extraDataChars) {
-		goto cannotDecodeAddress
+		return ErrBadFormat
 	}
 
 	//  Check we have sufficient length for the decoded address
@@ -568,10 +650,14 @@ func (p *CoinSparkAddress) Decode(sparkAddress string) bool {
 
 	p.BitcoinAddress = bufBase58.String()
 
-	return p.IsValid()
+	if err := p.Validate(); err != nil {
+		return err
+	}
 
-cannotDecodeAddress:
-	return false
+	_, p.AddressType, p.Hash160 = p.decodeBitcoinAddress()
+	p.WitnessVersion = 0
+	p.WitnessProgram = nil
+	return nil
 }
 
 // Encodes the fields in address to a string
@@ -588,6 +674,10 @@ func (p *CoinSparkAddress) Encode() string {
 		goto cannotEncodeAddress
 	}
 
+	if isSegwitAddress(p.BitcoinAddress) {
+		return p.encodeBech32()
+	}
+
 	//  Build up extra data for address flags
 
 	addressFlagChars = 0
@@ -711,6 +801,11 @@ func NewCoinSparkAddress(address string, flags CoinSparkAddressFlags, paymentRef
 	p.BitcoinAddress = address
 	p.AddressFlags = flags
 	p.PaymentRef = paymentRef
+	if isSegwitAddress(address) {
+		p.setSegwitFields()
+	} else {
+		_, p.AddressType, p.Hash160 = p.decodeBitcoinAddress()
+	}
 	return p
 }
 
@@ -762,19 +857,21 @@ func (p *CoinSparkAssetRef) String() string {
 
 // Returns true if all values in the asset reference are in their permitted ranges, false otherwise.
 func (p *CoinSparkAssetRef) IsValid() bool {
+	return p.Validate() == nil
+}
+
+// As IsValid, but returns the first field which is out of range, or nil if all are valid.
+func (p *CoinSparkAssetRef) Validate() error {
 	if p.BlockNum != COINSPARK_TRANSFER_BLOCK_NUM_DEFAULT_ROUTE {
 		if p.BlockNum < 0 || p.BlockNum > COINSPARK_ASSETREF_BLOCK_NUM_MAX {
-			goto assetRefIsInvalid
+			return ErrOutOfRange{"BlockNum"}
 		}
 		if p.TxOffset < 0 || p.TxOffset > COINSPARK_ASSETREF_TX_OFFSET_MAX {
-			goto assetRefIsInvalid
+			return ErrOutOfRange{"TxOffset"}
 		}
 	}
 
-	return true
-
-assetRefIsInvalid:
-	return false
+	return nil
 }
 
 // Returns true if the two CoinSparkAssetRef structures are identical
@@ -803,20 +900,25 @@ cannotEncodeAssetRef:
 // Decodes the CoinSpark asset reference string into assetRef.
 // Returns true if the asset reference could be successfully read, otherwise false.
 func (p *CoinSparkAssetRef) Decode(assetRef string) bool {
+	return p.DecodeErr(assetRef) == nil
+}
+
+// As Decode, but returns the reason the asset reference could not be read, or nil on success.
+func (p *CoinSparkAssetRef) DecodeErr(assetRef string) error {
 	var blockNum, txOffset, txIDPrefixInteger int
 	n, err := fmt.Sscanf(assetRef, "%d-%d-%d", &blockNum, &txOffset, &txIDPrefixInteger)
 	if n != 3 || err != nil {
-		return false
+		return ErrBadFormat
 	}
 
 	if (txIDPrefixInteger < 0) || (txIDPrefixInteger > 0xFFFF) {
-		return false
+		return ErrOutOfRange{"TxIDPrefix"}
 	}
 
 	p.BlockNum = int64(blockNum)
 	p.TxOffset = int64(txOffset)
 	p.TxIDPrefix = [2]byte{byte(txIDPrefixInteger % 256), byte(txIDPrefixInteger / 256)}
-	return p.IsValid()
+	return p.Validate()
 }
 
 func NewCoinSparkAssetRef(blockNum int64, txOffset int64, txIDPrefix []byte) *CoinSparkAssetRef {
@@ -1116,6 +1218,14 @@ func EncodeDomainAndOrPath(domainName string, useHttps bool, pagePath string, us
 	buffer := bytes.Buffer{}
 	skipEmptyPagePath := false
 
+	if !isASCII(domainName) { // Unicode domain names are written in punycode
+		err, asciiName := DomainNameToASCII(domainName)
+		if err != nil {
+			return nil
+		}
+		domainName = asciiName
+	}
+
 	if domainName != "" {
 		theIP := net.ParseIP(domainName)
 		if theIP != nil {
@@ -1359,20 +1469,25 @@ func (p *CoinSparkGenesis) String() string {
 }
 
 func (p *CoinSparkGenesis) IsValid() bool {
+	return p.Validate() == nil
+}
+
+// As IsValid, but returns the first field which is out of range, or nil if all are valid.
+func (p *CoinSparkGenesis) Validate() error {
 	if (p.QtyMantissa < COINSPARK_GENESIS_QTY_MANTISSA_MIN) || (p.QtyMantissa > COINSPARK_GENESIS_QTY_MANTISSA_MAX) {
-		return false
+		return ErrOutOfRange{"QtyMantissa"}
 	}
 
 	if (p.QtyExponent < COINSPARK_GENESIS_QTY_EXPONENT_MIN) || (p.QtyExponent > COINSPARK_GENESIS_QTY_EXPONENT_MAX) {
-		return false
+		return ErrOutOfRange{"QtyExponent"}
 	}
 
 	if (p.ChargeFlatExponent < COINSPARK_GENESIS_CHARGE_FLAT_EXPONENT_MIN) || (p.ChargeFlatExponent > COINSPARK_GENESIS_CHARGE_FLAT_EXPONENT_MAX) {
-		return false
+		return ErrOutOfRange{"ChargeFlatExponent"}
 	}
 
 	if p.ChargeFlatMantissa < COINSPARK_GENESIS_CHARGE_FLAT_MANTISSA_MIN {
-		return false
+		return ErrOutOfRange{"ChargeFlatMantissa"}
 	}
 
 	var tmp int16
@@ -1382,26 +1497,26 @@ func (p *CoinSparkGenesis) IsValid() bool {
 		tmp = COINSPARK_GENESIS_CHARGE_FLAT_MANTISSA_MAX
 	}
 	if p.ChargeFlatMantissa > tmp {
-		return false
+		return ErrOutOfRange{"ChargeFlatMantissa"}
 	}
 
 	if (p.ChargeBasisPoints < COINSPARK_GENESIS_CHARGE_BASIS_POINTS_MIN) || (p.ChargeBasisPoints > COINSPARK_GENESIS_CHARGE_BASIS_POINTS_MAX) {
-		return false
+		return ErrOutOfRange{"ChargeBasisPoints"}
 	}
 
-	if len(p.DomainName) > COINSPARK_GENESIS_DOMAIN_NAME_MAX_LEN {
-		return false
+	if len(domainNameASCIIOrSame(p.DomainName)) > COINSPARK_GENESIS_DOMAIN_NAME_MAX_LEN {
+		return ErrOutOfRange{"DomainName"}
 	}
 
 	if len(p.PagePath) > COINSPARK_GENESIS_PAGE_PATH_MAX_LEN {
-		return false
+		return ErrOutOfRange{"PagePath"}
 	}
 
 	if (p.AssetHashLen < COINSPARK_GENESIS_HASH_MIN_LEN) || (p.AssetHashLen > COINSPARK_GENESIS_HASH_MAX_LEN) {
-		return false
+		return ErrOutOfRange{"AssetHashLen"}
 	}
 
-	return true
+	return nil
 }
 
 func (p *CoinSparkGenesis) Match(other *CoinSparkGenesis, strict bool) bool {
@@ -1479,7 +1594,7 @@ func (p *CoinSparkGenesis) CalcAssetURL(firstSpentTxID string, firstSpentVout in
 		suffix = buffer[startPos : startPos+16] // slice works on ASCII string which we expect
 	}
 
-	s := fmt.Sprintf("%s://%s/%s%s/", protocol, p.DomainName, prefix, suffix)
+	s := fmt.Sprintf("%s://%s/%s%s/", protocol, domainNameASCIIOrSame(p.DomainName), prefix, suffix)
 	return s
 }
 
@@ -1510,7 +1625,7 @@ func (p *CoinSparkGenesis) CalcHashLen(metadataMaxLen int) int {
 		assetHashLen -= 5 // packing and IP octets
 	} else {
 		assetHashLen -= 1 // packing
-		shortDomainName, _ := ShrinkLowerDomainName(p.DomainName)
+		shortDomainName, _ := ShrinkLowerDomainName(domainNameASCIIOrSame(p.DomainName))
 		domainPathLen += len(shortDomainName) + 1
 	}
 
@@ -1545,18 +1660,30 @@ func (p *CoinSparkGenesis) CalcGross(qtyNet CoinSparkAssetQty) CoinSparkAssetQty
 	return result
 }
 
+// Decodes genesis metadata from buffer, which may contain other metadata as well.
+// Returns true if the genesis could be successfully read and is valid, otherwise false.
 func (p *CoinSparkGenesis) Decode(buffer []byte) bool {
-	metadata := LocateMetadataRange(buffer, COINSPARK_GENESIS_PREFIX)
-	if metadata == nil {
-		return false
+	return p.DecodeErr(buffer) == nil
+}
+
+// As Decode, but returns the reason the genesis could not be read, or nil on success.
+func (p *CoinSparkGenesis) DecodeErr(buffer []byte) error {
+	err, metadata := locateMetadataRange(buffer, COINSPARK_GENESIS_PREFIX)
+	if err != nil {
+		return err
 	}
+	startLength := len(metadata)
 
 	// Quantity mantissa and exponent
 
+	if len(metadata) < COINSPARK_GENESIS_QTY_FLAGS_LENGTH {
+		return ErrTruncated{"genesis quantity", 0}
+	}
+
 	quantityEncoded := int(binary.LittleEndian.Uint16([]byte(metadata[:COINSPARK_GENESIS_QTY_FLAGS_LENGTH])))
 	metadata = metadata[COINSPARK_GENESIS_QTY_FLAGS_LENGTH:]
 	if quantityEncoded == 0 {
-		return false
+		return ErrOutOfRange{"QtyMantissa"}
 	}
 
 	p.QtyMantissa = int16((quantityEncoded & COINSPARK_GENESIS_QTY_MASK) % COINSPARK_GENESIS_QTY_EXPONENT_MULTIPLE)
@@ -1565,6 +1692,10 @@ func (p *CoinSparkGenesis) Decode(buffer []byte) bool {
 	// Charges - flat and basis points
 
 	if quantityEncoded&COINSPARK_GENESIS_FLAG_CHARGE_FLAT > 0 {
+		if len(metadata) < COINSPARK_GENESIS_CHARGE_FLAT_LENGTH {
+			return ErrTruncated{"genesis flat charge", startLength - len(metadata)}
+		}
+
 		chargeEncoded := int(metadata[0])
 		metadata = metadata[COINSPARK_GENESIS_CHARGE_FLAT_LENGTH:]
 
@@ -1576,6 +1707,10 @@ func (p *CoinSparkGenesis) Decode(buffer []byte) bool {
 	}
 
 	if quantityEncoded&COINSPARK_GENESIS_FLAG_CHARGE_BPS > 0 {
+		if len(metadata) < COINSPARK_GENESIS_CHARGE_BPS_LENGTH {
+			return ErrTruncated{"genesis basis points charge", startLength - len(metadata)}
+		}
+
 		p.ChargeBasisPoints = int16(metadata[0])
 		metadata = metadata[COINSPARK_GENESIS_CHARGE_BPS_LENGTH:]
 	} else {
@@ -1584,9 +1719,9 @@ func (p *CoinSparkGenesis) Decode(buffer []byte) bool {
 
 	//  Domain name and page path
 
-	valid, result := DecodeDomainAndOrPath(string(metadata), true, true, false)
-	if !valid {
-		return false
+	err, result := decodeDomainAndOrPath(string(metadata), true, true, false)
+	if err != nil {
+		return offsetError(err, startLength-len(metadata))
 	}
 
 	metadata = metadata[result.decodedChars:]
@@ -1597,19 +1732,26 @@ func (p *CoinSparkGenesis) Decode(buffer []byte) bool {
 
 	// Asset hash
 
+	if len(metadata) < COINSPARK_GENESIS_HASH_MIN_LEN {
+		return ErrTruncated{"genesis asset hash", startLength - len(metadata)}
+	}
+
 	p.AssetHashLen = COINSPARK_MIN(len(metadata), COINSPARK_GENESIS_HASH_MAX_LEN)
-	p.AssetHash = metadata[:p.AssetHashLen]
+	p.AssetHash = append([]byte(nil), metadata[:p.AssetHashLen]...) // copy so as not to alias the caller's buffer
 
 	// Return validity
 
-	return p.IsValid()
+	return p.Validate()
 }
 
 func (p *CoinSparkGenesis) Encode(metadataMaxLen int) (err error, metadata []byte) {
 	metadata = nil
 
-	if !p.IsValid() {
-		return errors.New("invalid genesis"), metadata
+	if err := p.Validate(); err != nil {
+		return err, metadata
+	}
+	if err := validateDomainName("DomainName", p.DomainName, COINSPARK_GENESIS_DOMAIN_NAME_MAX_LEN); err != nil {
+		return err, metadata
 	}
 
 	buf := new(bytes.Buffer)
@@ -1678,6 +1820,11 @@ type result_DecodeDomainAndOrPath struct {
 }
 
 func DecodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool, forMessages bool) (bool, result_DecodeDomainAndOrPath) {
+	err, result := decodeDomainAndOrPath(metadata, doDomainName, doPagePath, forMessages)
+	return err == nil, result
+}
+
+func decodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool, forMessages bool) (error, result_DecodeDomainAndOrPath) {
 	startLength := len(metadata)
 	metadataParts := 0
 	result := result_DecodeDomainAndOrPath{}
@@ -1689,7 +1836,7 @@ func DecodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool,
 
 		// Get packing byte
 		if len(metadata) < 1 {
-			return false, result
+			return ErrTruncated{"domain name packing", 0}, result
 		}
 
 		packingChar := metadata[0]
@@ -1706,7 +1853,7 @@ func DecodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool,
 		if isIpAddress {
 			result.useHttps = (packing & COINSPARK_DOMAIN_PACKING_IPv4_HTTPS) > 0
 			if len(metadata) <= 4 {
-				return false, result
+				return ErrTruncated{"IP address", startLength - len(metadata)}, result
 			}
 
 			octetChars := metadata[:4]
@@ -1731,9 +1878,9 @@ func DecodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool,
 	}
 
 	if metadataParts > 0 {
-		decodeString, decodedCharsPos := DecodeDomainPathTriplets(metadata, metadataParts)
-		if decodeString == "" {
-			return false, result
+		err, decodeString, decodedCharsPos := decodeDomainPathTriplets(metadata, metadataParts)
+		if err != nil {
+			return offsetError(err, startLength-len(metadata)), result
 		}
 
 		metadata = metadata[decodedCharsPos:]
@@ -1743,11 +1890,11 @@ func DecodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool,
 			replacedDecodeString := strings.Replace(decodeString, string(COINSPARK_DOMAIN_PATH_FALSE_END_CHAR), string(COINSPARK_DOMAIN_PATH_TRUE_END_CHAR), -1)
 			endCharPos := strings.IndexRune(replacedDecodeString, COINSPARK_DOMAIN_PATH_TRUE_END_CHAR)
 			if endCharPos < 0 {
-				return false, result // should never happen
+				return ErrBadDomainPath, result // should never happen
 			}
 			result.domainName = ExpandDomainName(decodeString[0:endCharPos], packing)
 			if result.domainName == "" {
-				return false, result
+				return ErrBadDomainPath, result
 			}
 			result.useHttps = decodeString[endCharPos] == COINSPARK_DOMAIN_PATH_TRUE_END_CHAR
 			decodeString = decodeString[endCharPos+1:]
@@ -1760,7 +1907,7 @@ func DecodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool,
 			endCharPos := strings.IndexRune(replacedDecodeString, COINSPARK_DOMAIN_PATH_TRUE_END_CHAR)
 
 			if endCharPos < 0 {
-				return false, result // should never happen
+				return ErrBadDomainPath, result // should never happen
 			}
 
 			result.usePrefix = (decodeString[endCharPos] == COINSPARK_DOMAIN_PATH_TRUE_END_CHAR)
@@ -1771,10 +1918,18 @@ func DecodeDomainAndOrPath(metadata string, doDomainName bool, doPagePath bool,
 	// Finish and return
 	result.decodedChars = startLength - len(metadata)
 
-	return true, result
+	return nil, result
 }
 
 func DecodeDomainPathTriplets(metadata string, parts int) (result string, numDecodedChars int) {
+	err, result, numDecodedChars := decodeDomainPathTriplets(metadata, parts)
+	if err != nil {
+		return "", 0
+	}
+	return result, numDecodedChars
+}
+
+func decodeDomainPathTriplets(metadata string, parts int) (err error, result string, numDecodedChars int) {
 	startLength := len(metadata)
 	result = ""
 	stringPos := 0
@@ -1783,14 +1938,14 @@ func DecodeDomainPathTriplets(metadata string, parts int) (result string, numDec
 
 		if (stringPos % 3) == 0 {
 			if len(metadata) < 2 {
-				return "", 0
+				return ErrTruncated{"domain name and path", startLength - len(metadata)}, "", 0
 			}
 
 			stringTriplet = int(binary.LittleEndian.Uint16([]byte(metadata[:2])))
 			metadata = metadata[2:]
 
 			if stringTriplet >= (COINSPARK_DOMAIN_PATH_ENCODE_BASE * COINSPARK_DOMAIN_PATH_ENCODE_BASE * COINSPARK_DOMAIN_PATH_ENCODE_BASE) {
-				return "", 0 //invalid value
+				return ErrBadDomainPath, "", 0 //invalid value
 			}
 		}
 
@@ -1816,7 +1971,7 @@ func DecodeDomainPathTriplets(metadata string, parts int) (result string, numDec
 		}
 	}
 
-	return result, startLength - len(metadata)
+	return nil, result, startLength - len(metadata)
 }
 
 func ExpandDomainName(domainName string, packing int) string {
@@ -1859,16 +2014,24 @@ func GetMinFeeBasis(outputsSatoshis []CoinSparkSatoshiQty, outputsRegular []bool
 }
 
 func LocateMetadataRange(metadata []byte, desiredPrefix byte) []byte {
+	_, metadataRange := locateMetadataRange(metadata, desiredPrefix)
+	if metadataRange == nil {
+		return nil
+	}
+	return append([]byte{}, metadataRange...) // a copy, so the caller's metadata cannot be changed through it
+}
+
+func locateMetadataRange(metadata []byte, desiredPrefix byte) (error, []byte) {
 	metadataLen := len(metadata)
 
 	if metadataLen < (COINSPARK_METADATA_IDENTIFIER_LEN + 1) {
 		// check for 4 bytes at least
-		return nil
+		return ErrNoMetadata, nil
 	}
 
 	if string(metadata[0:COINSPARK_METADATA_IDENTIFIER_LEN]) != COINSPARK_METADATA_IDENTIFIER {
 		// check it starts 'SPK'
-		return nil
+		return ErrBadPrefix, nil
 	}
 
 	position := COINSPARK_METADATA_IDENTIFIER_LEN // start after 'SPK'
@@ -1882,34 +2045,34 @@ func LocateMetadataRange(metadata []byte, desiredPrefix byte) []byte {
 		if (desiredPrefix != 0 && foundPrefix == desiredPrefix) ||
 			(desiredPrefix == COINSPARK_DUMMY_PREFIX && foundPrefixOrd > COINSPARK_LENGTH_PREFIX_MAX) {
 			// it's our data from here to the end (if desiredPrefix is None, it matches the last one whichever it is)
-			return metadata[position:]
+			return nil, metadata[position:]
 		}
 
 		if foundPrefixOrd > COINSPARK_LENGTH_PREFIX_MAX {
 			// it's some other type of data from here to end
-			return nil
+			return ErrNoMetadata, nil
 		}
 
 		// if we get here it means we found a length byte
 
 		if position+foundPrefixOrd > metadataLen {
 			// something went wrong - length indicated is longer than that available
-			return nil
+			return ErrTruncated{"metadata", position}, nil
 		}
 
 		if position >= metadataLen {
 			// something went wrong - that was the end of the input data
-			return nil
+			return ErrTruncated{"metadata", position}, nil
 		}
 
 		if metadata[position] == desiredPrefix {
 			// it's the length of our part
-			return metadata[position+1 : position+foundPrefixOrd]
+			return nil, metadata[position+1 : position+foundPrefixOrd]
 		} else {
 			position += foundPrefixOrd // skip over this many bytes
 		}
 	}
-	return nil
+	return ErrNoMetadata, nil
 }
 
 func (p *CoinSparkPaymentRef) Clear() *CoinSparkPaymentRef {
@@ -1927,21 +2090,36 @@ func (p *CoinSparkPaymentRef) String() string {
 }
 
 func (p *CoinSparkPaymentRef) IsValid() bool {
-	return p.Ref >= 0 && p.Ref <= COINSPARK_PAYMENT_REF_MAX
+	return p.Validate() == nil
+}
+
+// As IsValid, but returns an error saying why the payment reference is not valid, or nil if it is.
+func (p *CoinSparkPaymentRef) Validate() error {
+	if p.Ref < 0 || p.Ref > COINSPARK_PAYMENT_REF_MAX {
+		return ErrOutOfRange{"Ref"}
+	}
+	return nil
 }
 
 func (p *CoinSparkPaymentRef) Match(other *CoinSparkPaymentRef) bool {
 	return p.Ref == other.Ref
 }
 
+// Sets a random payment reference from crypto/rand, which is safe for concurrent use.
 func (p *CoinSparkPaymentRef) Randomize() {
-	rand.Seed(time.Now().UnixNano())
-	p.Ref = uint64(rand.Int63n(COINSPARK_PAYMENT_REF_MAX))
+	p.Ref = randomPaymentRef()
 }
 
 func NewRandomCoinSparkPaymentRef() *CoinSparkPaymentRef {
-	rand.Seed(time.Now().UnixNano())
-	return &CoinSparkPaymentRef{uint64(rand.Int63n(COINSPARK_PAYMENT_REF_MAX))}
+	return &CoinSparkPaymentRef{randomPaymentRef()}
+}
+
+func randomPaymentRef() uint64 {
+	ref, err := rand.Int(rand.Reader, big.NewInt(COINSPARK_PAYMENT_REF_MAX+1))
+	if err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return ref.Uint64()
 }
 
 func (p *CoinSparkPaymentRef) Encode(metadataMaxLen int) []byte {
@@ -1977,24 +2155,31 @@ func (p *CoinSparkPaymentRef) Encode(metadataMaxLen int) []byte {
 
 }
 
+// Decodes payment reference metadata from buffer, which may contain other metadata as well.
+// Returns true if the payment reference could be successfully read and is valid, otherwise false.
 func (p *CoinSparkPaymentRef) Decode(buffer []byte) bool {
-	metadata := LocateMetadataRange(buffer, COINSPARK_PAYMENTREF_PREFIX)
-	if metadata == nil {
-		return false
+	return p.DecodeErr(buffer) == nil
+}
+
+// As Decode, but returns the reason the payment reference could not be read, or nil on success.
+func (p *CoinSparkPaymentRef) DecodeErr(buffer []byte) error {
+	err, metadata := locateMetadataRange(buffer, COINSPARK_PAYMENTREF_PREFIX)
+	if err != nil {
+		return err
 	}
 
 	// The payment reference
 
 	finalMetadataLen := len(metadata)
 	if finalMetadataLen > 8 {
-		return false
+		return ErrOutOfRange{"Ref"}
 	}
 
 	_, v := ShiftLittleEndianBytesToInt(&metadata, finalMetadataLen)
 	p.Ref = uint64(v)
 
 	// Return validity
-	return p.IsValid()
+	return p.Validate()
 }
 
 func (p *CoinSparkIORange) Clear() {
@@ -2030,13 +2215,24 @@ func (p *CoinSparkTransfer) Clear() {
 }
 
 func (p *CoinSparkTransfer) IsValid() bool {
-	if !(p.AssetRef.IsValid() && p.Inputs.IsValid() && p.Outputs.IsValid()) {
-		return false
+	return p.Validate() == nil
+}
+
+// As IsValid, but returns the first field which is out of range, or nil if all are valid.
+func (p *CoinSparkTransfer) Validate() error {
+	if err := p.AssetRef.Validate(); err != nil {
+		return err
+	}
+	if !p.Inputs.IsValid() {
+		return ErrOutOfRange{"Inputs"}
+	}
+	if !p.Outputs.IsValid() {
+		return ErrOutOfRange{"Outputs"}
 	}
 	if p.QtyPerOutput < 0 || p.QtyPerOutput > COINSPARK_ASSET_QTY_MAX {
-		return false
+		return ErrOutOfRange{"QtyPerOutput"}
 	}
-	return true
+	return nil
 }
 
 func (p *CoinSparkTransfer) Match(other *CoinSparkTransfer) bool {
@@ -2094,11 +2290,25 @@ func PackingTypeToValues(packingType string, previousRange *CoinSparkIORange, co
 	return r
 }
 
+// Decodes a single transfer from the start of metadata, which follows previousTransfer (nil for the first).
+// Returns the number of bytes used, or 0 if the transfer could not be read or is invalid.
 func (p *CoinSparkTransfer) Decode(metadata []byte, previousTransfer *CoinSparkTransfer, countInputs int, countOutputs int) int {
+	err, bytesUsed := p.DecodeErr(metadata, previousTransfer, countInputs, countOutputs)
+	if err != nil {
+		return 0
+	}
+	return bytesUsed
+}
+
+// As Decode, but also returns the reason the transfer could not be read, or nil on success.
+func (p *CoinSparkTransfer) DecodeErr(metadata []byte, previousTransfer *CoinSparkTransfer, countInputs int, countOutputs int) (err error, bytesUsed int) {
 
 	startLength := len(metadata)
 
 	// Extract packing
+	if len(metadata) < 1 {
+		return ErrTruncated{"transfer packing", 0}, 0
+	}
 	packing := int(metadata[0])
 
 	metadata = metadata[1:]
@@ -2125,19 +2335,22 @@ func (p *CoinSparkTransfer) Decode(metadata []byte, previousTransfer *CoinSparkT
 
 	if (packing & COINSPARK_PACKING_INDICES_MASK) == COINSPARK_PACKING_INDICES_EXTEND {
 		// we're using second packing metadata byte
+		if len(metadata) < 1 {
+			return ErrTruncated{"transfer packing extension", startLength - len(metadata)}, 0
+		}
 		packingExtend = int(metadata[0])
 		metadata = metadata[1:]
 		if packingExtend == 0 {
-			return 0
+			return ErrBadPacking, 0
 		}
 
 		success, inputPackingType = DecodePackingExtend(byte((packingExtend>>COINSPARK_PACKING_EXTEND_INPUTS_SHIFT)&COINSPARK_PACKING_EXTEND_MASK), false)
 		if success == false {
-			return 0
+			return ErrBadPacking, 0
 		}
 		success, outputPackingType = DecodePackingExtend(byte((packingExtend>>COINSPARK_PACKING_EXTEND_OUTPUTS_SHIFT)&COINSPARK_PACKING_EXTEND_MASK), false)
 		if success == false {
-			return 0
+			return ErrBadPacking, 0
 		}
 	} else {
 		// not using second packing metadata byte
@@ -2194,14 +2407,14 @@ func (p *CoinSparkTransfer) Decode(metadata []byte, previousTransfer *CoinSparkT
 	var result int
 	success, result = ShiftLittleEndianBytesToInt(&metadataArray, counts.blockNumBytes)
 	if !success {
-		return 0
+		return ErrTruncated{"transfer block number", startLength - len(metadataArray)}, 0
 	} else if counts.blockNumBytes > 0 {
 		p.AssetRef.BlockNum = int64(result)
 	}
 
 	success, result = ShiftLittleEndianBytesToInt(&metadataArray, counts.txOffsetBytes)
 	if !success {
-		return 0
+		return ErrTruncated{"transfer txn offset", startLength - len(metadataArray)}, 0
 	} else if counts.txOffsetBytes > 0 {
 		p.AssetRef.TxOffset = int64(result)
 	}
@@ -2209,7 +2422,7 @@ func (p *CoinSparkTransfer) Decode(metadata []byte, previousTransfer *CoinSparkT
 	txIDPrefixBytes := counts.txIDPrefixBytes
 	if txIDPrefixBytes > 0 {
 		if len(metadataArray) < txIDPrefixBytes {
-			return 0
+			return ErrTruncated{"transfer txid prefix", startLength - len(metadataArray)}, 0
 		}
 		var prefix [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte
 		copy(prefix[:], metadataArray[:txIDPrefixBytes])
@@ -2218,35 +2431,35 @@ func (p *CoinSparkTransfer) Decode(metadata []byte, previousTransfer *CoinSparkT
 	}
 	success, result = ShiftLittleEndianBytesToInt(&metadataArray, counts.firstInputBytes)
 	if !success {
-		return 0
+		return ErrTruncated{"transfer first input", startLength - len(metadataArray)}, 0
 	} else if counts.firstInputBytes > 0 {
 		p.Inputs.First = CoinSparkIOIndex(result)
 	}
 
 	success, result = ShiftLittleEndianBytesToInt(&metadataArray, counts.countInputsBytes)
 	if !success {
-		return 0
+		return ErrTruncated{"transfer input count", startLength - len(metadataArray)}, 0
 	} else if counts.countInputsBytes > 0 {
 		p.Inputs.Count = CoinSparkIOIndex(result)
 	}
 
 	success, result = ShiftLittleEndianBytesToInt(&metadataArray, counts.firstOutputBytes)
 	if !success {
-		return 0
+		return ErrTruncated{"transfer first output", startLength - len(metadataArray)}, 0
 	} else if counts.firstOutputBytes > 0 {
 		p.Outputs.First = CoinSparkIOIndex(result)
 	}
 
 	success, result = ShiftLittleEndianBytesToInt(&metadataArray, counts.countOutputsBytes)
 	if !success {
-		return 0
+		return ErrTruncated{"transfer output count", startLength - len(metadataArray)}, 0
 	} else if counts.countOutputsBytes > 0 {
 		p.Outputs.Count = CoinSparkIOIndex(result)
 	}
 
 	success, result = ShiftLittleEndianBytesToInt(&metadataArray, counts.quantityBytes)
 	if !success {
-		return 0
+		return ErrTruncated{"transfer quantity", startLength - len(metadataArray)}, 0
 	} else if counts.quantityBytes > 0 {
 		p.QtyPerOutput = CoinSparkAssetQty(result)
 	}
@@ -2273,11 +2486,11 @@ func (p *CoinSparkTransfer) Decode(metadata []byte, previousTransfer *CoinSparkT
 
 	// Return bytes used
 
-	if p.IsValid() == false {
-		return 0
+	if err := p.Validate(); err != nil {
+		return err, 0
 	}
 
-	return startLength - len(metadata)
+	return nil, startLength - len(metadata)
 }
 
 func (p *CoinSparkTransfer) Encode(previousTransfer *CoinSparkTransfer, metadataMaxLen int, countInputs int, countOutputs int) []byte {
@@ -2780,7 +2993,12 @@ func (p *CoinSparkTransferList) ApplyNone(inputBalances []CoinSparkAssetQty, out
 }
 
 func (p *CoinSparkTransferList) Apply(assetRef *CoinSparkAssetRef, genesis *CoinSparkGenesis, inputBalances []CoinSparkAssetQty, outputsRegular []bool) []CoinSparkAssetQty {
-	// copy since we will modify it, and cast to integers
+	return p.apply(assetRef, genesis, inputBalances, outputsRegular, nil)
+}
+
+// Performs Apply, recording each movement in trace if it is not nil.
+func (p *CoinSparkTransferList) apply(assetRef *CoinSparkAssetRef, genesis *CoinSparkGenesis, inputBalances []CoinSparkAssetQty, outputsRegular []bool, trace *CoinSparkTransferTrace) []CoinSparkAssetQty {
+	// copy since we will modify it, leaving the caller's balances untouched
 	localInputBalances := make([]CoinSparkAssetQty, len(inputBalances))
 	copy(localInputBalances, inputBalances)
 
@@ -2789,7 +3007,7 @@ func (p *CoinSparkTransferList) Apply(assetRef *CoinSparkAssetRef, genesis *Coin
 	outputBalances := make([]CoinSparkAssetQty, countOutputs)
 
 	// Perform explicit transfers (i.e. not default routes)
-	for _, transfer := range p.Transfers {
+	for transferIndex, transfer := range p.Transfers {
 		if assetRef.Match(&transfer.AssetRef) {
 			inputIndex := COINSPARK_MAX(int(transfer.Inputs.First), 0)
 			outputIndex := COINSPARK_MAX(int(transfer.Outputs.First), 0)
@@ -2799,12 +3017,13 @@ func (p *CoinSparkTransferList) Apply(assetRef *CoinSparkAssetRef, genesis *Coin
 				if outputsRegular[outputIndex] == true {
 					transferRemaining := transfer.QtyPerOutput
 					for inputIndex <= lastInputIndex {
-						transferQuantity := COINSPARK_MINASSETQTY(transferRemaining, inputBalances[inputIndex])
+						transferQuantity := COINSPARK_MINASSETQTY(transferRemaining, localInputBalances[inputIndex])
 						if transferQuantity > 0 {
 							//  skip all this if nothing is to be transferred (branch not really necessary)
-							inputBalances[inputIndex] -= transferQuantity
+							localInputBalances[inputIndex] -= transferQuantity
 							transferRemaining -= transferQuantity
 							outputBalances[outputIndex] += transferQuantity
+							trace.add(CoinSparkTransferStep{COINSPARK_STEP_TRANSFER, transferIndex, inputIndex, outputIndex, transferQuantity, 0})
 						}
 
 						if transferRemaining > 0 {
@@ -2825,22 +3044,37 @@ func (p *CoinSparkTransferList) Apply(assetRef *CoinSparkAssetRef, genesis *Coin
 
 	for outputIndex := 0; outputIndex < countOutputs; outputIndex++ {
 		if outputsRegular[outputIndex] == true {
-			outputBalances[outputIndex] = genesis.CalcNet(outputBalances[outputIndex])
+			qtyGross := outputBalances[outputIndex]
+			outputBalances[outputIndex] = genesis.CalcNet(qtyGross)
+			if qtyGross > outputBalances[outputIndex] {
+				trace.add(CoinSparkTransferStep{COINSPARK_STEP_CHARGE, -1, -1, outputIndex, outputBalances[outputIndex], qtyGross - outputBalances[outputIndex]})
+			}
 		}
 	}
 
 	// Send remaining quantities to default outputs
 
-	inputDefaultOutput := p.GetDefaultRouteMap(countInputs, outputsRegular)
+	inputDefaultOutput, inputDefaultTransfer := p.getDefaultRoutes(countInputs, outputsRegular)
 	for inputIndex := 0; inputIndex < len(inputDefaultOutput); inputIndex++ {
 		outputIndex := inputDefaultOutput[inputIndex]
 		if outputIndex != -1 {
-			outputBalances[outputIndex] += inputBalances[inputIndex]
+			outputBalances[outputIndex] += localInputBalances[inputIndex]
+		}
+		if localInputBalances[inputIndex] > 0 {
+			kind := COINSPARK_STEP_DEFAULT_ROUTE
+			if inputDefaultTransfer[inputIndex] == -1 {
+				kind = COINSPARK_STEP_LAST_REGULAR
+			}
+			if outputIndex == -1 {
+				kind = COINSPARK_STEP_LOST
+			}
+			trace.add(CoinSparkTransferStep{kind, inputDefaultTransfer[inputIndex], inputIndex, outputIndex, localInputBalances[inputIndex], 0})
 		}
 	}
 
 	// Return the result
 
+	trace.setOutputBalances(outputBalances)
 	return outputBalances
 }
 
@@ -2859,13 +3093,22 @@ func (p *CoinSparkTransferList) DefaultOutputs(countInputs int, outputsRegular [
 }
 
 func (p *CoinSparkTransferList) GetDefaultRouteMap(countInputs int, outputsRegular []bool) []int {
+	inputDefaultOutput, _ := p.getDefaultRoutes(countInputs, outputsRegular)
+	return inputDefaultOutput
+}
+
+// As GetDefaultRouteMap, but also returns the index of the default route transfer which sets the
+// output of each input, or -1 if it is the last regular output.
+func (p *CoinSparkTransferList) getDefaultRoutes(countInputs int, outputsRegular []bool) (inputDefaultOutput []int, inputDefaultTransfer []int) {
 	countOutputs := len(outputsRegular)
 
 	// Default to last output for all inputs
 	lastRegularOutput := GetLastRegularOutput(outputsRegular)
-	inputDefaultOutput := make([]int, countInputs)
+	inputDefaultOutput = make([]int, countInputs)
+	inputDefaultTransfer = make([]int, countInputs)
 	for i := 0; i < countInputs; i++ {
 		inputDefaultOutput[i] = lastRegularOutput
+		inputDefaultTransfer[i] = -1
 	}
 
 	// Apply any default route transfers in reverse order (since early ones take precedence)
@@ -2879,6 +3122,7 @@ func (p *CoinSparkTransferList) GetDefaultRouteMap(countInputs int, outputsRegul
 
 				for inputIndex <= lastInputIndex {
 					inputDefaultOutput[inputIndex] = outputIndex
+					inputDefaultTransfer[inputIndex] = i
 					inputIndex += 1
 				}
 			}
@@ -2887,14 +3131,27 @@ func (p *CoinSparkTransferList) GetDefaultRouteMap(countInputs int, outputsRegul
 
 	// Return the result
 
-	return inputDefaultOutput
+	return inputDefaultOutput, inputDefaultTransfer
 }
 
+// Decodes the list of transfers from metadata, which may contain other metadata as well.
+// Returns the number of transfers read, or 0 if the list could not be read or is invalid.
 func (p *CoinSparkTransferList) Decode(metadataIn []byte, countInputs int, countOutputs int) int {
-	metadata := LocateMetadataRange(metadataIn, COINSPARK_TRANSFERS_PREFIX)
-	if metadata == nil {
+	err, countTransfers := p.DecodeErr(metadataIn, countInputs, countOutputs)
+	if err != nil {
 		return 0
 	}
+	return countTransfers
+}
+
+// As Decode, but also returns the reason the list could not be read, or nil on success.
+// An empty list is not an error.
+func (p *CoinSparkTransferList) DecodeErr(metadataIn []byte, countInputs int, countOutputs int) (err error, countTransfers int) {
+	err, metadata := locateMetadataRange(metadataIn, COINSPARK_TRANSFERS_PREFIX)
+	if err != nil {
+		return err, 0
+	}
+	startLength := len(metadata)
 
 	// Iterate over list
 
@@ -2904,18 +3161,18 @@ func (p *CoinSparkTransferList) Decode(metadataIn []byte, countInputs int, count
 
 	for len(metadata) > 0 {
 		transfer := *new(CoinSparkTransfer)
-		transferBytesUsed := transfer.Decode(metadata, previousTransfer, countInputs, countOutputs)
+		err, transferBytesUsed := transfer.DecodeErr(metadata, previousTransfer, countInputs, countOutputs)
 
-		if transferBytesUsed > 0 {
-			p.Transfers = append(p.Transfers, transfer)
-			metadata = metadata[transferBytesUsed:]
-			previousTransfer = &transfer
-		} else {
-			return 0 // something was invalid
+		if err != nil {
+			return offsetError(err, startLength-len(metadata)), 0 // something was invalid
 		}
+
+		p.Transfers = append(p.Transfers, transfer)
+		metadata = metadata[transferBytesUsed:]
+		previousTransfer = &transfer
 	}
 	// Return count
-	return len(p.Transfers)
+	return nil, len(p.Transfers)
 }
 
 func (p *CoinSparkTransferList) Encode(countInputs int, countOutputs int, metadataMaxLen int) []byte {
@@ -2988,39 +3245,44 @@ func (p *CoinSparkMessage) String() string {
 }
 
 func (p *CoinSparkMessage) IsValid() bool {
-	if len(p.ServerHost) > COINSPARK_MESSAGE_SERVER_HOST_MAX_LEN {
-		return false
+	return p.Validate() == nil
+}
+
+// As IsValid, but returns the first field which is out of range, or nil if all are valid.
+func (p *CoinSparkMessage) Validate() error {
+	if len(domainNameASCIIOrSame(p.ServerHost)) > COINSPARK_MESSAGE_SERVER_HOST_MAX_LEN {
+		return ErrOutOfRange{"ServerHost"}
 	}
 
 	if len(p.ServerPath) > COINSPARK_MESSAGE_SERVER_PATH_MAX_LEN {
-		return false
+		return ErrOutOfRange{"ServerPath"}
 	}
 
 	if len(p.Hash) < p.HashLen {
 		// check we have at least as much data as specified by self.hashLen
-		return false
+		return ErrOutOfRange{"HashLen"}
 	}
 
 	if p.HashLen < COINSPARK_MESSAGE_HASH_MIN_LEN || p.HashLen > COINSPARK_MESSAGE_HASH_MAX_LEN {
-		return false
+		return ErrOutOfRange{"HashLen"}
 	}
 
 	if !p.IsPublic && len(p.OutputRanges) == 0 {
 		// public or aimed at some outputs at least
-		return false
+		return ErrOutOfRange{"OutputRanges"}
 	}
 
 	if len(p.OutputRanges) > COINSPARK_MESSAGE_MAX_IO_RANGES {
-		return false
+		return ErrTooManyRanges
 	}
 
 	for _, outputRange := range p.OutputRanges {
 		if !outputRange.IsValid() {
-			return false
+			return ErrOutOfRange{"OutputRanges"}
 		}
 	}
 
-	return true
+	return nil
 
 }
 
@@ -3057,7 +3319,7 @@ func (p *CoinSparkMessage) Match(other *CoinSparkMessage, strict bool) bool {
 }
 
 func (p *CoinSparkMessage) Encode(countOutputs int, metadataMaxLen int) []byte {
-	if !p.IsValid() {
+	if !p.IsValid() || validateDomainName("ServerHost", p.ServerHost, COINSPARK_MESSAGE_SERVER_HOST_MAX_LEN) != nil {
 		return nil
 	}
 
@@ -3128,16 +3390,24 @@ func (p *CoinSparkMessage) Encode(countOutputs int, metadataMaxLen int) []byte {
 	return buf.Bytes()
 }
 
+// Decodes message metadata from buffer, which may contain other metadata as well.
+// Returns true if the message could be successfully read and is valid, otherwise false.
 func (p *CoinSparkMessage) Decode(buffer []byte, countOutputs int) bool {
-	metadata := LocateMetadataRange(buffer, COINSPARK_MESSAGE_PREFIX)
-	if metadata == nil {
-		return false
+	return p.DecodeErr(buffer, countOutputs) == nil
+}
+
+// As Decode, but returns the reason the message could not be read, or nil on success.
+func (p *CoinSparkMessage) DecodeErr(buffer []byte, countOutputs int) error {
+	err, metadata := locateMetadataRange(buffer, COINSPARK_MESSAGE_PREFIX)
+	if err != nil {
+		return err
 	}
+	startLength := len(metadata)
 
 	// Server host and path
-	success, decoded := DecodeDomainAndOrPath(string(metadata), true, true, true)
-	if !success {
-		return false
+	err, decoded := decodeDomainAndOrPath(string(metadata), true, true, true)
+	if err != nil {
+		return offsetError(err, startLength-len(metadata))
 	}
 
 	metadata = metadata[decoded.decodedChars:]
@@ -3158,11 +3428,11 @@ func (p *CoinSparkMessage) Decode(buffer []byte, countOutputs int) bool {
 		success, packing := ShiftLittleEndianBytesToInt(&metadata, 1)
 		//Read the next packing byte and check reserved bits are zero
 		if success == false {
-			return false
+			return ErrTruncated{"message output range packing", startLength - len(metadata)}
 		}
 
 		if packing&COINSPARK_OUTPUTS_RESERVED_MASK > 0 {
-			return false
+			return ErrBadPacking
 		}
 
 		readAnotherRange = packing&COINSPARK_OUTPUTS_MORE_FLAG > 0
@@ -3176,7 +3446,7 @@ func (p *CoinSparkMessage) Decode(buffer []byte, countOutputs int) bool {
 			// Create a new output range
 			if len(p.OutputRanges) >= COINSPARK_MESSAGE_MAX_IO_RANGES {
 				// too many output ranges
-				return false
+				return ErrTooManyRanges
 			}
 
 			firstBytes := 0
@@ -3200,7 +3470,7 @@ func (p *CoinSparkMessage) Decode(buffer []byte, countOutputs int) bool {
 				// we'll be taking additional bytes
 				success, extendPackingType := DecodePackingExtend(byte(packingValue), true)
 				if !success {
-					return false
+					return ErrBadPacking
 				}
 
 				outputRange = PackingTypeToValues(extendPackingType, nil, countOutputs)
@@ -3208,7 +3478,7 @@ func (p *CoinSparkMessage) Decode(buffer []byte, countOutputs int) bool {
 				firstBytes, countBytes = PackingExtendAddByteCounts(byte(packingValue), firstBytes, countBytes, true)
 
 			} else {
-				return false
+				return ErrBadPacking
 				//will be self.COINSPARK_OUTPUTS_TYPE_UNUSED
 			}
 
@@ -3216,14 +3486,14 @@ func (p *CoinSparkMessage) Decode(buffer []byte, countOutputs int) bool {
 
 			success, v := ShiftLittleEndianBytesToInt(&metadata, firstBytes)
 			if !success {
-				return false
+				return ErrTruncated{"message first output", startLength - len(metadata)}
 			} else if firstBytes > 0 {
 				outputRange.First = CoinSparkIOIndex(v)
 			}
 
 			success, v = ShiftLittleEndianBytesToInt(&metadata, countBytes)
 			if !success {
-				return false
+				return ErrTruncated{"message output count", startLength - len(metadata)}
 			} else if countBytes > 0 {
 				outputRange.Count = CoinSparkIOIndex(v)
 			}
@@ -3236,11 +3506,15 @@ func (p *CoinSparkMessage) Decode(buffer []byte, countOutputs int) bool {
 	}
 
 	// Message hash
+	if len(metadata) < COINSPARK_MESSAGE_HASH_MIN_LEN {
+		return ErrTruncated{"message hash", startLength - len(metadata)}
+	}
+
 	p.HashLen = COINSPARK_MIN(len(metadata), COINSPARK_MESSAGE_HASH_MAX_LEN)
-	p.Hash = metadata[:p.HashLen] // insufficient length will be caught by isValid()
+	p.Hash = append([]byte(nil), metadata[:p.HashLen]...) // insufficient length will be caught by isValid()
 
 	// Return validity
-	return p.IsValid()
+	return p.Validate()
 
 }
 
@@ -3258,7 +3532,7 @@ func (p *CoinSparkMessage) CalcHashLen(countOutputs int, metadataMaxLen int) int
 		}
 	} else {
 		hashLen -= 1 // packing
-		shortDomainName, _ := ShrinkLowerDomainName(p.ServerHost)
+		shortDomainName, _ := ShrinkLowerDomainName(domainNameASCIIOrSame(p.ServerHost))
 		hostPathLen += len(shortDomainName) + 1
 	}
 
@@ -3285,7 +3559,7 @@ func (p *CoinSparkMessage) CalcServerURL() string {
 	} else {
 		buffer.WriteString("http://")
 	}
-	buffer.WriteString(p.ServerHost)
+	buffer.WriteString(domainNameASCIIOrSame(p.ServerHost))
 	buffer.WriteString("/")
 	if p.UsePrefix {
 		buffer.WriteString("coinspark/")
@@ -0,0 +1,149 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// These tests share values between goroutines, and are meant to be run with go test -race.
+
+const concurrencyTestGoroutines = 8
+
+func runConcurrently(work func(worker int)) {
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < concurrencyTestGoroutines; worker++ {
+		waitGroup.Add(1)
+		go func(worker int) {
+			defer waitGroup.Done()
+			work(worker)
+		}(worker)
+	}
+	waitGroup.Wait()
+}
+
+func TestConcurrentApplySharedBalances(t *testing.T) {
+	genesis := quoteTestGenesis(t, 5, 100)
+	transferList := CoinSparkTransferList{[]CoinSparkTransfer{
+		{quoteTestAssetRef, CoinSparkIORange{0, 2}, CoinSparkIORange{0, 2}, 60},
+	}}
+	inputBalances := []CoinSparkAssetQty{100, 50, 10}
+	outputsRegular := []bool{true, true, true}
+	want := transferList.Apply(&quoteTestAssetRef, genesis, inputBalances, outputsRegular)
+
+	runConcurrently(func(worker int) {
+		got := transferList.Apply(&quoteTestAssetRef, genesis, inputBalances, outputsRegular)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("worker %d: got %v, want %v", worker, got, want)
+		}
+		_, trace := transferList.ApplyWithTrace(&quoteTestAssetRef, genesis, inputBalances, outputsRegular)
+		if !reflect.DeepEqual(trace.OutputBalances, want) {
+			t.Errorf("worker %d: trace gives %v, want %v", worker, trace.OutputBalances, want)
+		}
+	})
+
+	if !reflect.DeepEqual(inputBalances, []CoinSparkAssetQty{100, 50, 10}) {
+		t.Errorf("input balances changed to %v", inputBalances)
+	}
+}
+
+func TestConcurrentMessageEncodeDecode(t *testing.T) {
+	message := CoinSparkMessage{
+		UseHttps:     true,
+		ServerHost:   "bücher.example",
+		UsePrefix:    true,
+		ServerPath:   "msg",
+		OutputRanges: []CoinSparkIORange{{0, 2}, {4, 1}},
+		Hash:         bytes.Repeat([]byte{0xab}, 32),
+		HashLen:      12,
+	}
+	metadata := message.Encode(8, 40)
+	if metadata == nil {
+		t.Fatal("message could not be encoded")
+	}
+	original := append([]byte(nil), metadata...)
+
+	runConcurrently(func(worker int) {
+		if encoded := message.Encode(8, 40); !bytes.Equal(encoded, original) {
+			t.Errorf("worker %d: encoded %x, want %x", worker, encoded, original)
+		}
+		var decoded CoinSparkMessage
+		if err := decoded.DecodeErr(metadata, 8); err != nil {
+			t.Errorf("worker %d: %v", worker, err)
+			return
+		}
+		decoded.OutputRanges[0].Count = CoinSparkIOIndex(worker) // must not reach the shared metadata
+		if decoded.ServerHost != "xn--bcher-kva.example" || decoded.CalcServerURL() != message.CalcServerURL() {
+			t.Errorf("worker %d: decoded server %s", worker, decoded.CalcServerURL())
+		}
+	})
+
+	if !bytes.Equal(metadata, original) {
+		t.Error("shared metadata changed")
+	}
+}
+
+func TestConcurrentRandomize(t *testing.T) {
+	refs := make([]CoinSparkPaymentRef, concurrencyTestGoroutines)
+	runConcurrently(func(worker int) {
+		refs[worker].Randomize()
+		if !refs[worker].IsValid() {
+			t.Errorf("worker %d: random payment reference %d is not valid", worker, refs[worker].Ref)
+		}
+	})
+}
+
+func TestConcurrentAssetStoreCopies(t *testing.T) {
+	store := NewCoinSparkMemoryAssetPageStore()
+	content := []byte("shared content")
+	if err := store.Put("/shared", &CoinSparkAssetFile{Content: content}); err != nil {
+		t.Fatal(err)
+	}
+
+	runConcurrently(func(worker int) {
+		file := &CoinSparkAssetFile{Content: []byte{byte(worker)}}
+		if err := store.Put("/worker", file); err != nil {
+			t.Error(err)
+		}
+		file.Content[0] = 0xff // must not reach the store
+
+		err, shared := store.Get("/shared")
+		if err != nil || shared == nil {
+			t.Errorf("worker %d: %v", worker, err)
+			return
+		}
+		shared.Content[0] = byte(worker) // nor this, through a copy handed out by Get
+		if err, stored := store.Get("/worker"); err != nil || stored == nil || stored.Content[0] == 0xff {
+			t.Errorf("worker %d: change to the file given to Put reached the store", worker)
+		}
+	})
+
+	if err, shared := store.Get("/shared"); err != nil || !bytes.Equal(shared.Content, []byte("shared content")) {
+		t.Errorf("stored content changed to %q", shared.Content)
+	}
+	content[0] = 'X'
+	if _, shared := store.Get("/shared"); shared.Content[0] != 's' {
+		t.Error("change to the slice given to Put reached the store")
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Canonical text, JSON and SQL encodings.
+//
+// Asset references, addresses and payment references have a text form: "block-offset-prefix"
+// as returned by CoinSparkAssetRef.Encode, the CoinSpark address string, and the payment
+// reference as a decimal number. Only valid values can be written in text form. In JSON they
+// appear as strings (payment references as numbers) and in SQL as text (payment references
+// as bigint).
+//
+// Genesis, transfers and messages are written as JSON objects with hashes in lowercase hex,
+// keeping every field. Genesis and messages round-trip exactly whatever their values, but the
+// asset reference of a transfer is written in text form, so marshalling a transfer or transfer
+// list fails if it is not valid. In SQL they are stored as JSON, e.g. in a Postgres jsonb
+// column. A NULL column scans as the cleared value.
+
+// Returns the asset reference as "block-offset-prefix".
+func (p CoinSparkAssetRef) MarshalText() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p.Encode(), nil
+}
+
+// Reads an asset reference written as "block-offset-prefix".
+func (p *CoinSparkAssetRef) UnmarshalText(text []byte) error {
+	var assetRef CoinSparkAssetRef
+	if err := assetRef.DecodeErr(string(text)); err != nil {
+		return err
+	}
+	*p = assetRef
+	return nil
+}
+
+// Returns the asset reference as a string for database/sql.
+func (p CoinSparkAssetRef) Value() (driver.Value, error) {
+	text, err := p.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+// Reads an asset reference from a database/sql text column.
+func (p *CoinSparkAssetRef) Scan(src interface{}) error {
+	err, text, isNull := scanText(src)
+	if err != nil || isNull {
+		p.Clear()
+		return err
+	}
+	return p.UnmarshalText(text)
+}
+
+// Returns the CoinSpark address string.
+func (p CoinSparkAddress) MarshalText() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(p.Encode()), nil
+}
+
+// Reads a CoinSpark address string. The bitcoin address must belong to p.Network, mainnet if nil.
+func (p *CoinSparkAddress) UnmarshalText(text []byte) error {
+	address := CoinSparkAddress{Network: p.Network}
+	if err := address.DecodeErr(string(text)); err != nil {
+		return err
+	}
+	*p = address
+	return nil
+}
+
+// Returns the CoinSpark address string for database/sql.
+func (p CoinSparkAddress) Value() (driver.Value, error) {
+	text, err := p.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+// Reads a CoinSpark address from a database/sql text column.
+func (p *CoinSparkAddress) Scan(src interface{}) error {
+	err, text, isNull := scanText(src)
+	if err != nil || isNull {
+		network := p.Network
+		p.Clear()
+		p.Network = network
+		return err
+	}
+	return p.UnmarshalText(text)
+}
+
+// Returns the payment reference as a decimal number.
+func (p CoinSparkPaymentRef) MarshalText() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(strconv.FormatUint(p.Ref, 10)), nil
+}
+
+// Reads a payment reference written as a decimal number.
+func (p *CoinSparkPaymentRef) UnmarshalText(text []byte) error {
+	ref, err := strconv.ParseUint(string(text), 10, 64)
+	if err != nil {
+		return ErrBadFormat
+	}
+	paymentRef := CoinSparkPaymentRef{ref}
+	if err := paymentRef.Validate(); err != nil {
+		return err
+	}
+	*p = paymentRef
+	return nil
+}
+
+// Returns the payment reference as a JSON number, which is exact since it is below 2^52.
+func (p CoinSparkPaymentRef) MarshalJSON() ([]byte, error) {
+	return p.MarshalText()
+}
+
+// Reads a payment reference from a JSON number or a string containing one.
+func (p *CoinSparkPaymentRef) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		return p.UnmarshalText([]byte(text))
+	}
+	return p.UnmarshalText(data)
+}
+
+// Returns the payment reference as an int64 for database/sql.
+func (p CoinSparkPaymentRef) Value() (driver.Value, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return int64(p.Ref), nil
+}
+
+// Reads a payment reference from a database/sql integer or text column.
+func (p *CoinSparkPaymentRef) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case int64:
+		if value < 0 {
+			return ErrOutOfRange{"Ref"}
+		}
+		return p.UnmarshalText([]byte(strconv.FormatInt(value, 10)))
+	}
+
+	err, text, isNull := scanText(src)
+	if err != nil || isNull {
+		p.Clear()
+		return err
+	}
+	return p.UnmarshalText(text)
+}
+
+type ioRangeJSON struct {
+	First CoinSparkIOIndex `json:"first"`
+	Count CoinSparkIOIndex `json:"count"`
+}
+
+// Returns the range as a JSON object with first and count.
+func (p CoinSparkIORange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ioRangeJSON{p.First, p.Count})
+}
+
+// Reads a range from a JSON object with first and count.
+func (p *CoinSparkIORange) UnmarshalJSON(data []byte) error {
+	var ioRange ioRangeJSON
+	if err := json.Unmarshal(data, &ioRange); err != nil {
+		return err
+	}
+	p.First = ioRange.First
+	p.Count = ioRange.Count
+	return nil
+}
+
+type genesisJSON struct {
+	QtyMantissa        int16  `json:"qtyMantissa"`
+	QtyExponent        int16  `json:"qtyExponent"`
+	ChargeFlatMantissa int16  `json:"chargeFlatMantissa"`
+	ChargeFlatExponent int16  `json:"chargeFlatExponent"`
+	ChargeBasisPoints  int16  `json:"chargeBasisPoints"`
+	UseHttps           bool   `json:"useHttps"`
+	DomainName         string `json:"domainName"`
+	UsePrefix          bool   `json:"usePrefix"`
+	PagePath           string `json:"pagePath"`
+	AssetHash          string `json:"assetHash"`
+	AssetHashLen       int    `json:"assetHashLen"`
+}
+
+// Returns the genesis as a JSON object, with the asset hash in hex.
+func (p CoinSparkGenesis) MarshalJSON() ([]byte, error) {
+	return json.Marshal(genesisJSON{
+		QtyMantissa:        p.QtyMantissa,
+		QtyExponent:        p.QtyExponent,
+		ChargeFlatMantissa: p.ChargeFlatMantissa,
+		ChargeFlatExponent: p.ChargeFlatExponent,
+		ChargeBasisPoints:  p.ChargeBasisPoints,
+		UseHttps:           p.UseHttps,
+		DomainName:         p.DomainName,
+		UsePrefix:          p.UsePrefix,
+		PagePath:           p.PagePath,
+		AssetHash:          hex.EncodeToString(p.AssetHash),
+		AssetHashLen:       p.AssetHashLen,
+	})
+}
+
+// Reads a genesis from the JSON object written by MarshalJSON.
+func (p *CoinSparkGenesis) UnmarshalJSON(data []byte) error {
+	var genesis genesisJSON
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return err
+	}
+
+	err, assetHash := decodeHashHex(genesis.AssetHash, "AssetHash")
+	if err != nil {
+		return err
+	}
+
+	p.QtyMantissa = genesis.QtyMantissa
+	p.QtyExponent = genesis.QtyExponent
+	p.ChargeFlatMantissa = genesis.ChargeFlatMantissa
+	p.ChargeFlatExponent = genesis.ChargeFlatExponent
+	p.ChargeBasisPoints = genesis.ChargeBasisPoints
+	p.UseHttps = genesis.UseHttps
+	p.DomainName = genesis.DomainName
+	p.UsePrefix = genesis.UsePrefix
+	p.PagePath = genesis.PagePath
+	p.AssetHash = assetHash
+	p.AssetHashLen = genesis.AssetHashLen
+	return nil
+}
+
+// Returns the genesis as JSON for database/sql.
+func (p CoinSparkGenesis) Value() (driver.Value, error) {
+	return p.MarshalJSON()
+}
+
+// Reads a genesis from a database/sql JSON column.
+func (p *CoinSparkGenesis) Scan(src interface{}) error {
+	err, text, isNull := scanText(src)
+	if err != nil || isNull {
+		p.Clear()
+		return err
+	}
+	return p.UnmarshalJSON(text)
+}
+
+type transferJSON struct {
+	AssetRef     CoinSparkAssetRef `json:"assetRef"`
+	Inputs       CoinSparkIORange  `json:"inputs"`
+	Outputs      CoinSparkIORange  `json:"outputs"`
+	QtyPerOutput CoinSparkAssetQty `json:"qtyPerOutput"`
+}
+
+// Returns the transfer as a JSON object, with the asset reference as "block-offset-prefix".
+func (p CoinSparkTransfer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(transferJSON{p.AssetRef, p.Inputs, p.Outputs, p.QtyPerOutput})
+}
+
+// Reads a transfer from the JSON object written by MarshalJSON.
+func (p *CoinSparkTransfer) UnmarshalJSON(data []byte) error {
+	var transfer transferJSON
+	if err := json.Unmarshal(data, &transfer); err != nil {
+		return err
+	}
+	p.AssetRef = transfer.AssetRef
+	p.Inputs = transfer.Inputs
+	p.Outputs = transfer.Outputs
+	p.QtyPerOutput = transfer.QtyPerOutput
+	return nil
+}
+
+// Returns the transfer as JSON for database/sql.
+func (p CoinSparkTransfer) Value() (driver.Value, error) {
+	return p.MarshalJSON()
+}
+
+// Reads a transfer from a database/sql JSON column.
+func (p *CoinSparkTransfer) Scan(src interface{}) error {
+	err, text, isNull := scanText(src)
+	if err != nil || isNull {
+		p.Clear()
+		return err
+	}
+	return p.UnmarshalJSON(text)
+}
+
+// Returns the transfer list as a JSON array of transfers.
+func (p CoinSparkTransferList) MarshalJSON() ([]byte, error) {
+	transfers := p.Transfers
+	if transfers == nil {
+		transfers = []CoinSparkTransfer{}
+	}
+	return json.Marshal(transfers)
+}
+
+// Reads a transfer list from a JSON array of transfers.
+func (p *CoinSparkTransferList) UnmarshalJSON(data []byte) error {
+	transfers := make([]CoinSparkTransfer, 0)
+	if err := json.Unmarshal(data, &transfers); err != nil {
+		return err
+	}
+	if transfers == nil { // JSON null
+		transfers = make([]CoinSparkTransfer, 0)
+	}
+	p.Transfers = transfers
+	return nil
+}
+
+// Returns the transfer list as JSON for database/sql.
+func (p CoinSparkTransferList) Value() (driver.Value, error) {
+	return p.MarshalJSON()
+}
+
+// Reads a transfer list from a database/sql JSON column.
+func (p *CoinSparkTransferList) Scan(src interface{}) error {
+	err, text, isNull := scanText(src)
+	if err != nil || isNull {
+		p.Clear()
+		return err
+	}
+	return p.UnmarshalJSON(text)
+}
+
+type messageJSON struct {
+	UseHttps     bool               `json:"useHttps"`
+	ServerHost   string             `json:"serverHost"`
+	UsePrefix    bool               `json:"usePrefix"`
+	ServerPath   string             `json:"serverPath"`
+	IsPublic     bool               `json:"isPublic"`
+	OutputRanges []CoinSparkIORange `json:"outputRanges"`
+	Hash         string             `json:"hash"`
+	HashLen      int                `json:"hashLen"`
+}
+
+// Returns the message as a JSON object, with the hash in hex.
+func (p CoinSparkMessage) MarshalJSON() ([]byte, error) {
+	outputRanges := p.OutputRanges
+	if outputRanges == nil {
+		outputRanges = []CoinSparkIORange{}
+	}
+	return json.Marshal(messageJSON{
+		UseHttps:     p.UseHttps,
+		ServerHost:   p.ServerHost,
+		UsePrefix:    p.UsePrefix,
+		ServerPath:   p.ServerPath,
+		IsPublic:     p.IsPublic,
+		OutputRanges: outputRanges,
+		Hash:         hex.EncodeToString(p.Hash),
+		HashLen:      p.HashLen,
+	})
+}
+
+// Reads a message from the JSON object written by MarshalJSON.
+func (p *CoinSparkMessage) UnmarshalJSON(data []byte) error {
+	var message messageJSON
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+
+	err, hash := decodeHashHex(message.Hash, "Hash")
+	if err != nil {
+		return err
+	}
+
+	p.UseHttps = message.UseHttps
+	p.ServerHost = message.ServerHost
+	p.UsePrefix = message.UsePrefix
+	p.ServerPath = message.ServerPath
+	p.IsPublic = message.IsPublic
+	p.OutputRanges = message.OutputRanges
+	p.Hash = hash
+	p.HashLen = message.HashLen
+	return nil
+}
+
+// Returns the message as JSON for database/sql.
+func (p CoinSparkMessage) Value() (driver.Value, error) {
+	return p.MarshalJSON()
+}
+
+// Reads a message from a database/sql JSON column.
+func (p *CoinSparkMessage) Scan(src interface{}) error {
+	err, text, isNull := scanText(src)
+	if err != nil || isNull {
+		*p = CoinSparkMessage{}
+		return err
+	}
+	return p.UnmarshalJSON(text)
+}
+
+// Returns the bytes of a text or JSON column value, and whether it was NULL.
+func scanText(src interface{}) (err error, text []byte, isNull bool) {
+	switch value := src.(type) {
+	case nil:
+		return nil, nil, true
+	case string:
+		return nil, []byte(value), false
+	case []byte:
+		return nil, append([]byte(nil), value...), false
+	}
+	return fmt.Errorf("coinspark: cannot scan %T", src), nil, false
+}
+
+// Decodes a hash written in hex, keeping an empty hash as nil.
+func decodeHashHex(hexHash string, field string) (error, []byte) {
+	if hexHash == "" {
+		return nil, nil
+	}
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil {
+		return ErrOutOfRange{field}, nil
+	}
+	return nil, hash
+}
@@ -0,0 +1,252 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var encodingTestAssetRef = CoinSparkAssetRef{BlockNum: 123456, TxOffset: 1000, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x4a, 0x5e}}
+
+func TestGenesisJSONRoundTrip(t *testing.T) {
+	genesis := CoinSparkGenesis{
+		QtyMantissa:  -5, // out of range values are kept
+		DomainName:   "a..com",
+		PagePath:     "x",
+		AssetHash:    []byte{0x01, 0x02, 0x03},
+		AssetHashLen: 99,
+	}
+	data, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded CoinSparkGenesis
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(genesis, decoded) {
+		t.Errorf("round trip gave %+v, want %+v", decoded, genesis)
+	}
+}
+
+func TestTransferJSONNeedsValidAssetRef(t *testing.T) {
+	transfer := CoinSparkTransfer{AssetRef: CoinSparkAssetRef{BlockNum: -2}}
+	if _, err := json.Marshal(transfer); err == nil {
+		t.Error("transfer with an invalid asset reference was marshalled")
+	}
+
+	var scanned CoinSparkTransfer
+	if err := scanned.Scan(42); err == nil {
+		t.Error("Scan accepted an integer")
+	}
+}
+
+// Writes value as JSON and checks the result, then reads it back into decoded.
+func encodingTestJSON(t *testing.T, value interface{}, wantJSON string, decoded interface{}) {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantJSON != "" && string(data) != wantJSON {
+		t.Errorf("%T marshalled to %s, want %s", value, data, wantJSON)
+	}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("%T did not unmarshal from %s: %v", value, data, err)
+	}
+}
+
+func TestAssetRefEncodings(t *testing.T) {
+	text, err := encodingTestAssetRef.MarshalText()
+	if err != nil || string(text) != "123456-1000-24138" {
+		t.Fatalf("MarshalText gave %q, %v", text, err)
+	}
+
+	var decoded CoinSparkAssetRef
+	encodingTestJSON(t, encodingTestAssetRef, `"123456-1000-24138"`, &decoded)
+	if decoded != encodingTestAssetRef {
+		t.Errorf("JSON round trip gave %+v", decoded)
+	}
+
+	value, err := encodingTestAssetRef.Value()
+	if err != nil || value != "123456-1000-24138" {
+		t.Fatalf("Value gave %v, %v", value, err)
+	}
+	for _, src := range []interface{}{value, []byte("123456-1000-24138")} {
+		var scanned CoinSparkAssetRef
+		if err := scanned.Scan(src); err != nil || scanned != encodingTestAssetRef {
+			t.Errorf("Scan(%#v) gave %+v, %v", src, scanned, err)
+		}
+	}
+	if err := decoded.Scan(nil); err != nil || decoded != (CoinSparkAssetRef{}) {
+		t.Errorf("Scan(nil) gave %+v, %v", decoded, err)
+	}
+
+	if _, err := (CoinSparkAssetRef{BlockNum: -2}).Value(); err == nil {
+		t.Error("invalid asset reference was written")
+	}
+	for _, text := range []string{`"123456-1000"`, `"123456-1000-65536"`, `"a-b-c"`, `123456`} {
+		decoded = encodingTestAssetRef
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			t.Errorf("%s was accepted", text)
+		} else if decoded != encodingTestAssetRef {
+			t.Errorf("rejected %s changed the asset reference to %+v", text, decoded)
+		}
+	}
+	if err := decoded.Scan(123456); err == nil {
+		t.Error("Scan accepted an integer")
+	}
+}
+
+func TestAddressEncodings(t *testing.T) {
+	address := CoinSparkAddress{BitcoinAddress: "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS", AddressFlags: COINSPARK_ADDRESS_FLAG_ASSETS, PaymentRef: CoinSparkPaymentRef{1234}}
+	encoded := address.Encode()
+
+	var decoded CoinSparkAddress
+	encodingTestJSON(t, address, `"`+encoded+`"`, &decoded)
+	if !decoded.Match(&address) {
+		t.Errorf("JSON round trip gave %+v", decoded)
+	}
+
+	value, err := address.Value()
+	if err != nil || value != encoded {
+		t.Fatalf("Value gave %v, %v", value, err)
+	}
+	for _, src := range []interface{}{value, []byte(encoded)} {
+		var scanned CoinSparkAddress
+		if err := scanned.Scan(src); err != nil || !scanned.Match(&address) {
+			t.Errorf("Scan(%#v) gave %+v, %v", src, scanned, err)
+		}
+	}
+
+	testnet := CoinSparkAddress{BitcoinAddress: "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", AddressFlags: COINSPARK_ADDRESS_FLAG_ASSETS, Network: CoinSparkTestNet3()}
+	text, err := testnet.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(CoinSparkAddress).UnmarshalText(text); err != ErrWrongNetwork {
+		t.Errorf("testnet address read on mainnet: got %v, want %v", err, ErrWrongNetwork)
+	}
+	scanned := CoinSparkAddress{Network: CoinSparkTestNet3()}
+	if err := scanned.Scan(string(text)); err != nil || !scanned.Match(&testnet) {
+		t.Errorf("testnet address scanned on testnet gave %+v, %v", scanned, err)
+	}
+	if err := scanned.Scan(nil); err != nil || scanned.BitcoinAddress != "" || scanned.Network == nil {
+		t.Errorf("Scan(nil) gave %+v, %v, want a cleared address keeping its network", scanned, err)
+	}
+
+	if _, err := (CoinSparkAddress{BitcoinAddress: "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnT"}).MarshalText(); err == nil {
+		t.Error("address with a bad checksum was written")
+	}
+	for _, text := range []string{`""`, `"s0"`, `"` + encoded[:len(encoded)-1] + `"`, `42`} {
+		decoded = address
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			t.Errorf("%s was accepted", text)
+		} else if !decoded.Match(&address) {
+			t.Errorf("rejected %s changed the address to %+v", text, decoded)
+		}
+	}
+}
+
+func TestPaymentRefEncodings(t *testing.T) {
+	paymentRef := CoinSparkPaymentRef{4503599627370495} // 2^52-1, the largest
+	var decoded CoinSparkPaymentRef
+	encodingTestJSON(t, paymentRef, `4503599627370495`, &decoded)
+	if decoded != paymentRef {
+		t.Errorf("JSON round trip gave %d", decoded.Ref)
+	}
+	if err := json.Unmarshal([]byte(`"1234"`), &decoded); err != nil || decoded.Ref != 1234 {
+		t.Errorf("JSON string gave %d, %v", decoded.Ref, err)
+	}
+
+	value, err := paymentRef.Value()
+	if err != nil || value != int64(paymentRef.Ref) {
+		t.Fatalf("Value gave %v, %v", value, err)
+	}
+	for _, src := range []interface{}{value, "4503599627370495", []byte("4503599627370495")} {
+		var scanned CoinSparkPaymentRef
+		if err := scanned.Scan(src); err != nil || scanned != paymentRef {
+			t.Errorf("Scan(%#v) gave %d, %v", src, scanned.Ref, err)
+		}
+	}
+	if err := decoded.Scan(nil); err != nil || decoded.Ref != 0 {
+		t.Errorf("Scan(nil) gave %d, %v", decoded.Ref, err)
+	}
+
+	if _, err := (CoinSparkPaymentRef{4503599627370496}).MarshalJSON(); err == nil {
+		t.Error("payment reference of 2^52 was written")
+	}
+	for _, text := range []string{`4503599627370496`, `-1`, `1.5`, `"abc"`, `""`, `null`} {
+		decoded = paymentRef
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			t.Errorf("%s was accepted", text)
+		} else if decoded != paymentRef {
+			t.Errorf("rejected %s changed the payment reference to %d", text, decoded.Ref)
+		}
+	}
+	for _, src := range []interface{}{int64(-1), int64(4503599627370496), 1.5} {
+		if err := decoded.Scan(src); err == nil {
+			t.Errorf("Scan(%#v) was accepted", src)
+		}
+	}
+}
+
+func TestMessageEncodings(t *testing.T) {
+	message := CoinSparkMessage{
+		UseHttps:     true,
+		ServerHost:   "msg.example.com",
+		UsePrefix:    true,
+		ServerPath:   "inbox",
+		IsPublic:     true,
+		OutputRanges: []CoinSparkIORange{{0, 2}, {5, 1}},
+		Hash:         []byte{0xde, 0xad, 0xbe, 0xef},
+		HashLen:      4,
+	}
+	var decoded CoinSparkMessage
+	encodingTestJSON(t, message, `{"useHttps":true,"serverHost":"msg.example.com","usePrefix":true,"serverPath":"inbox",`+
+		`"isPublic":true,"outputRanges":[{"first":0,"count":2},{"first":5,"count":1}],"hash":"deadbeef","hashLen":4}`, &decoded)
+	if !reflect.DeepEqual(decoded, message) {
+		t.Errorf("JSON round trip gave %+v", decoded)
+	}
+
+	value, err := message.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned CoinSparkMessage
+	if err := scanned.Scan(value); err != nil || !reflect.DeepEqual(scanned, message) {
+		t.Errorf("Scan(Value()) gave %+v, %v", scanned, err)
+	}
+	if err := scanned.Scan(nil); err != nil || !reflect.DeepEqual(scanned, CoinSparkMessage{}) {
+		t.Errorf("Scan(nil) gave %+v, %v", scanned, err)
+	}
+
+	for _, text := range []string{`{"hash":"xyz"}`, `{"outputRanges":{}}`, `[]`, `"message"`} {
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			t.Errorf("%s was accepted", text)
+		}
+	}
+	if err := scanned.Scan(42); err == nil {
+		t.Error("Scan accepted an integer")
+	}
+}
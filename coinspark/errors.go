@@ -0,0 +1,157 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the DecodeErr and Validate methods. Compare against the sentinels with
+// errors.Is, and extract the typed errors with errors.As, for example:
+//
+//	var truncated ErrTruncated
+//	if errors.As(err, &truncated) { ... truncated.Section, truncated.Offset ... }
+//
+// Functions which return an error alongside other values return it first, as
+// CoinSparkGenesis.Encode does. Only methods for standard library interfaces, such as
+// json.Marshaler and driver.Valuer, return it last.
+
+var (
+	ErrBadPrefix         = errors.New("coinspark: bad prefix")
+	ErrMixedCase         = errors.New("coinspark: mixed upper and lower case")
+	ErrBadFormat         = errors.New("coinspark: bad format")
+	ErrBadBitcoinAddress = errors.New("coinspark: invalid bitcoin address")
+	ErrWrongNetwork      = errors.New("coinspark: bitcoin address belongs to another network")
+	ErrNoMetadata        = errors.New("coinspark: metadata not present")
+	ErrBadPacking        = errors.New("coinspark: bad packing")
+	ErrBadDomainPath     = errors.New("coinspark: bad domain name or path")
+	ErrTooManyRanges     = errors.New("coinspark: too many output ranges")
+	ErrNotPermitted      = errors.New("coinspark: not permitted by address flags")
+	ErrDuplicateParam    = errors.New("coinspark: duplicate URI parameter")
+	ErrRequiredParam     = errors.New("coinspark: unsupported required URI parameter")
+	ErrTxNotFound        = errors.New("coinspark: transaction not found in block")
+	ErrTxIDMismatch      = errors.New("coinspark: transaction id does not match prefix")
+	ErrAssetHashMismatch = errors.New("coinspark: asset page does not match genesis asset hash")
+)
+
+// A character which is not in the base58 alphabet.
+type ErrBadBase58Char struct {
+	Pos  int // position in the input string
+	Char byte
+}
+
+func (e ErrBadBase58Char) Error() string {
+	return fmt.Sprintf("coinspark: invalid base58 character %q at position %d", e.Char, e.Pos)
+}
+
+// A character which is not in the bech32 alphabet, in a segwit CoinSpark address.
+type ErrBadBech32Char struct {
+	Pos  int // position in the input string
+	Char byte
+}
+
+func (e ErrBadBech32Char) Error() string {
+	return fmt.Sprintf("coinspark: invalid bech32 character %q at position %d", e.Char, e.Pos)
+}
+
+// Input ended before a section of metadata could be read.
+type ErrTruncated struct {
+	Section string // which part was being read, e.g. "genesis quantity"
+	Offset  int    // bytes into the metadata for this message type, after its prefix
+}
+
+func (e ErrTruncated) Error() string {
+	return fmt.Sprintf("coinspark: truncated %s at byte %d", e.Section, e.Offset)
+}
+
+// A field whose value is outside its permitted range.
+type ErrOutOfRange struct {
+	Field string // name of the struct field, e.g. "QtyMantissa"
+}
+
+func (e ErrOutOfRange) Error() string {
+	return fmt.Sprintf("coinspark: %s out of range", e.Field)
+}
+
+// Metadata which cannot be encoded within the byte budget given.
+type ErrOverBudget struct {
+	Needed int // smallest number of bytes which would be enough
+	Budget int // bytes available
+}
+
+func (e ErrOverBudget) Error() string {
+	return fmt.Sprintf("coinspark: metadata needs %d bytes but only %d are available", e.Needed, e.Budget)
+}
+
+// Inputs which do not hold enough of an asset for what is to be sent.
+type ErrInsufficientBalance struct {
+	AssetRef  CoinSparkAssetRef
+	Needed    CoinSparkAssetQty // total gross quantity, including charges
+	Available CoinSparkAssetQty
+}
+
+func (e ErrInsufficientBalance) Error() string {
+	return fmt.Sprintf("coinspark: asset %s needs %d units but inputs hold %d", e.AssetRef.Encode(), e.Needed, e.Available)
+}
+
+// An asset held by the inputs of a transaction whose genesis was not supplied.
+type ErrMissingGenesis struct {
+	AssetRef CoinSparkAssetRef
+}
+
+func (e ErrMissingGenesis) Error() string {
+	return fmt.Sprintf("coinspark: no genesis for asset %s", e.AssetRef.Encode())
+}
+
+// A transfer list planned by CoinSparkTransferPlanner which, when applied, does not give the
+// output balances planned for. This indicates a bug rather than a problem with the inputs.
+type ErrPlanMismatch struct {
+	AssetRef CoinSparkAssetRef
+	Output   int
+	Planned  CoinSparkAssetQty
+	Applied  CoinSparkAssetQty
+}
+
+func (e ErrPlanMismatch) Error() string {
+	return fmt.Sprintf("coinspark: plan for asset %s gives output %d %d units instead of %d", e.AssetRef.Encode(), e.Output, e.Applied, e.Planned)
+}
+
+// An error in the JSON-RPC response of a message server, with one of the
+// COINSPARK_MESSAGE_ERR_... codes or a code of the server's own.
+type ErrMessageServer struct {
+	Code    int
+	Message string
+}
+
+func (e ErrMessageServer) Error() string {
+	return fmt.Sprintf("coinspark: message server error %d: %s", e.Code, e.Message)
+}
+
+// Adds base to the offset of a truncation error which was counted from a later starting point.
+func offsetError(err error, base int) error {
+	var truncated ErrTruncated
+	if errors.As(err, &truncated) {
+		truncated.Offset += base
+		return truncated
+	}
+	return err
+}
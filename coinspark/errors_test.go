@@ -0,0 +1,150 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorsBadAddressChar(t *testing.T) {
+	address := CoinSparkAddress{BitcoinAddress: "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS", AddressFlags: COINSPARK_ADDRESS_FLAG_ASSETS}
+	encoded := []byte(address.Encode())
+	encoded[5] = '0'
+	var badBase58 ErrBadBase58Char
+	if err := new(CoinSparkAddress).DecodeErr(string(encoded)); !errors.As(err, &badBase58) {
+		t.Errorf("base58 address with '0': got %v, want ErrBadBase58Char", err)
+	} else if badBase58 != (ErrBadBase58Char{5, '0'}) {
+		t.Errorf("base58 address with '0': got %+v, want position 5", badBase58)
+	}
+
+	address.BitcoinAddress = bech32TestBitcoinAddress
+	encoded = []byte(address.Encode())
+	encoded[6] = 'b'
+	var badBech32 ErrBadBech32Char
+	if err := new(CoinSparkAddress).DecodeErr(string(encoded)); !errors.As(err, &badBech32) {
+		t.Errorf("bech32 address with 'b': got %v, want ErrBadBech32Char", err)
+	} else if badBech32 != (ErrBadBech32Char{6, 'b'}) {
+		t.Errorf("bech32 address with 'b': got %+v, want position 6", badBech32)
+	}
+}
+
+func TestErrorsWrongNetwork(t *testing.T) {
+	for _, bitcoinAddress := range []string{
+		"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx",
+	} {
+		address := CoinSparkAddress{BitcoinAddress: bitcoinAddress, Network: CoinSparkTestNet3()}
+		encoded := address.Encode()
+		if encoded == "" {
+			t.Fatalf("%s could not be encoded on testnet", bitcoinAddress)
+		}
+		if err := new(CoinSparkAddress).DecodeErr(encoded); !errors.Is(err, ErrWrongNetwork) {
+			t.Errorf("%s decoded on mainnet: got %v, want %v", bitcoinAddress, err, ErrWrongNetwork)
+		}
+	}
+}
+
+// Checks that err is a truncation of the given section at the given offset.
+func errorsTestTruncated(t *testing.T, name string, err error, section string, offset int) {
+	t.Helper()
+	var truncated ErrTruncated
+	if !errors.As(err, &truncated) {
+		t.Errorf("%s: got %v, want ErrTruncated", name, err)
+	} else if truncated != (ErrTruncated{section, offset}) {
+		t.Errorf("%s: got %+v, want %s at byte %d", name, truncated, section, offset)
+	}
+}
+
+func TestErrorsGenesisTruncated(t *testing.T) {
+	genesis := CoinSparkGenesis{QtyMantissa: 1, QtyExponent: 6, ChargeFlatMantissa: 10, ChargeBasisPoints: 5, DomainName: "example.com", AssetHash: make([]byte, 32)}
+	genesis.AssetHashLen = genesis.CalcHashLen(40)
+	err, metadata := genesis.Encode(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefixLen := len(metadata) - len(LocateMetadataRange(metadata, COINSPARK_GENESIS_PREFIX))
+
+	errorsTestTruncated(t, "no quantity", genesis.DecodeErr(metadata[:prefixLen+1]), "genesis quantity", 0)
+	errorsTestTruncated(t, "no flat charge", genesis.DecodeErr(metadata[:prefixLen+2]), "genesis flat charge", 2)
+	errorsTestTruncated(t, "no basis points charge", genesis.DecodeErr(metadata[:prefixLen+3]), "genesis basis points charge", 3)
+	// the domain is read from its own start, so its offsets are shifted past the charges
+	errorsTestTruncated(t, "no domain", genesis.DecodeErr(metadata[:prefixLen+4]), "domain name packing", 4)
+
+	if err := genesis.DecodeErr(metadata); err != nil {
+		t.Fatal(err)
+	}
+	hashStart := len(metadata) - prefixLen - genesis.AssetHashLen
+	cut := metadata[:len(metadata)-genesis.AssetHashLen+COINSPARK_GENESIS_HASH_MIN_LEN-1]
+	errorsTestTruncated(t, "short asset hash", genesis.DecodeErr(cut), "genesis asset hash", hashStart)
+}
+
+func TestErrorsTransferListTruncated(t *testing.T) {
+	first := CoinSparkTransfer{CoinSparkAssetRef{123456, 1000, [2]byte{0x4a, 0x5e}}, CoinSparkIORange{0, 1}, CoinSparkIORange{0, 2}, 30}
+	second := CoinSparkTransfer{CoinSparkAssetRef{456789, 1234, [2]byte{0x12, 0x34}}, CoinSparkIORange{1, 1}, CoinSparkIORange{2, 1}, 70000}
+	firstOnly := (&CoinSparkTransferList{[]CoinSparkTransfer{first}}).Encode(2, 3, 40)
+	both := (&CoinSparkTransferList{[]CoinSparkTransfer{first, second}}).Encode(2, 3, 40)
+	if firstOnly == nil || both == nil {
+		t.Fatal("transfer list could not be encoded")
+	}
+	firstLen := len(LocateMetadataRange(firstOnly, COINSPARK_TRANSFERS_PREFIX))
+	cut := both[:len(both)-1]
+
+	// the error from the second transfer, counted from its own start
+	var decodedFirst CoinSparkTransfer
+	if err, _ := decodedFirst.DecodeErr(LocateMetadataRange(firstOnly, COINSPARK_TRANSFERS_PREFIX), nil, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	var inner ErrTruncated
+	err, _ := new(CoinSparkTransfer).DecodeErr(LocateMetadataRange(cut, COINSPARK_TRANSFERS_PREFIX)[firstLen:], &decodedFirst, 2, 3)
+	if !errors.As(err, &inner) {
+		t.Fatalf("truncated second transfer: got %v, want ErrTruncated", err)
+	}
+
+	err, count := new(CoinSparkTransferList).DecodeErr(cut, 2, 3)
+	errorsTestTruncated(t, "truncated second transfer", err, inner.Section, firstLen+inner.Offset)
+	if count != 0 {
+		t.Errorf("truncated list decoded %d transfers", count)
+	}
+}
+
+func TestErrorsMessageTruncated(t *testing.T) {
+	message := CoinSparkMessage{ServerHost: "msg.example.com", OutputRanges: []CoinSparkIORange{{0, 2}, {3, 1}}, Hash: make([]byte, 32)}
+	message.HashLen = message.CalcHashLen(5, 40)
+	metadata := message.Encode(5, 40)
+	if metadata == nil {
+		t.Fatal("message could not be encoded")
+	}
+	if err := message.DecodeErr(metadata, 5); err != nil {
+		t.Fatal(err)
+	}
+	hashStart := len(LocateMetadataRange(metadata, COINSPARK_MESSAGE_PREFIX)) - message.HashLen
+	cut := metadata[:len(metadata)-message.HashLen+COINSPARK_MESSAGE_HASH_MIN_LEN-1]
+	errorsTestTruncated(t, "short message hash", message.DecodeErr(cut, 5), "message hash", hashStart)
+
+	payload := LocateMetadataRange(metadata, COINSPARK_MESSAGE_PREFIX)
+	err, server := decodeDomainAndOrPath(string(payload), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cut = metadata[:len(metadata)-len(payload)+server.decodedChars]
+	errorsTestTruncated(t, "no output ranges", message.DecodeErr(cut, 5), "message output range packing", server.decodedChars)
+}
@@ -0,0 +1,283 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Address flags are written as comma-separated names, e.g. "assets,text". Bits 4-22 are not
+// defined by the CoinSpark specification and may be claimed by applications under a name.
+// Bits without a name are written as "bitN" so they are never lost.
+
+const (
+	COINSPARK_ADDRESS_FLAG_CUSTOM_BIT_MIN = 4
+	COINSPARK_ADDRESS_FLAG_CUSTOM_BIT_MAX = 22
+	COINSPARK_ADDRESS_FLAG_BITS           = 32 // bits in CoinSparkAddressFlags
+	COINSPARK_ADDRESS_FLAG_NONE_NAME      = "none"
+	COINSPARK_ADDRESS_FLAG_BIT_PREFIX     = "bit"
+)
+
+// Short names for the flags defined by the specification, in bit order.
+var builtinAddressFlagNames = []struct {
+	flag CoinSparkAddressFlags
+	name string
+}{
+	{COINSPARK_ADDRESS_FLAG_ASSETS, "assets"},
+	{COINSPARK_ADDRESS_FLAG_PAYMENT_REFS, "payment-refs"},
+	{COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES, "text"},
+	{COINSPARK_ADDRESS_FLAG_FILE_MESSAGES, "file"},
+}
+
+var addressFlagRegistry = struct {
+	sync.RWMutex
+	names map[uint]string // bit number to name
+}{names: map[uint]string{}}
+
+// Claims custom flag bit (4 to 22) under name, so it can be parsed and is shown by String.
+// Registering the same name for the same bit again is allowed. Returns false if the bit is out of
+// range, already registered under another name, or the name is invalid or already in use.
+func RegisterCoinSparkAddressFlag(bit int, name string) (bool, CoinSparkAddressFlags) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if bit < COINSPARK_ADDRESS_FLAG_CUSTOM_BIT_MIN || bit > COINSPARK_ADDRESS_FLAG_CUSTOM_BIT_MAX || !isValidAddressFlagName(name) {
+		return false, 0
+	}
+
+	addressFlagRegistry.Lock()
+	defer addressFlagRegistry.Unlock()
+
+	if existing, found := addressFlagRegistry.names[uint(bit)]; found {
+		return existing == name, CoinSparkAddressFlags(1) << uint(bit)
+	}
+	for _, existing := range addressFlagRegistry.names {
+		if existing == name {
+			return false, 0
+		}
+	}
+
+	addressFlagRegistry.names[uint(bit)] = name
+	return true, CoinSparkAddressFlags(1) << uint(bit)
+}
+
+// Removes a custom flag registration. Returns false if the bit was not registered.
+func UnregisterCoinSparkAddressFlag(bit int) bool {
+	addressFlagRegistry.Lock()
+	defer addressFlagRegistry.Unlock()
+
+	if _, found := addressFlagRegistry.names[uint(bit)]; !found {
+		return false
+	}
+	delete(addressFlagRegistry.names, uint(bit))
+	return true
+}
+
+func isValidAddressFlagName(name string) bool {
+	if name == "" || name == COINSPARK_ADDRESS_FLAG_NONE_NAME || strings.ContainsAny(name, ", \t\r\n\"") {
+		return false
+	}
+	if _, isBit := parseAddressFlagBitName(name); isBit {
+		return false
+	}
+	for _, builtin := range builtinAddressFlagNames {
+		if builtin.name == name {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the bit number of a "bitN" name, and whether name has that form.
+func parseAddressFlagBitName(name string) (uint, bool) {
+	if !strings.HasPrefix(name, COINSPARK_ADDRESS_FLAG_BIT_PREFIX) {
+		return 0, false
+	}
+	bit, err := strconv.ParseUint(name[len(COINSPARK_ADDRESS_FLAG_BIT_PREFIX):], 10, 8)
+	if err != nil || bit >= COINSPARK_ADDRESS_FLAG_BITS {
+		return 0, false
+	}
+	return uint(bit), true
+}
+
+// Returns the name of a single bit: its built-in or registered name, otherwise "bitN".
+func addressFlagBitName(bit uint) string {
+	if name, known := knownAddressFlagBitName(bit); known {
+		return name
+	}
+	return COINSPARK_ADDRESS_FLAG_BIT_PREFIX + strconv.Itoa(int(bit))
+}
+
+// Returns the built-in or registered name of a single bit, and whether it has one.
+func knownAddressFlagBitName(bit uint) (string, bool) {
+	flag := CoinSparkAddressFlags(1) << bit
+	for _, builtin := range builtinAddressFlagNames {
+		if builtin.flag == flag {
+			return builtin.name, true
+		}
+	}
+
+	addressFlagRegistry.RLock()
+	defer addressFlagRegistry.RUnlock()
+	name, found := addressFlagRegistry.names[bit]
+	return name, found
+}
+
+// Parses comma-separated flag names such as "assets,text", which may be built-in names,
+// registered names or "bitN". An empty string or "none" means no flags. Returns false
+// if any name is not recognized.
+func ParseCoinSparkAddressFlags(names string) (bool, CoinSparkAddressFlags) {
+	var flags CoinSparkAddressFlags
+
+	names = strings.TrimSpace(names)
+	if names == "" || strings.EqualFold(names, COINSPARK_ADDRESS_FLAG_NONE_NAME) {
+		return true, 0
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		success, flag := coinSparkAddressFlagByName(name)
+		if !success {
+			return false, 0
+		}
+		flags |= flag
+	}
+
+	return true, flags
+}
+
+func coinSparkAddressFlagByName(name string) (bool, CoinSparkAddressFlags) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	for _, builtin := range builtinAddressFlagNames {
+		if builtin.name == name {
+			return true, builtin.flag
+		}
+	}
+
+	if bit, isBit := parseAddressFlagBitName(name); isBit {
+		return true, CoinSparkAddressFlags(1) << bit
+	}
+
+	addressFlagRegistry.RLock()
+	defer addressFlagRegistry.RUnlock()
+	for bit, registered := range addressFlagRegistry.names {
+		if registered == name {
+			return true, CoinSparkAddressFlags(1) << bit
+		}
+	}
+
+	return false, 0
+}
+
+// Returns true if all the bits in flag are set.
+func (flags CoinSparkAddressFlags) Has(flag CoinSparkAddressFlags) bool {
+	return flags&flag == flag
+}
+
+// Returns the flags with the bits in flag set.
+func (flags CoinSparkAddressFlags) With(flag CoinSparkAddressFlags) CoinSparkAddressFlags {
+	return flags | flag
+}
+
+// Returns the flags with the bits in flag cleared.
+func (flags CoinSparkAddressFlags) Without(flag CoinSparkAddressFlags) CoinSparkAddressFlags {
+	return flags &^ flag
+}
+
+// Returns true if only the bits usable in a CoinSpark address are set.
+func (flags CoinSparkAddressFlags) IsValid() bool {
+	return flags&COINSPARK_ADDRESS_FLAG_MASK == flags
+}
+
+// Returns the set bits which are neither built-in nor registered.
+func (flags CoinSparkAddressFlags) Unknown() CoinSparkAddressFlags {
+	var unknown CoinSparkAddressFlags
+	for _, bit := range flags.bits() {
+		if _, known := knownAddressFlagBitName(bit); !known {
+			unknown |= CoinSparkAddressFlags(1) << bit
+		}
+	}
+	return unknown
+}
+
+// Returns the name of every set bit, in bit order.
+func (flags CoinSparkAddressFlags) Names() []string {
+	names := []string{}
+	for _, bit := range flags.bits() {
+		names = append(names, addressFlagBitName(bit))
+	}
+	return names
+}
+
+// Returns the flags as comma-separated names, which ParseCoinSparkAddressFlags accepts.
+func (flags CoinSparkAddressFlags) String() string {
+	if flags == 0 {
+		return COINSPARK_ADDRESS_FLAG_NONE_NAME
+	}
+	return strings.Join(flags.Names(), ",")
+}
+
+// Returns the numbers of the set bits, in increasing order.
+func (flags CoinSparkAddressFlags) bits() []uint {
+	var bits []uint
+	for bit := uint(0); bit < COINSPARK_ADDRESS_FLAG_BITS; bit++ {
+		if uint32(flags)&(1<<bit) != 0 {
+			bits = append(bits, bit)
+		}
+	}
+	return bits
+}
+
+// Encodes the flags as a JSON array of names.
+func (flags CoinSparkAddressFlags) MarshalJSON() ([]byte, error) {
+	return json.Marshal(flags.Names())
+}
+
+// Decodes the flags from a JSON array of names, or from a plain number. Returns
+// ErrOutOfRange if a bit outside COINSPARK_ADDRESS_FLAG_MASK is set.
+func (flags *CoinSparkAddressFlags) UnmarshalJSON(data []byte) error {
+	var parsed CoinSparkAddressFlags
+	var number int64
+	if json.Unmarshal(data, &number) == nil {
+		if number < 0 || number > COINSPARK_ADDRESS_FLAG_MASK {
+			return ErrOutOfRange{"AddressFlags"}
+		}
+		parsed = CoinSparkAddressFlags(number)
+	} else {
+		var names []string
+		if err := json.Unmarshal(data, &names); err != nil {
+			return err
+		}
+
+		var success bool
+		if success, parsed = ParseCoinSparkAddressFlags(strings.Join(names, ",")); !success {
+			return fmt.Errorf("coinspark: unknown address flag name in %s", data)
+		}
+	}
+
+	if !parsed.IsValid() {
+		return ErrOutOfRange{"AddressFlags"}
+	}
+	*flags = parsed
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddressFlagsHasWithWithout(t *testing.T) {
+	flags := CoinSparkAddressFlags(0).With(COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES)
+	if !flags.Has(COINSPARK_ADDRESS_FLAG_ASSETS) || !flags.Has(COINSPARK_ADDRESS_FLAG_ASSETS|COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES) {
+		t.Errorf("%s does not have the flags it was given", flags)
+	}
+	if flags.Has(COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_PAYMENT_REFS) {
+		t.Errorf("%s has payment-refs", flags)
+	}
+
+	flags = flags.Without(COINSPARK_ADDRESS_FLAG_ASSETS)
+	if flags != COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES {
+		t.Errorf("without assets: %s", flags)
+	}
+	if flags.Without(COINSPARK_ADDRESS_FLAG_FILE_MESSAGES) != flags {
+		t.Error("clearing a bit which is not set changed the flags")
+	}
+}
+
+func TestAddressFlagRegistry(t *testing.T) {
+	success, flag := RegisterCoinSparkAddressFlag(4, "Loyalty")
+	if !success || flag != 1<<4 {
+		t.Fatalf("register bit 4: %v %d", success, flag)
+	}
+	t.Cleanup(func() { UnregisterCoinSparkAddressFlag(4) })
+
+	if success, _ := RegisterCoinSparkAddressFlag(4, "loyalty"); !success {
+		t.Error("registering the same name for the same bit again failed")
+	}
+
+	for _, test := range []struct {
+		bit  int
+		name string
+	}{
+		{4, "points"},    // bit already registered
+		{5, "loyalty"},   // name already registered
+		{3, "files"},     // defined by the specification
+		{23, "wide"},     // outside the address
+		{6, "assets"},    // built-in name
+		{6, "bit6"},      // reserved form
+		{6, "none"},      // reserved name
+		{6, "a,b"},       // not a single name
+		{6, ""},          // empty
+		{22, "last bit"}, // has a space
+	} {
+		if success, _ := RegisterCoinSparkAddressFlag(test.bit, test.name); success {
+			t.Errorf("registered bit %d as %q", test.bit, test.name)
+			UnregisterCoinSparkAddressFlag(test.bit)
+		}
+	}
+
+	if success, flag := RegisterCoinSparkAddressFlag(22, "last"); !success || flag != 1<<22 {
+		t.Errorf("register bit 22: %v %d", success, flag)
+	}
+	if !UnregisterCoinSparkAddressFlag(22) || UnregisterCoinSparkAddressFlag(22) {
+		t.Error("bit 22 did not unregister exactly once")
+	}
+}
+
+func TestAddressFlagsParseString(t *testing.T) {
+	RegisterCoinSparkAddressFlag(4, "loyalty")
+	t.Cleanup(func() { UnregisterCoinSparkAddressFlag(4) })
+
+	flags := CoinSparkAddressFlags(COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES | 1<<4 | 1<<9)
+	if flags.String() != "assets,text,loyalty,bit9" {
+		t.Errorf("String: %s", flags.String())
+	}
+	if flags.Unknown() != 1<<9 {
+		t.Errorf("Unknown: %d", flags.Unknown())
+	}
+
+	for _, test := range []struct {
+		names string
+		flags CoinSparkAddressFlags
+	}{
+		{flags.String(), flags},
+		{" Assets , TEXT ", COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES},
+		{"none", 0},
+		{"", 0},
+		{"bit22", 1 << 22},
+	} {
+		if success, parsed := ParseCoinSparkAddressFlags(test.names); !success || parsed != test.flags {
+			t.Errorf("parse %q: %v %d, want %d", test.names, success, parsed, test.flags)
+		}
+	}
+	if CoinSparkAddressFlags(0).String() != "none" {
+		t.Errorf("no flags: %s", CoinSparkAddressFlags(0).String())
+	}
+
+	for _, names := range []string{"assets,bogus", "bit32", "assets,,text"} {
+		if success, _ := ParseCoinSparkAddressFlags(names); success {
+			t.Errorf("parsed %q", names)
+		}
+	}
+}
+
+func TestAddressFlagsJSON(t *testing.T) {
+	flags := CoinSparkAddressFlags(COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_FILE_MESSAGES | 1<<10)
+	encoded, err := json.Marshal(flags)
+	if err != nil || string(encoded) != `["assets","file","bit10"]` {
+		t.Errorf("marshal: %s %v", encoded, err)
+	}
+
+	for _, data := range []string{string(encoded), "1033", `["bit10", "assets", "file"]`} {
+		var decoded CoinSparkAddressFlags
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil || decoded != flags {
+			t.Errorf("unmarshal %s: %d %v", data, decoded, err)
+		}
+	}
+
+	for _, test := range []struct {
+		data    string
+		wantErr error
+	}{
+		{"8388608", ErrOutOfRange{"AddressFlags"}}, // bit 23
+		{"-1", ErrOutOfRange{"AddressFlags"}},
+		{"4294967296", ErrOutOfRange{"AddressFlags"}},
+		{`["bit23"]`, ErrOutOfRange{"AddressFlags"}},
+		{`["assets","bit31"]`, ErrOutOfRange{"AddressFlags"}},
+	} {
+		decoded := CoinSparkAddressFlags(COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES)
+		if err := json.Unmarshal([]byte(test.data), &decoded); err != test.wantErr {
+			t.Errorf("unmarshal %s: got %v, want %v", test.data, err, test.wantErr)
+		}
+		if decoded != COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES {
+			t.Errorf("unmarshal %s changed the flags to %d", test.data, decoded)
+		}
+	}
+
+	var decoded CoinSparkAddressFlags
+	if err := json.Unmarshal([]byte(`["assets","bogus"]`), &decoded); err == nil {
+		t.Error("unknown name accepted")
+	}
+
+	var address struct{ Flags CoinSparkAddressFlags }
+	if err := json.Unmarshal([]byte(`{"Flags": ["payment-refs"]}`), &address); err != nil || address.Flags != COINSPARK_ADDRESS_FLAG_PAYMENT_REFS {
+		t.Errorf("in a struct: %d %v", address.Flags, err)
+	}
+}
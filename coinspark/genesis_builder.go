@@ -0,0 +1,125 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "math"
+
+// Builds genesis metadata in one step. Quantities are rounded to what the metadata can express,
+// and the asset hash is cut to the space left over, as described in the CoinSpark specification.
+//
+//	builder := NewCoinSparkGenesisBuilder()
+//	builder.Qty = 1234567
+//	builder.DomainName = "example.com"
+//	builder.AssetHash = assetHash[:]
+//	err, metadata, report := builder.Build()
+
+// Parameters for a new asset. Rounding is -1 to round down, 0 to nearest or 1 to round up.
+type CoinSparkGenesisBuilder struct {
+	Qty                CoinSparkAssetQty // quantity to issue
+	QtyRounding        int
+	ChargeFlat         CoinSparkAssetQty // flat charge per transfer, in asset units
+	ChargeFlatRounding int
+	ChargeBasisPoints  int16 // one hundredths of a percent
+	UseHttps           bool
+	DomainName         string
+	UsePrefix          bool // prefix coinspark/ in asset web page URL path
+	PagePath           string
+	AssetHash          []byte // full asset hash, normally 32 bytes from CoinSparkCalcAssetHash
+	MetadataMaxLen     int    // byte budget for the metadata, e.g. 40 for OP_RETURN
+}
+
+// What Build actually encoded.
+type CoinSparkGenesisReport struct {
+	Genesis      *CoinSparkGenesis // nil if the parameters could not be encoded
+	Qty          CoinSparkAssetQty // quantity issued, after rounding
+	ChargeFlat   CoinSparkAssetQty // flat charge, after rounding
+	AssetHashLen int               // bytes of the asset hash kept in the metadata
+	MetadataLen  int
+}
+
+// Returns a builder with the defaults used by CoinSparkGenesis.Clear and a 40 byte budget.
+func NewCoinSparkGenesisBuilder() *CoinSparkGenesisBuilder {
+	p := new(CoinSparkGenesisBuilder)
+	p.UsePrefix = true
+	p.MetadataMaxLen = 40
+	return p
+}
+
+// Rounds the quantities, fits the asset hash to the budget and encodes the genesis. The report
+// gives the rounded quantities and hash length as far as they could be worked out, even if an
+// error is returned explaining why the parameters do not fit. Errors are ErrOutOfRange for a
+// parameter which can never be encoded, ErrBadDomainPath, ErrDomainNameTooLong, or ErrOverBudget
+// if the metadata would fit in a larger budget.
+func (p *CoinSparkGenesisBuilder) Build() (err error, metadata []byte, report CoinSparkGenesisReport) {
+	genesis := new(CoinSparkGenesis)
+	genesis.Clear()
+
+	if p.Qty <= 0 {
+		return ErrOutOfRange{"Qty"}, nil, report
+	}
+	if _, _, exponent := QtyToMantissaExponent(p.Qty, p.QtyRounding, COINSPARK_GENESIS_QTY_MANTISSA_MAX, math.MaxInt16); exponent > COINSPARK_GENESIS_QTY_EXPONENT_MAX {
+		return ErrOutOfRange{"Qty"}, nil, report // SetQty would silently cap the exponent
+	}
+	report.Qty = genesis.SetQty(p.Qty, p.QtyRounding)
+
+	if p.ChargeFlat < 0 || p.ChargeFlat > COINSPARK_GENESIS_CHARGE_FLAT_MAX {
+		return ErrOutOfRange{"ChargeFlat"}, nil, report
+	}
+	report.ChargeFlat = genesis.SetChargeFlat(p.ChargeFlat, p.ChargeFlatRounding)
+
+	if p.ChargeBasisPoints < COINSPARK_GENESIS_CHARGE_BASIS_POINTS_MIN || p.ChargeBasisPoints > COINSPARK_GENESIS_CHARGE_BASIS_POINTS_MAX {
+		return ErrOutOfRange{"ChargeBasisPoints"}, nil, report
+	}
+	genesis.ChargeBasisPoints = p.ChargeBasisPoints
+
+	if err := validateDomainName("DomainName", p.DomainName, COINSPARK_GENESIS_DOMAIN_NAME_MAX_LEN); err != nil {
+		return err, nil, report
+	}
+	if len(p.PagePath) > COINSPARK_GENESIS_PAGE_PATH_MAX_LEN || EncodeDomainAndOrPath(p.DomainName, p.UseHttps, p.PagePath, p.UsePrefix, false) == nil {
+		return ErrBadDomainPath, nil, report
+	}
+	genesis.UseHttps = p.UseHttps
+	genesis.DomainName = p.DomainName
+	genesis.UsePrefix = p.UsePrefix
+	genesis.PagePath = p.PagePath
+
+	if len(p.AssetHash) < COINSPARK_GENESIS_HASH_MIN_LEN {
+		return ErrOutOfRange{"AssetHash"}, nil, report
+	}
+
+	spaceForHash := genesis.CalcHashLen(p.MetadataMaxLen)
+	if spaceForHash < COINSPARK_GENESIS_HASH_MIN_LEN {
+		return ErrOverBudget{p.MetadataMaxLen + COINSPARK_GENESIS_HASH_MIN_LEN - spaceForHash, p.MetadataMaxLen}, nil, report
+	}
+	report.AssetHashLen = COINSPARK_MIN(spaceForHash, len(p.AssetHash))
+	genesis.AssetHash = append([]byte(nil), p.AssetHash[:report.AssetHashLen]...)
+	genesis.AssetHashLen = report.AssetHashLen
+
+	err, metadata = genesis.Encode(p.MetadataMaxLen)
+	if err != nil {
+		report.AssetHashLen = 0
+		return err, nil, report
+	}
+
+	report.Genesis = genesis
+	report.MetadataLen = len(metadata)
+	return nil, metadata, report
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"testing"
+)
+
+func genesisBuilderTestHash() []byte {
+	hash := make([]byte, 32)
+	for i := range hash {
+		hash[i] = byte(i + 1)
+	}
+	return hash
+}
+
+func TestGenesisBuilderRoundTrip(t *testing.T) {
+	builder := NewCoinSparkGenesisBuilder()
+	builder.Qty = 1234567
+	builder.ChargeFlat = 15
+	builder.ChargeBasisPoints = 25
+	builder.DomainName = "example.com"
+	builder.AssetHash = genesisBuilderTestHash()
+
+	err, metadata, report := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != report.MetadataLen || report.MetadataLen > builder.MetadataMaxLen {
+		t.Errorf("metadata is %d bytes, report says %d, budget %d", len(metadata), report.MetadataLen, builder.MetadataMaxLen)
+	}
+
+	var decoded CoinSparkGenesis
+	if err := decoded.DecodeErr(metadata); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Match(report.Genesis, true) {
+		t.Errorf("decoded %s, want %s", decoded.String(), report.Genesis.String())
+	}
+	if decoded.GetQty() != report.Qty || decoded.GetChargeFlat() != report.ChargeFlat {
+		t.Errorf("decoded qty %d charge %d, report says %d and %d", decoded.GetQty(), decoded.GetChargeFlat(), report.Qty, report.ChargeFlat)
+	}
+	if decoded.AssetHashLen != report.AssetHashLen || !bytes.Equal(decoded.AssetHash, builder.AssetHash[:report.AssetHashLen]) {
+		t.Errorf("decoded asset hash %x, want the first %d bytes of %x", decoded.AssetHash, report.AssetHashLen, builder.AssetHash)
+	}
+	if report.AssetHashLen != COINSPARK_MIN(report.Genesis.CalcHashLen(builder.MetadataMaxLen), len(builder.AssetHash)) {
+		t.Errorf("asset hash cut to %d bytes, not the space left over", report.AssetHashLen)
+	}
+}
+
+func TestGenesisBuilderRounding(t *testing.T) {
+	builder := NewCoinSparkGenesisBuilder()
+	builder.DomainName = "example.com"
+	builder.AssetHash = genesisBuilderTestHash()
+	builder.Qty = 1234567891
+
+	for _, rounding := range []int{-1, 0, 1} {
+		builder.QtyRounding = rounding
+		err, _, report := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (rounding < 0 && report.Qty > builder.Qty) || (rounding > 0 && report.Qty < builder.Qty) || report.Qty == builder.Qty {
+			t.Errorf("rounding %d gave %d from %d", rounding, report.Qty, builder.Qty)
+		}
+	}
+}
+
+func TestGenesisBuilderErrors(t *testing.T) {
+	builder := NewCoinSparkGenesisBuilder()
+	builder.Qty = 1000
+	builder.DomainName = "assets-issuer-name.example.com"
+	builder.PagePath = "page"
+	builder.AssetHash = genesisBuilderTestHash()
+	builder.MetadataMaxLen = 30
+
+	err, _, _ := builder.Build()
+	overBudget, isOverBudget := err.(ErrOverBudget)
+	if !isOverBudget {
+		t.Fatalf("got %v, want ErrOverBudget", err)
+	}
+	builder.MetadataMaxLen = overBudget.Needed
+	if err, _, report := builder.Build(); err != nil || report.AssetHashLen != COINSPARK_GENESIS_HASH_MIN_LEN {
+		t.Errorf("budget of %d bytes: %v, asset hash %d bytes", overBudget.Needed, err, report.AssetHashLen)
+	}
+
+	builder.Qty = 0
+	if err, _, _ := builder.Build(); err != (ErrOutOfRange{"Qty"}) {
+		t.Errorf("zero quantity: got %v", err)
+	}
+	builder.Qty = 1000
+	builder.AssetHash = builder.AssetHash[:COINSPARK_GENESIS_HASH_MIN_LEN-1]
+	if err, _, _ := builder.Build(); err != (ErrOutOfRange{"AssetHash"}) {
+		t.Errorf("short asset hash: got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Internationalized domain names. Metadata can only hold the characters in domainPathChars, so
+// Unicode labels are written in punycode (RFC 3492) with the "xn--" prefix by Encode and the
+// builders, which also check the name. Decode leaves names as they are on the blockchain, so call
+// DomainNameToUnicode to display them. Names are lowercased but no other IDNA mapping or
+// normalization is applied, so pass names in the form they are registered in.
+
+const (
+	COINSPARK_IDNA_ACE_PREFIX    = "xn--"
+	COINSPARK_IDNA_LABEL_MAX_LEN = 63
+
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// A domain name which is too long for the metadata once written in ASCII.
+type ErrDomainNameTooLong struct {
+	Field  string // "DomainName" or "ServerHost"
+	ASCII  string // the name as it would be encoded
+	MaxLen int
+}
+
+func (e ErrDomainNameTooLong) Error() string {
+	return fmt.Sprintf("coinspark: %s %q is %d bytes, above the limit of %d", e.Field, e.ASCII, len(e.ASCII), e.MaxLen)
+}
+
+// Converts a domain name to lowercase ASCII, writing each label with non-ASCII characters in
+// punycode. Returns ErrBadDomainPath if a label is empty (other than a final dot) or too long.
+func DomainNameToASCII(domainName string) (err error, asciiName string) {
+	if domainName == "" {
+		return nil, ""
+	}
+
+	labels := strings.Split(strings.ToLower(domainName), ".")
+	for labelIndex, label := range labels {
+		if label == "" {
+			if labelIndex == len(labels)-1 && labelIndex > 0 {
+				continue // fully qualified name ending in a dot
+			}
+			return ErrBadDomainPath, ""
+		}
+
+		if !isASCII(label) {
+			label = COINSPARK_IDNA_ACE_PREFIX + punycodeEncode([]rune(label))
+		}
+		if len(label) > COINSPARK_IDNA_LABEL_MAX_LEN {
+			return ErrBadDomainPath, ""
+		}
+		labels[labelIndex] = label
+	}
+
+	return nil, strings.Join(labels, ".")
+}
+
+// Converts the punycode labels of an ASCII domain name back to Unicode. Labels which are not
+// valid punycode are left as they are.
+func DomainNameToUnicode(asciiName string) string {
+	labels := strings.Split(asciiName, ".")
+	for labelIndex, label := range labels {
+		if len(label) > len(COINSPARK_IDNA_ACE_PREFIX) && strings.EqualFold(label[:len(COINSPARK_IDNA_ACE_PREFIX)], COINSPARK_IDNA_ACE_PREFIX) {
+			if success, decoded := punycodeDecode(strings.ToLower(label[len(COINSPARK_IDNA_ACE_PREFIX):])); success {
+				labels[labelIndex] = decoded
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// Returns the length of a domain name once converted to ASCII, checking it against maxLen.
+func validateDomainName(field string, domainName string, maxLen int) error {
+	err, asciiName := DomainNameToASCII(domainName)
+	if err != nil {
+		return err
+	}
+	if len(asciiName) > maxLen {
+		return ErrDomainNameTooLong{field, asciiName, maxLen}
+	}
+	return nil
+}
+
+// As DomainNameToASCII, but returns the name unchanged if it cannot be converted, for
+// calculations where the error is reported elsewhere.
+func domainNameASCIIOrSame(domainName string) string {
+	if err, asciiName := DomainNameToASCII(domainName); err == nil {
+		return asciiName
+	}
+	return domainName
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func punycodeAdapt(delta int, countPoints int, firstTime bool) int {
+	if firstTime {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / countPoints
+
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeThreshold(k int, bias int) int {
+	switch {
+	case k <= bias:
+		return punycodeTMin
+	case k >= bias+punycodeTMax:
+		return punycodeTMax
+	}
+	return k - bias
+}
+
+func punycodeEncodeDigit(digit int) byte {
+	if digit < 26 {
+		return byte('a' + digit)
+	}
+	return byte('0' + digit - 26)
+}
+
+func punycodeDecodeDigit(char byte) int {
+	switch {
+	case char >= 'a' && char <= 'z':
+		return int(char - 'a')
+	case char >= '0' && char <= '9':
+		return int(char-'0') + 26
+	}
+	return -1
+}
+
+func punycodeEncode(input []rune) string {
+	output := []byte{}
+	for _, char := range input {
+		if char < punycodeInitialN {
+			output = append(output, byte(char))
+		}
+	}
+
+	countBasic := len(output)
+	countHandled := countBasic
+	if countBasic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for countHandled < len(input) {
+		next := rune(utf8.MaxRune + 1)
+		for _, char := range input {
+			if char >= n && char < next {
+				next = char
+			}
+		}
+
+		delta += int(next-n) * (countHandled + 1)
+		n = next
+
+		for _, char := range input {
+			if char < n {
+				delta++
+			}
+			if char == n {
+				q := delta
+				for k := punycodeBase; ; k += punycodeBase {
+					t := punycodeThreshold(k, bias)
+					if q < t {
+						break
+					}
+					output = append(output, punycodeEncodeDigit(t+(q-t)%(punycodeBase-t)))
+					q = (q - t) / (punycodeBase - t)
+				}
+				output = append(output, punycodeEncodeDigit(q))
+				bias = punycodeAdapt(delta, countHandled+1, countHandled == countBasic)
+				delta = 0
+				countHandled++
+			}
+		}
+
+		delta++
+		n++
+	}
+
+	return string(output)
+}
+
+func punycodeDecode(input string) (bool, string) {
+	var output []rune
+	encoded := input
+	if basicEnd := strings.LastIndexByte(input, '-'); basicEnd >= 0 {
+		for i := 0; i < basicEnd; i++ {
+			if input[i] >= punycodeInitialN {
+				return false, ""
+			}
+			output = append(output, rune(input[i]))
+		}
+		encoded = input[basicEnd+1:]
+	}
+
+	n, i, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for pos := 0; pos < len(encoded); {
+		oldI, w := i, 1
+		for k := punycodeBase; ; k += punycodeBase {
+			if pos >= len(encoded) {
+				return false, ""
+			}
+			digit := punycodeDecodeDigit(encoded[pos])
+			pos++
+			if digit < 0 || digit > (utf8.MaxRune-i)/w {
+				return false, ""
+			}
+			i += digit * w
+			t := punycodeThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punycodeBase - t
+		}
+
+		bias = punycodeAdapt(i-oldI, len(output)+1, oldI == 0)
+		n += rune(i / (len(output) + 1))
+		i %= len(output) + 1
+		if n > utf8.MaxRune {
+			return false, ""
+		}
+
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = n
+		i++
+	}
+
+	return true, string(output)
+}
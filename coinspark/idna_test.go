@@ -0,0 +1,74 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Genesis metadata written by the original library, which Decode must keep accepting as it is.
+var idnaDecodeVectors = []struct {
+	metadata   string
+	domainName string
+}{
+	{"53504b6701001652f32700000000000000000000000000", "a..com"},
+	{"53504b6701001695d0ba9fc5ef2700000000000000000000000000", ".example.com"},
+	{"53504b67010000b9e4dc4c01ab04c5525d318be15a3e06000000000000000000000000", "xn--bcher-kva.example"},
+}
+
+func TestGenesisDecodeKeepsDomainName(t *testing.T) {
+	for _, vector := range idnaDecodeVectors {
+		metadata, _ := hex.DecodeString(vector.metadata)
+		genesis := CoinSparkGenesis{}
+		if err := genesis.DecodeErr(metadata); err != nil {
+			t.Fatalf("%s: %v", vector.domainName, err)
+		}
+		if genesis.DomainName != vector.domainName {
+			t.Errorf("decoded %q, want %q", genesis.DomainName, vector.domainName)
+		}
+	}
+}
+
+func TestGenesisEncodeUnicodeDomainName(t *testing.T) {
+	genesis := CoinSparkGenesis{}
+	genesis.Clear()
+	genesis.QtyMantissa = 1
+	genesis.DomainName = "Bücher.example"
+	genesis.AssetHashLen = 12
+	genesis.AssetHash = make([]byte, 32)
+
+	err, metadata := genesis.Encode(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(metadata); got != idnaDecodeVectors[2].metadata {
+		t.Errorf("encoded %s, want %s", got, idnaDecodeVectors[2].metadata)
+	}
+	if DomainNameToUnicode(idnaDecodeVectors[2].domainName) != "bücher.example" {
+		t.Errorf("DomainNameToUnicode(%q) = %q", idnaDecodeVectors[2].domainName, DomainNameToUnicode(idnaDecodeVectors[2].domainName))
+	}
+
+	genesis.DomainName = "a..com"
+	if err, _ := genesis.Encode(40); err != ErrBadDomainPath {
+		t.Errorf("Encode of %q returned %v, want %v", genesis.DomainName, err, ErrBadDomainPath)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"crypto/rand"
+	"io"
+	"sort"
+)
+
+// Builds message metadata in one step. The recipients are given as output indexes and packed
+// into output ranges, and the message hash is cut to the space left over. The salt and the full
+// hash are returned, since the sender needs them to store the message on its server.
+//
+//	builder := NewCoinSparkMessageBuilder()
+//	builder.ServerHost = "msg.example.com"
+//	builder.Recipients = []int{0, 1, 3}
+//	builder.Parts = []CoinSparkMessagePart{{"text/plain", "", []byte("Hello")}}
+//	builder.CountOutputs = 4
+//	err, metadata, report := builder.Build()
+
+const COINSPARK_MESSAGE_SALT_LEN = 32 // bytes of salt read by the builder
+
+type CoinSparkMessageBuilder struct {
+	UseHttps       bool
+	ServerHost     string
+	UsePrefix      bool // prefix coinspark/ in server path
+	ServerPath     string
+	IsPublic       bool
+	Recipients     []int // output indexes which can read the message, in any order
+	Parts          []CoinSparkMessagePart
+	Salt           io.Reader // source of salt, crypto/rand.Reader if nil
+	CountOutputs   int
+	MetadataMaxLen int // byte budget for the metadata, e.g. 40 for OP_RETURN
+}
+
+// What Build actually encoded, and what to send to the message server.
+type CoinSparkMessageReport struct {
+	Message     *CoinSparkMessage // nil if the parameters could not be encoded
+	Salt        []byte
+	FullHash    []byte // from CoinSparkCalcMessageHash, before it is cut to Message.HashLen
+	MetadataLen int
+}
+
+// Returns a builder using the coinspark/ path prefix and a 40 byte budget.
+func NewCoinSparkMessageBuilder() *CoinSparkMessageBuilder {
+	p := new(CoinSparkMessageBuilder)
+	p.UsePrefix = true
+	p.MetadataMaxLen = 40
+	return p
+}
+
+// Packs the recipients, reads the salt, hashes the message and encodes it. Errors are
+// ErrOutOfRange for a parameter which can never be encoded, ErrTooManyRanges if the recipients
+// cannot be packed into COINSPARK_MESSAGE_MAX_IO_RANGES ranges, ErrBadDomainPath,
+// ErrDomainNameTooLong, or ErrOverBudget if the metadata would fit in a larger budget.
+func (p *CoinSparkMessageBuilder) Build() (err error, metadata []byte, report CoinSparkMessageReport) {
+	message := new(CoinSparkMessage)
+
+	if p.CountOutputs <= 0 || p.CountOutputs > COINSPARK_IO_INDEX_MAX+1 {
+		return ErrOutOfRange{"CountOutputs"}, nil, report
+	}
+
+	err, outputRanges := recipientsToRanges(p.Recipients, p.CountOutputs)
+	if err != nil {
+		return err, nil, report
+	}
+	if !p.IsPublic && len(outputRanges) == 0 {
+		return ErrOutOfRange{"Recipients"}, nil, report
+	}
+	message.IsPublic = p.IsPublic
+	message.OutputRanges = outputRanges
+
+	if err := validateDomainName("ServerHost", p.ServerHost, COINSPARK_MESSAGE_SERVER_HOST_MAX_LEN); err != nil {
+		return err, nil, report
+	}
+	if len(p.ServerPath) > COINSPARK_MESSAGE_SERVER_PATH_MAX_LEN || EncodeDomainAndOrPath(p.ServerHost, p.UseHttps, p.ServerPath, p.UsePrefix, true) == nil {
+		return ErrBadDomainPath, nil, report
+	}
+	message.UseHttps = p.UseHttps
+	message.ServerHost = p.ServerHost
+	message.UsePrefix = p.UsePrefix
+	message.ServerPath = p.ServerPath
+
+	hashLen := message.CalcHashLen(p.CountOutputs, p.MetadataMaxLen)
+	if hashLen < COINSPARK_MESSAGE_HASH_MIN_LEN {
+		needed := COINSPARK_MAX(p.MetadataMaxLen, 0)
+		for message.CalcHashLen(p.CountOutputs, needed) < COINSPARK_MESSAGE_HASH_MIN_LEN {
+			needed++
+		}
+		return ErrOverBudget{needed, p.MetadataMaxLen}, nil, report
+	}
+
+	salt := p.Salt
+	if salt == nil {
+		salt = rand.Reader
+	}
+	report.Salt = make([]byte, COINSPARK_MESSAGE_SALT_LEN)
+	if _, err := io.ReadFull(salt, report.Salt); err != nil {
+		report.Salt = nil
+		return err, nil, report
+	}
+
+	report.FullHash = CoinSparkCalcMessageHash(report.Salt, p.Parts)
+	message.Hash = append([]byte(nil), report.FullHash[:hashLen]...)
+	message.HashLen = hashLen
+
+	metadata = message.Encode(p.CountOutputs, p.MetadataMaxLen)
+	if metadata == nil {
+		return message.Validate(), nil, report
+	}
+
+	report.Message = message
+	report.MetadataLen = len(metadata)
+	return nil, metadata, report
+}
+
+// Sorts the output indexes and joins adjacent and repeated ones into the fewest ranges.
+func recipientsToRanges(recipients []int, countOutputs int) (err error, outputRanges []CoinSparkIORange) {
+	sorted := append([]int(nil), recipients...)
+	sort.Ints(sorted)
+
+	for _, outputIndex := range sorted {
+		if outputIndex < 0 || outputIndex >= countOutputs {
+			return ErrOutOfRange{"Recipients"}, nil
+		}
+		last := len(outputRanges) - 1
+		if last >= 0 && outputIndex <= int(outputRanges[last].First+outputRanges[last].Count) {
+			outputRanges[last].Count = CoinSparkIOIndex(outputIndex) - outputRanges[last].First + 1
+		} else {
+			outputRanges = append(outputRanges, CoinSparkIORange{CoinSparkIOIndex(outputIndex), 1})
+		}
+	}
+
+	if len(outputRanges) > COINSPARK_MESSAGE_MAX_IO_RANGES {
+		return ErrTooManyRanges, nil
+	}
+	return nil, outputRanges
+}
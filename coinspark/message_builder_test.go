@@ -0,0 +1,122 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func messageBuilderTestBuilder() *CoinSparkMessageBuilder {
+	builder := NewCoinSparkMessageBuilder()
+	builder.ServerHost = "msg.example.com"
+	builder.Recipients = []int{3, 0, 1, 1}
+	builder.Parts = []CoinSparkMessagePart{{"text/plain", "", []byte("Hello")}}
+	builder.Salt = bytes.NewReader(bytes.Repeat([]byte{0x5a}, COINSPARK_MESSAGE_SALT_LEN))
+	builder.CountOutputs = 5
+	return builder
+}
+
+func TestMessageBuilderRoundTrip(t *testing.T) {
+	builder := messageBuilderTestBuilder()
+	err, metadata, report := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(report.Salt, bytes.Repeat([]byte{0x5a}, COINSPARK_MESSAGE_SALT_LEN)) {
+		t.Errorf("salt %x was not read from the builder's source", report.Salt)
+	}
+	if !bytes.Equal(report.FullHash, CoinSparkCalcMessageHash(report.Salt, builder.Parts)) {
+		t.Error("full hash does not match CoinSparkCalcMessageHash")
+	}
+	if len(metadata) != report.MetadataLen || report.MetadataLen > builder.MetadataMaxLen {
+		t.Errorf("metadata is %d bytes, report says %d", len(metadata), report.MetadataLen)
+	}
+
+	var decoded CoinSparkMessage
+	if err := decoded.DecodeErr(metadata, builder.CountOutputs); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Match(report.Message, true) {
+		t.Errorf("decoded %s, want %s", decoded.String(), report.Message.String())
+	}
+	if want := []CoinSparkIORange{{0, 2}, {3, 1}}; !reflect.DeepEqual(decoded.OutputRanges, want) {
+		t.Errorf("recipients packed into %v, want %v", decoded.OutputRanges, want)
+	}
+	if decoded.HashLen != report.Message.CalcHashLen(builder.CountOutputs, builder.MetadataMaxLen) ||
+		!bytes.Equal(decoded.Hash[:decoded.HashLen], report.FullHash[:decoded.HashLen]) {
+		t.Errorf("hash %x is not the full hash cut to the space left over", decoded.Hash)
+	}
+}
+
+func TestMessageBuilderRecipients(t *testing.T) {
+	builder := messageBuilderTestBuilder()
+	builder.Recipients = nil
+	if err, _, _ := builder.Build(); err != (ErrOutOfRange{"Recipients"}) {
+		t.Errorf("private message without recipients: got %v", err)
+	}
+
+	builder = messageBuilderTestBuilder()
+	builder.Recipients = nil
+	builder.IsPublic = true
+	if err, _, report := builder.Build(); err != nil || len(report.Message.OutputRanges) != 0 {
+		t.Errorf("public message without recipients: %v", err)
+	}
+
+	builder = messageBuilderTestBuilder()
+	builder.Recipients = []int{5}
+	if err, _, _ := builder.Build(); err != (ErrOutOfRange{"Recipients"}) {
+		t.Errorf("recipient beyond the outputs: got %v", err)
+	}
+
+	builder = messageBuilderTestBuilder()
+	builder.CountOutputs = 2 * (COINSPARK_MESSAGE_MAX_IO_RANGES + 1)
+	builder.Recipients = nil
+	for outputIndex := 0; outputIndex < builder.CountOutputs; outputIndex += 2 {
+		builder.Recipients = append(builder.Recipients, outputIndex)
+	}
+	if err, _, _ := builder.Build(); err != ErrTooManyRanges {
+		t.Errorf("%d separate recipients: got %v", len(builder.Recipients), err)
+	}
+}
+
+func TestMessageBuilderOverBudget(t *testing.T) {
+	builder := messageBuilderTestBuilder()
+	builder.ServerPath = "messages"
+	builder.MetadataMaxLen = 20
+
+	err, _, _ := builder.Build()
+	overBudget, isOverBudget := err.(ErrOverBudget)
+	if !isOverBudget {
+		t.Fatalf("got %v, want ErrOverBudget", err)
+	}
+
+	builder.MetadataMaxLen = overBudget.Needed
+	err, _, report := builder.Build()
+	if err != nil {
+		t.Fatalf("budget of %d bytes: %v", overBudget.Needed, err)
+	}
+	if report.Message.HashLen != COINSPARK_MESSAGE_HASH_MIN_LEN {
+		t.Errorf("budget of %d bytes leaves a %d byte hash, want %d", overBudget.Needed, report.Message.HashLen, COINSPARK_MESSAGE_HASH_MIN_LEN)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Sends and receives messages through a message server. Calls which fail in transit, or with an
+// HTTP 5xx or 429 status, are retried with increasing delays, until Retries is used up or ctx is
+// done. Set a deadline on ctx to limit the time a call may take. The server accepts each nonce
+// only once, so Store and Retrieve retry by getting and signing a new one.
+//
+//	client := NewCoinSparkMessageServerClient(message.CalcServerURL(), signer)
+//	err := client.Store(ctx, &CoinSparkMessageSend{Sender: address, TxID: txID, ...})
+//	err, received := client.Retrieve(ctx, txID, recipient)
+
+const COINSPARK_MESSAGE_RESPONSE_MAX_BYTES = 64 * 1024 * 1024
+
+// Sends HTTP requests, as *http.Client does.
+type CoinSparkHTTPDoer interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// Signs a nonce from the message server with the private key of a bitcoin address, as bitcoind's
+// signmessage does. Returns the public key in hex and the signature in base64.
+type CoinSparkSigner interface {
+	SignMessage(ctx context.Context, address string, message string) (err error, pubKey string, signature string)
+}
+
+type CoinSparkMessageServerClient struct {
+	ServerURL  string
+	HTTP       CoinSparkHTTPDoer // http.DefaultClient if nil
+	Signer     CoinSparkSigner
+	Testnet    bool // addresses are on testnet
+	Retries    int  // further attempts after a call, or Store or Retrieve, fails in transit
+	RetryDelay time.Duration
+
+	requestID int64
+}
+
+// A message for the server to keep and give to its recipients.
+type CoinSparkMessageSend struct {
+	Sender      string   // bitcoin address of an input of the transaction, which signs the nonce
+	TxID        string   // the transaction holding the message metadata
+	IsPublic    bool     // anyone may read the message
+	Recipients  []string // bitcoin addresses of the outputs which may read it
+	KeepSeconds int      // how long the server should keep the message
+	Salt        []byte   // as returned by CoinSparkMessageBuilder
+	Parts       []CoinSparkMessagePart
+}
+
+type CoinSparkMessageReceived struct {
+	Salt  []byte
+	Parts []CoinSparkMessagePart
+}
+
+// Returns a client which retries twice, after one and then two seconds.
+func NewCoinSparkMessageServerClient(serverURL string, signer CoinSparkSigner) *CoinSparkMessageServerClient {
+	p := new(CoinSparkMessageServerClient)
+	p.ServerURL = serverURL
+	p.Signer = signer
+	p.Retries = 2
+	p.RetryDelay = time.Second
+	return p
+}
+
+// Asks the server whether it will accept the message, returning the nonce to sign.
+func (p *CoinSparkMessageServerClient) PreStore(ctx context.Context, send *CoinSparkMessageSend) (err error, nonce string) {
+	var result messagePreStoreResult
+	if err := p.call(ctx, COINSPARK_MESSAGE_METHOD_PRE_STORE, p.preStoreParams(send, false), &result); err != nil {
+		return err, ""
+	}
+	return nil, result.Nonce
+}
+
+// Uploads the message, getting a nonce as PreStore does and signing it with the sender's key.
+func (p *CoinSparkMessageServerClient) Store(ctx context.Context, send *CoinSparkMessageSend) error {
+	return p.retry(ctx, func() (err error, retry bool) {
+		var preStore messagePreStoreResult
+		if err, retry := p.callOnce(ctx, COINSPARK_MESSAGE_METHOD_PRE_STORE, p.preStoreParams(send, false), &preStore); err != nil {
+			return err, retry
+		}
+
+		err, pubKey, signature := p.sign(ctx, send.Sender, preStore.Nonce)
+		if err != nil {
+			return err, false
+		}
+
+		params := messageStoreParams{p.preStoreParams(send, true), preStore.Nonce, pubKey, signature, send.TxID}
+		return p.callOnce(ctx, COINSPARK_MESSAGE_METHOD_STORE, params, nil)
+	})
+}
+
+// Asks the server whether recipient may read the message in txID, returning the nonce to sign.
+func (p *CoinSparkMessageServerClient) PreRetrieve(ctx context.Context, txID string, recipient string) (err error, nonce string) {
+	var result messagePreRetrieveResult
+	if err := p.call(ctx, COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE, messagePreRetrieveParams{p.Testnet, txID, recipient}, &result); err != nil {
+		return err, ""
+	}
+	return nil, result.Nonce
+}
+
+// Downloads the message in txID for recipient, getting a nonce as PreRetrieve does and signing it
+// with the recipient's key. Check the result against the metadata with CheckHash.
+func (p *CoinSparkMessageServerClient) Retrieve(ctx context.Context, txID string, recipient string) (err error, received *CoinSparkMessageReceived) {
+	preRetrieveParams := messagePreRetrieveParams{p.Testnet, txID, recipient}
+	var result messageRetrieveResult
+	err = p.retry(ctx, func() (err error, retry bool) {
+		var preRetrieve messagePreRetrieveResult
+		if err, retry := p.callOnce(ctx, COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE, preRetrieveParams, &preRetrieve); err != nil {
+			return err, retry
+		}
+
+		err, pubKey, signature := p.sign(ctx, recipient, preRetrieve.Nonce)
+		if err != nil {
+			return err, false
+		}
+
+		params := messageRetrieveParams{preRetrieveParams, preRetrieve.Nonce, pubKey, signature}
+		return p.callOnce(ctx, COINSPARK_MESSAGE_METHOD_RETRIEVE, params, &result)
+	})
+	if err != nil {
+		return err, nil
+	}
+	return nil, &CoinSparkMessageReceived{result.Salt, messagePartsFromJSON(result.Message)}
+}
+
+// Returns true if the salt and parts match the hash in the message metadata.
+func (p *CoinSparkMessageReceived) CheckHash(message *CoinSparkMessage) bool {
+	if message.HashLen < COINSPARK_MESSAGE_HASH_MIN_LEN || len(message.Hash) < message.HashLen {
+		return false
+	}
+	hash := CoinSparkCalcMessageHash(p.Salt, p.Parts)
+	return bytes.Equal(hash[:message.HashLen], message.Hash[:message.HashLen])
+}
+
+func (p *CoinSparkMessageServerClient) preStoreParams(send *CoinSparkMessageSend, withContent bool) messagePreStoreParams {
+	recipients := send.Recipients
+	if recipients == nil {
+		recipients = []string{}
+	}
+	return messagePreStoreParams{p.Testnet, send.Sender, send.IsPublic, recipients, send.KeepSeconds, send.Salt, messagePartsToJSON(send.Parts, withContent)}
+}
+
+func (p *CoinSparkMessageServerClient) sign(ctx context.Context, address string, nonce string) (err error, pubKey string, signature string) {
+	if p.Signer == nil {
+		return fmt.Errorf("coinspark: no signer for message server nonce"), "", ""
+	}
+	return p.Signer.SignMessage(ctx, address, nonce)
+}
+
+// Makes a JSON-RPC call which does not use a nonce, retrying failures in transit, and decodes the
+// result if it is not nil.
+func (p *CoinSparkMessageServerClient) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	return p.retry(ctx, func() (err error, retry bool) {
+		return p.callOnce(ctx, method, params, result)
+	})
+}
+
+// Runs attempt until it succeeds, fails in a way not worth retrying, Retries is used up or ctx is
+// done, doubling the delay after each failure.
+func (p *CoinSparkMessageServerClient) retry(ctx context.Context, attempt func() (err error, retry bool)) error {
+	delay := p.RetryDelay
+	for attemptIndex := 0; ; attemptIndex++ {
+		err, retry := attempt()
+		if err == nil || !retry || attemptIndex >= p.Retries {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// Makes one JSON-RPC call, saying whether a failure is worth retrying, and decodes the result if
+// it is not nil.
+func (p *CoinSparkMessageServerClient) callOnce(ctx context.Context, method string, params interface{}, result interface{}) (err error, retry bool) {
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return err, false
+	}
+	body, err := json.Marshal(messageRPCRequest{"2.0", atomic.AddInt64(&p.requestID, 1), method, encodedParams})
+	if err != nil {
+		return err, false
+	}
+
+	err, response, retry := p.post(ctx, body)
+	if err != nil {
+		return err, retry
+	}
+	if response.Error != nil {
+		return ErrMessageServer{response.Error.Code, response.Error.Message}, false
+	}
+	if result != nil {
+		return json.Unmarshal(response.Result, result), false
+	}
+	return nil, false
+}
+
+// Posts one request, saying whether a failure is worth retrying.
+func (p *CoinSparkMessageServerClient) post(ctx context.Context, body []byte) (err error, response *messageRPCResponse, retry bool) {
+	doer := p.HTTP
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.ServerURL, bytes.NewReader(body))
+	if err != nil {
+		return err, nil, false
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	httpResponse, err := doer.Do(request)
+	if err != nil {
+		return err, nil, ctx.Err() == nil
+	}
+	defer httpResponse.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(httpResponse.Body, COINSPARK_MESSAGE_RESPONSE_MAX_BYTES))
+	if err != nil {
+		return err, nil, ctx.Err() == nil
+	}
+
+	response = new(messageRPCResponse)
+	if err := json.Unmarshal(content, response); err == nil && (response.Error != nil || response.Result != nil) {
+		return nil, response, false // even with an error status, the server has answered
+	}
+
+	retry = httpResponse.StatusCode >= http.StatusInternalServerError || httpResponse.StatusCode == http.StatusTooManyRequests
+	return fmt.Errorf("coinspark: message server %s: %s with no JSON-RPC response", p.ServerURL, httpResponse.Status), nil, retry
+}
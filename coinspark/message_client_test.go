@@ -0,0 +1,303 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Signs by writing out the address and message, which messageTestVerifier checks.
+type messageTestSigner struct {
+	forge bool // sign as another address
+}
+
+func (p messageTestSigner) SignMessage(ctx context.Context, address string, message string) (err error, pubKey string, signature string) {
+	if p.forge {
+		address = messageTestAddress(99)
+	}
+	return nil, "02" + hex.EncodeToString(make([]byte, 32)), "signed " + address + " " + message
+}
+
+type messageTestVerifier struct{}
+
+func (messageTestVerifier) VerifyMessage(ctx context.Context, address string, message string, pubKey string, signature string) (err error, valid bool) {
+	return nil, signature == "signed "+address+" "+message
+}
+
+type messageTestTxSource struct {
+	mutex sync.Mutex
+	txs   map[string]*CoinSparkMessageTx
+}
+
+func (p *messageTestTxSource) GetMessageTx(ctx context.Context, txID string) (error, *CoinSparkMessageTx) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return nil, p.txs[txID]
+}
+
+func (p *messageTestTxSource) add(txID string, tx *CoinSparkMessageTx) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.txs == nil {
+		p.txs = map[string]*CoinSparkMessageTx{}
+	}
+	p.txs[txID] = tx
+}
+
+func messageTestHash160(index int) (hash160 [COINSPARK_HASH160_LEN]byte) {
+	hash160[0] = byte(index + 1)
+	return hash160
+}
+
+func messageTestAddress(index int) string {
+	return mainNet.EncodeBitcoinAddress(COINSPARK_ADDRESS_TYPE_P2PKH, messageTestHash160(index))
+}
+
+// Builds a transaction sent by messageTestAddress(100), whose message is for outputs 0, 1 and 3,
+// along with what its sender uploads.
+func messageTestTx(t *testing.T, isPublic bool) (*CoinSparkMessageTx, *CoinSparkMessageSend) {
+	builder := messageBuilderTestBuilder()
+	builder.IsPublic = isPublic
+	err, metadata, report := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := &CoinSparkMessageTx{InputAddresses: []string{messageTestAddress(100)}}
+	for outputIndex := 0; outputIndex < builder.CountOutputs-1; outputIndex++ {
+		hash160 := messageTestHash160(outputIndex)
+		tx.OutputScripts = append(tx.OutputScripts, "76a914"+hex.EncodeToString(hash160[:])+"88ac")
+	}
+	tx.OutputScripts = append(tx.OutputScripts, MetadataToScript(metadata, true))
+
+	send := &CoinSparkMessageSend{
+		Sender:     messageTestAddress(100),
+		TxID:       assetVerifierTestTxID,
+		IsPublic:   isPublic,
+		Recipients: []string{messageTestAddress(0), messageTestAddress(1), messageTestAddress(3)},
+		Salt:       report.Salt,
+		Parts:      builder.Parts,
+	}
+	return tx, send
+}
+
+func messageTestServer() (*CoinSparkMessageServer, *messageTestTxSource) {
+	txs := new(messageTestTxSource)
+	return NewCoinSparkMessageServer(nil, txs, messageTestVerifier{}), txs
+}
+
+func messageTestClient(t *testing.T, handler http.Handler) *CoinSparkMessageServerClient {
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+	client := NewCoinSparkMessageServerClient(httpServer.URL, messageTestSigner{})
+	client.RetryDelay = time.Millisecond
+	return client
+}
+
+// Passes requests on to handler, first answering with failStatus for the methods in failures,
+// each time they appear, and noting the method and nonce of every request.
+type messageTestFlakyHandler struct {
+	handler    http.Handler
+	failStatus int
+
+	mutex    sync.Mutex
+	failures map[string]int
+	methods  []string
+	nonces   []string
+}
+
+func (p *messageTestFlakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var request messageRPCRequest
+	var params struct {
+		Nonce string `json:"nonce"`
+	}
+	json.Unmarshal(body, &request)
+	json.Unmarshal(request.Params, &params)
+
+	p.mutex.Lock()
+	p.methods = append(p.methods, request.Method)
+	p.nonces = append(p.nonces, params.Nonce)
+	fail := p.failures[request.Method] > 0
+	if fail {
+		p.failures[request.Method]--
+	}
+	p.mutex.Unlock()
+
+	if fail {
+		http.Error(w, "try again later", p.failStatus)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	p.handler.ServeHTTP(w, r)
+}
+
+func TestMessageClientStoreRetrieve(t *testing.T) {
+	server, txs := messageTestServer()
+	tx, send := messageTestTx(t, false)
+	txs.add(send.TxID, tx)
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+
+	err, received := client.Retrieve(ctx, send.TxID, messageTestAddress(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received.Salt, send.Salt) || !reflect.DeepEqual(received.Parts, send.Parts) {
+		t.Errorf("retrieved %+v, stored %+v", received, send)
+	}
+
+	var message CoinSparkMessage
+	if !message.Decode(ScriptsToMetadata(tx.OutputScripts, true), len(tx.OutputScripts)) || !received.CheckHash(&message) {
+		t.Error("retrieved message does not match the hash in the metadata")
+	}
+}
+
+func TestMessageClientServerErrors(t *testing.T) {
+	server, txs := messageTestServer()
+	tx, send := messageTestTx(t, false)
+	txs.add(send.TxID, tx)
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	expectCode := func(what string, err error, code int) {
+		t.Helper()
+		var serverErr ErrMessageServer
+		if !errors.As(err, &serverErr) || serverErr.Code != code {
+			t.Errorf("%s: got %v, want code %d", what, err, code)
+		}
+	}
+
+	err, _ := client.Retrieve(ctx, send.TxID, messageTestAddress(3))
+	expectCode("nothing stored", err, COINSPARK_MESSAGE_ERR_MESSAGE_NOT_FOUND)
+
+	client.Signer = messageTestSigner{forge: true}
+	expectCode("forged signature", client.Store(ctx, send), COINSPARK_MESSAGE_ERR_SIGNATURE)
+
+	client.Signer = messageTestSigner{}
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+	err, _ = client.Retrieve(ctx, send.TxID, messageTestAddress(2))
+	expectCode("output 2", err, COINSPARK_MESSAGE_ERR_NOT_RECIPIENT)
+
+	client.Testnet = true
+	err, _ = client.Retrieve(ctx, send.TxID, messageTestAddress(3))
+	expectCode("testnet", err, COINSPARK_MESSAGE_ERR_INVALID_PARAMS)
+}
+
+func TestMessageClientRetriesWithNewNonce(t *testing.T) {
+	for _, failStatus := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		server, txs := messageTestServer()
+		tx, send := messageTestTx(t, false)
+		txs.add(send.TxID, tx)
+		flaky := &messageTestFlakyHandler{handler: server, failStatus: failStatus, failures: map[string]int{
+			COINSPARK_MESSAGE_METHOD_STORE:        1,
+			COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE: 1,
+			COINSPARK_MESSAGE_METHOD_RETRIEVE:     1,
+		}}
+		client := messageTestClient(t, flaky)
+
+		if err := client.Store(context.Background(), send); err != nil {
+			t.Fatalf("status %d: %v", failStatus, err)
+		}
+		if err, _ := client.Retrieve(context.Background(), send.TxID, messageTestAddress(0)); err != nil {
+			t.Fatalf("status %d: %v", failStatus, err)
+		}
+
+		// The failed store and retrieve are tried again from the start, the failed pre-retrieve alone.
+		wantMethods := []string{
+			COINSPARK_MESSAGE_METHOD_PRE_STORE, COINSPARK_MESSAGE_METHOD_STORE,
+			COINSPARK_MESSAGE_METHOD_PRE_STORE, COINSPARK_MESSAGE_METHOD_STORE,
+			COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE,
+			COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE, COINSPARK_MESSAGE_METHOD_RETRIEVE,
+			COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE, COINSPARK_MESSAGE_METHOD_RETRIEVE,
+		}
+		if !reflect.DeepEqual(flaky.methods, wantMethods) {
+			t.Errorf("status %d: calls %v, want %v", failStatus, flaky.methods, wantMethods)
+		}
+		if flaky.nonces[1] == flaky.nonces[3] || flaky.nonces[6] == flaky.nonces[8] {
+			t.Errorf("status %d: nonces %v were reused", failStatus, flaky.nonces)
+		}
+	}
+}
+
+func TestMessageClientRetriesRunOut(t *testing.T) {
+	server, _ := messageTestServer()
+	flaky := &messageTestFlakyHandler{handler: server, failStatus: http.StatusBadGateway, failures: map[string]int{
+		COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE: 10,
+	}}
+	client := messageTestClient(t, flaky)
+	client.Retries = 3
+
+	if err, _ := client.PreRetrieve(context.Background(), assetVerifierTestTxID, messageTestAddress(0)); err == nil {
+		t.Fatal("no error after the retries ran out")
+	}
+	if len(flaky.methods) != 1+client.Retries {
+		t.Errorf("%d requests, want %d", len(flaky.methods), 1+client.Retries)
+	}
+
+	flaky.failStatus = http.StatusBadRequest
+	flaky.methods = nil
+	if err, _ := client.PreRetrieve(context.Background(), assetVerifierTestTxID, messageTestAddress(0)); err == nil || len(flaky.methods) != 1 {
+		t.Errorf("status 400: %d requests and error %v, want 1 request", len(flaky.methods), err)
+	}
+}
+
+func TestMessageClientStopsWithContext(t *testing.T) {
+	server, _ := messageTestServer()
+	flaky := &messageTestFlakyHandler{handler: server, failStatus: http.StatusServiceUnavailable, failures: map[string]int{
+		COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE: 10,
+	}}
+	client := messageTestClient(t, flaky)
+	client.Retries = 10
+	client.RetryDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err, _ := client.Retrieve(ctx, assetVerifierTestTxID, messageTestAddress(0)); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err, _ := client.Retrieve(ctx, assetVerifierTestTxID, messageTestAddress(0)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("deadline: got %v", err)
+	}
+	if len(flaky.methods) != 2 {
+		t.Errorf("%d requests, want one before each context was done", len(flaky.methods))
+	}
+}
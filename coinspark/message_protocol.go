@@ -0,0 +1,150 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "encoding/json"
+
+// The JSON-RPC 2.0 protocol spoken between wallets and a message server, at the URL from
+// CoinSparkMessage.CalcServerURL. The sender asks for a nonce with coinspark_message_pre_store,
+// signs it with the key of its address, and uploads the salt and message parts with
+// coinspark_message_store. A recipient does the same with coinspark_message_pre_retrieve and
+// coinspark_message_retrieve to download them. Binary fields travel in base64.
+
+const (
+	COINSPARK_MESSAGE_METHOD_PRE_STORE    = "coinspark_message_pre_store"
+	COINSPARK_MESSAGE_METHOD_STORE        = "coinspark_message_store"
+	COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE = "coinspark_message_pre_retrieve"
+	COINSPARK_MESSAGE_METHOD_RETRIEVE     = "coinspark_message_retrieve"
+)
+
+// Error codes in JSON-RPC responses. The first five are defined by JSON-RPC 2.0, the rest are
+// those used by CoinSparkMessageServer. Other servers may return codes of their own, which
+// are kept in ErrMessageServer.Code.
+const (
+	COINSPARK_MESSAGE_ERR_PARSE            = -32700
+	COINSPARK_MESSAGE_ERR_INVALID_REQUEST  = -32600
+	COINSPARK_MESSAGE_ERR_METHOD_NOT_FOUND = -32601
+	COINSPARK_MESSAGE_ERR_INVALID_PARAMS   = -32602
+	COINSPARK_MESSAGE_ERR_INTERNAL         = -32603
+
+	COINSPARK_MESSAGE_ERR_SENDER_REJECTED   = -10000 // the server does not accept messages from this sender
+	COINSPARK_MESSAGE_ERR_NONCE_NOT_FOUND   = -10001 // unknown or expired nonce, start again from pre_store or pre_retrieve
+	COINSPARK_MESSAGE_ERR_SIGNATURE         = -10002 // the nonce was not signed by the key of the address
+	COINSPARK_MESSAGE_ERR_TX_NOT_FOUND      = -10003 // the transaction is not known yet, try again later
+	COINSPARK_MESSAGE_ERR_NOT_RECIPIENT     = -10004 // the address may not read this message
+	COINSPARK_MESSAGE_ERR_MESSAGE_NOT_FOUND = -10005 // never stored, or no longer kept
+	COINSPARK_MESSAGE_ERR_TOO_LARGE         = -10006
+	COINSPARK_MESSAGE_ERR_HASH_MISMATCH     = -10007 // salt and parts do not match the hash in the transaction
+)
+
+type messageRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      interface{}     `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type messageRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type messageRPCResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      interface{}      `json:"id"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *messageRPCError `json:"error,omitempty"`
+}
+
+// A message part on the wire. Pre-store gives only the size of the content in Bytes.
+type messagePartJSON struct {
+	MimeType string `json:"mimetype"`
+	FileName string `json:"filename"`
+	Content  []byte `json:"content,omitempty"`
+	Bytes    int    `json:"bytes,omitempty"`
+}
+
+type messagePreStoreParams struct {
+	Testnet     bool              `json:"testnet"`
+	Sender      string            `json:"sender"`
+	IsPublic    bool              `json:"ispublic"`
+	Recipients  []string          `json:"recipients"`
+	KeepSeconds int               `json:"keepseconds"`
+	Salt        []byte            `json:"salt"`
+	Message     []messagePartJSON `json:"message"`
+}
+
+type messagePreStoreResult struct {
+	Sender string `json:"sender"`
+	Nonce  string `json:"nonce"`
+}
+
+type messageStoreParams struct {
+	messagePreStoreParams
+	Nonce     string `json:"nonce"`
+	PubKey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+	TxID      string `json:"txid"`
+}
+
+type messagePreRetrieveParams struct {
+	Testnet   bool   `json:"testnet"`
+	TxID      string `json:"txid"`
+	Recipient string `json:"recipient"`
+}
+
+type messagePreRetrieveResult struct {
+	Recipient string `json:"recipient"`
+	Nonce     string `json:"nonce"`
+}
+
+type messageRetrieveParams struct {
+	messagePreRetrieveParams
+	Nonce     string `json:"nonce"`
+	PubKey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+type messageRetrieveResult struct {
+	Salt    []byte            `json:"salt"`
+	Message []messagePartJSON `json:"message"`
+}
+
+func messagePartsToJSON(parts []CoinSparkMessagePart, withContent bool) []messagePartJSON {
+	result := make([]messagePartJSON, len(parts))
+	for partIndex, part := range parts {
+		result[partIndex] = messagePartJSON{MimeType: part.MimeType, FileName: part.FileName}
+		if withContent {
+			result[partIndex].Content = part.Content
+		} else {
+			result[partIndex].Bytes = len(part.Content)
+		}
+	}
+	return result
+}
+
+func messagePartsFromJSON(parts []messagePartJSON) []CoinSparkMessagePart {
+	result := make([]CoinSparkMessagePart, len(parts))
+	for partIndex, part := range parts {
+		result[partIndex] = CoinSparkMessagePart{part.MimeType, part.FileName, part.Content}
+	}
+	return result
+}
@@ -0,0 +1,634 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A message server speaking the protocol in message_protocol.go. Uploads are accepted before the
+// transaction with the message metadata is known, and held until it shows up. Then the salt and
+// parts are checked against the hash in the metadata, and the sender against the addresses spent
+// by the transaction. Only the outputs in the message's OutputRanges may retrieve it, unless it
+// is public. Messages are deleted once kept for as long as the sender asked, up to MaxKeepSeconds.
+// A message still waiting for its transaction may be replaced, but only by its sender. Each
+// message is checked and updated by one request at a time, so servers sharing a
+// CoinSparkMessageStore should each handle their own txids.
+//
+//	server := NewCoinSparkMessageServer(nil, txSource, signatureVerifier)
+//	http.Handle("/coinspark/", server)
+//	go func() { for range time.Tick(time.Minute) { server.Sweep(ctx) } }()
+
+const (
+	COINSPARK_MESSAGE_SERVER_MAX_KEEP_SECONDS = 30 * 24 * 60 * 60
+	COINSPARK_MESSAGE_SERVER_PENDING_SECONDS  = 24 * 60 * 60
+	COINSPARK_MESSAGE_SERVER_NONCE_SECONDS    = 10 * 60
+	COINSPARK_MESSAGE_SERVER_MAX_NONCES       = 100000
+	COINSPARK_MESSAGE_SERVER_MAX_BYTES        = 1024 * 1024
+)
+
+// A message held by the server.
+type CoinSparkStoredMessage struct {
+	TxID        string
+	Sender      string
+	IsPublic    bool
+	Recipients  []string // as given by the sender, OutputRanges in the metadata are what count
+	KeepSeconds int
+	Salt        []byte
+	Parts       []CoinSparkMessagePart
+	Confirmed   bool      // the transaction was found and matches
+	Expires     time.Time // when to delete the message, or give up waiting for the transaction
+}
+
+// Keeps messages by txid. Get returns nil if there is no message for the txid.
+type CoinSparkMessageStore interface {
+	Get(txID string) (error, *CoinSparkStoredMessage)
+	Put(message *CoinSparkStoredMessage) error
+	Delete(txID string) error
+	TxIDs() (error, []string)
+}
+
+// The parts of a transaction needed to check a message.
+type CoinSparkMessageTx struct {
+	InputAddresses []string // bitcoin addresses spent by the inputs
+	OutputScripts  []string // scriptPubKey of each output, in hex
+}
+
+// Looks up transactions, returning nil if the txid is not known yet.
+type CoinSparkMessageTxSource interface {
+	GetMessageTx(ctx context.Context, txID string) (error, *CoinSparkMessageTx)
+}
+
+// Checks a signature made by CoinSparkSigner, as bitcoind's verifymessage does.
+type CoinSparkSignatureVerifier interface {
+	VerifyMessage(ctx context.Context, address string, message string, pubKey string, signature string) (err error, valid bool)
+}
+
+type CoinSparkMemoryMessageStore struct {
+	mutex    sync.RWMutex
+	messages map[string]*CoinSparkStoredMessage
+}
+
+func NewCoinSparkMemoryMessageStore() *CoinSparkMemoryMessageStore {
+	return &CoinSparkMemoryMessageStore{messages: map[string]*CoinSparkStoredMessage{}}
+}
+
+func (p *CoinSparkMemoryMessageStore) Get(txID string) (error, *CoinSparkStoredMessage) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return nil, copyStoredMessage(p.messages[txID])
+}
+
+func (p *CoinSparkMemoryMessageStore) Put(message *CoinSparkStoredMessage) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.messages[message.TxID] = copyStoredMessage(message)
+	return nil
+}
+
+func (p *CoinSparkMemoryMessageStore) Delete(txID string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.messages, txID)
+	return nil
+}
+
+func (p *CoinSparkMemoryMessageStore) TxIDs() (error, []string) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	txIDs := make([]string, 0, len(p.messages))
+	for txID := range p.messages {
+		txIDs = append(txIDs, txID)
+	}
+	return nil, txIDs
+}
+
+// Copies message so that callers of Get and Put cannot change what is stored.
+func copyStoredMessage(message *CoinSparkStoredMessage) *CoinSparkStoredMessage {
+	if message == nil {
+		return nil
+	}
+	result := *message
+	result.Recipients = append([]string(nil), message.Recipients...)
+	result.Salt = append([]byte(nil), message.Salt...)
+	result.Parts = make([]CoinSparkMessagePart, len(message.Parts))
+	for partIndex, part := range message.Parts {
+		result.Parts[partIndex] = CoinSparkMessagePart{part.MimeType, part.FileName, append([]byte(nil), part.Content...)}
+	}
+	return &result
+}
+
+type CoinSparkMessageServer struct {
+	Store           CoinSparkMessageStore
+	Txs             CoinSparkMessageTxSource
+	Verifier        CoinSparkSignatureVerifier
+	Testnet         bool // addresses and transactions are on testnet
+	MaxKeepSeconds  int  // longest a message is kept after its transaction is found
+	PendingSeconds  int  // longest a message is held waiting for its transaction
+	NonceSeconds    int  // time allowed to sign a nonce
+	MaxNonces       int  // nonces given out and not yet used or expired
+	MaxMessageBytes int  // total size of the parts
+
+	mutex   sync.Mutex
+	nonces  map[string]messageNonce
+	txLocks map[string]*messageTxLock
+}
+
+// What a nonce may be used for.
+type messageNonce struct {
+	address string
+	txID    string // empty for storing
+	expires time.Time
+}
+
+// Held while a message is checked or updated, by the requests counted in users.
+type messageTxLock struct {
+	mutex sync.Mutex
+	users int
+}
+
+// Returns a server with the default limits, using store, or a CoinSparkMemoryMessageStore if
+// store is nil.
+func NewCoinSparkMessageServer(store CoinSparkMessageStore, txs CoinSparkMessageTxSource, verifier CoinSparkSignatureVerifier) *CoinSparkMessageServer {
+	if store == nil {
+		store = NewCoinSparkMemoryMessageStore()
+	}
+	p := new(CoinSparkMessageServer)
+	p.Store = store
+	p.Txs = txs
+	p.Verifier = verifier
+	p.MaxKeepSeconds = COINSPARK_MESSAGE_SERVER_MAX_KEEP_SECONDS
+	p.PendingSeconds = COINSPARK_MESSAGE_SERVER_PENDING_SECONDS
+	p.NonceSeconds = COINSPARK_MESSAGE_SERVER_NONCE_SECONDS
+	p.MaxNonces = COINSPARK_MESSAGE_SERVER_MAX_NONCES
+	p.MaxMessageBytes = COINSPARK_MESSAGE_SERVER_MAX_BYTES
+	return p
+}
+
+// Answers JSON-RPC requests sent by POST. Errors are returned in the JSON-RPC response.
+func (p *CoinSparkMessageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := messageRPCResponse{JSONRPC: "2.0"}
+	var request messageRPCRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, 2*int64(p.MaxMessageBytes)+64*1024)) // base64 and other params
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+
+	var result interface{}
+	if err != nil {
+		err = ErrMessageServer{COINSPARK_MESSAGE_ERR_PARSE, "request is not valid JSON"}
+	} else if request.JSONRPC != "2.0" || request.Method == "" {
+		err = ErrMessageServer{COINSPARK_MESSAGE_ERR_INVALID_REQUEST, "not a JSON-RPC 2.0 request"}
+	} else {
+		response.ID = request.ID
+		err, result = p.dispatch(r.Context(), request.Method, request.Params)
+	}
+
+	if err != nil {
+		serverErr, ok := err.(ErrMessageServer)
+		if !ok {
+			serverErr = ErrMessageServer{COINSPARK_MESSAGE_ERR_INTERNAL, err.Error()}
+		}
+		response.Error = &messageRPCError{serverErr.Code, serverErr.Message}
+	} else if response.Result, err = json.Marshal(result); err != nil {
+		http.Error(w, "cannot encode result", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Deletes expired messages, and checks those waiting for their transaction. Call it from time to
+// time, since messages are otherwise only checked when retrieved.
+func (p *CoinSparkMessageServer) Sweep(ctx context.Context) error {
+	err, txIDs := p.Store.TxIDs()
+	if err != nil {
+		return err
+	}
+	for _, txID := range txIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err, _, _, _ := p.load(ctx, txID); err != nil {
+			if _, ok := err.(ErrMessageServer); !ok {
+				return err
+			}
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.deleteExpiredNonces()
+	return nil
+}
+
+func (p *CoinSparkMessageServer) dispatch(ctx context.Context, method string, params json.RawMessage) (err error, result interface{}) {
+	switch method {
+	case COINSPARK_MESSAGE_METHOD_PRE_STORE:
+		var request messagePreStoreParams
+		if err := decodeMessageParams(params, &request); err != nil {
+			return err, nil
+		}
+		return p.preStore(&request)
+
+	case COINSPARK_MESSAGE_METHOD_STORE:
+		var request messageStoreParams
+		if err := decodeMessageParams(params, &request); err != nil {
+			return err, nil
+		}
+		return p.store(ctx, &request)
+
+	case COINSPARK_MESSAGE_METHOD_PRE_RETRIEVE:
+		var request messagePreRetrieveParams
+		if err := decodeMessageParams(params, &request); err != nil {
+			return err, nil
+		}
+		return p.preRetrieve(ctx, &request)
+
+	case COINSPARK_MESSAGE_METHOD_RETRIEVE:
+		var request messageRetrieveParams
+		if err := decodeMessageParams(params, &request); err != nil {
+			return err, nil
+		}
+		return p.retrieve(ctx, &request)
+	}
+
+	return ErrMessageServer{COINSPARK_MESSAGE_ERR_METHOD_NOT_FOUND, "unknown method " + method}, nil
+}
+
+func (p *CoinSparkMessageServer) preStore(request *messagePreStoreParams) (err error, result interface{}) {
+	if err := p.checkPreStore(request, false); err != nil {
+		return err, nil
+	}
+	err, nonce := p.newNonce(request.Sender, "")
+	if err != nil {
+		return err, nil
+	}
+	return nil, messagePreStoreResult{request.Sender, nonce}
+}
+
+func (p *CoinSparkMessageServer) store(ctx context.Context, request *messageStoreParams) (err error, result interface{}) {
+	if err := p.checkPreStore(&request.messagePreStoreParams, true); err != nil {
+		return err, nil
+	}
+	if !isTxID(request.TxID) {
+		return invalidMessageParams("txid"), nil
+	}
+	if err := p.checkSignature(ctx, request.Sender, "", request.Nonce, request.PubKey, request.Signature); err != nil {
+		return err, nil
+	}
+
+	txID := strings.ToLower(request.TxID)
+	defer p.lockTxID(txID)()
+
+	err, existing := p.Store.Get(txID)
+	if err != nil {
+		return err, nil
+	}
+	if existing != nil && existing.Confirmed {
+		return invalidMessageParams("txid already has a message"), nil
+	}
+	if existing != nil && existing.Sender != request.Sender {
+		// Only a message which could still turn out to be right holds the txid, so that a message
+		// stored first by someone who is not an input cannot lock out the real sender.
+		err, _, _ = p.confirm(ctx, existing)
+		if err == nil {
+			if err := p.Store.Put(existing); err != nil {
+				return err, nil
+			}
+			return invalidMessageParams("txid already has a message"), nil
+		}
+		serverErr, ok := err.(ErrMessageServer)
+		if !ok {
+			return err, nil
+		}
+		if serverErr.Code == COINSPARK_MESSAGE_ERR_TX_NOT_FOUND {
+			return ErrMessageServer{COINSPARK_MESSAGE_ERR_SENDER_REJECTED, "txid has a message waiting from another sender"}, nil
+		}
+		if err := p.Store.Delete(txID); err != nil {
+			return err, nil
+		}
+	}
+
+	keepSeconds := request.KeepSeconds
+	if keepSeconds <= 0 || keepSeconds > p.MaxKeepSeconds {
+		keepSeconds = p.MaxKeepSeconds
+	}
+
+	message := &CoinSparkStoredMessage{
+		TxID:        txID,
+		Sender:      request.Sender,
+		IsPublic:    request.IsPublic,
+		Recipients:  request.Recipients,
+		KeepSeconds: keepSeconds,
+		Salt:        request.Salt,
+		Parts:       messagePartsFromJSON(request.Message),
+		Expires:     time.Now().Add(time.Duration(p.PendingSeconds) * time.Second),
+	}
+
+	// Reject straight away if the transaction is known and does not match, otherwise hold it.
+	err, _, _ = p.confirm(ctx, message)
+	if serverErr, ok := err.(ErrMessageServer); err != nil && (!ok || serverErr.Code != COINSPARK_MESSAGE_ERR_TX_NOT_FOUND) {
+		return err, nil
+	}
+	if err := p.Store.Put(message); err != nil {
+		return err, nil
+	}
+
+	return nil, struct {
+		TxID string `json:"txid"`
+	}{txID}
+}
+
+func (p *CoinSparkMessageServer) preRetrieve(ctx context.Context, request *messagePreRetrieveParams) (err error, result interface{}) {
+	if err := p.checkRecipient(ctx, request); err != nil {
+		return err, nil
+	}
+	err, nonce := p.newNonce(request.Recipient, strings.ToLower(request.TxID))
+	if err != nil {
+		return err, nil
+	}
+	return nil, messagePreRetrieveResult{request.Recipient, nonce}
+}
+
+func (p *CoinSparkMessageServer) retrieve(ctx context.Context, request *messageRetrieveParams) (err error, result interface{}) {
+	if err := p.checkSignature(ctx, request.Recipient, strings.ToLower(request.TxID), request.Nonce, request.PubKey, request.Signature); err != nil {
+		return err, nil
+	}
+	if err := p.checkRecipient(ctx, &request.messagePreRetrieveParams); err != nil {
+		return err, nil
+	}
+
+	err, stored, _, _ := p.load(ctx, strings.ToLower(request.TxID))
+	if err != nil {
+		return err, nil
+	}
+	return nil, messageRetrieveResult{stored.Salt, messagePartsToJSON(stored.Parts, true)}
+}
+
+func (p *CoinSparkMessageServer) checkPreStore(request *messagePreStoreParams, withContent bool) error {
+	if request.Testnet != p.Testnet {
+		return invalidMessageParams("testnet")
+	}
+	if request.Sender == "" {
+		return invalidMessageParams("sender")
+	}
+
+	countBytes := 0
+	for _, part := range request.Message {
+		if withContent {
+			countBytes += len(part.Content)
+		} else {
+			countBytes += part.Bytes
+		}
+	}
+	if countBytes > p.MaxMessageBytes {
+		return ErrMessageServer{COINSPARK_MESSAGE_ERR_TOO_LARGE, "message is too large"}
+	}
+	return nil
+}
+
+// Returns nil if the recipient may read the message for the txid, which must be ready.
+func (p *CoinSparkMessageServer) checkRecipient(ctx context.Context, request *messagePreRetrieveParams) error {
+	if request.Testnet != p.Testnet {
+		return invalidMessageParams("testnet")
+	}
+	if !isTxID(request.TxID) {
+		return invalidMessageParams("txid")
+	}
+	if request.Recipient == "" {
+		return invalidMessageParams("recipient")
+	}
+
+	err, _, message, tx := p.load(ctx, strings.ToLower(request.TxID))
+	if err != nil {
+		return err
+	}
+	if message.IsPublic {
+		return nil
+	}
+
+	for _, outputRange := range message.OutputRanges {
+		lastOutputIndex := COINSPARK_MIN(int(outputRange.First+outputRange.Count), len(tx.OutputScripts)) - 1
+		for outputIndex := int(outputRange.First); outputIndex <= lastOutputIndex; outputIndex++ {
+			if ScriptToBitcoinAddress(tx.OutputScripts[outputIndex], true, p.network()) == request.Recipient {
+				return nil
+			}
+		}
+	}
+	return ErrMessageServer{COINSPARK_MESSAGE_ERR_NOT_RECIPIENT, "address is not a recipient of the message"}
+}
+
+// Gets the message for txID if it can be retrieved, confirming it against its transaction if that
+// has not been done yet. Expired messages, and those which do not match, are deleted.
+func (p *CoinSparkMessageServer) load(ctx context.Context, txID string) (err error, stored *CoinSparkStoredMessage, message *CoinSparkMessage, tx *CoinSparkMessageTx) {
+	notFound := ErrMessageServer{COINSPARK_MESSAGE_ERR_MESSAGE_NOT_FOUND, "no message for this txid"}
+	defer p.lockTxID(txID)()
+
+	err, stored = p.Store.Get(txID)
+	if err != nil {
+		return err, nil, nil, nil
+	}
+	if stored == nil {
+		return notFound, nil, nil, nil
+	}
+	if time.Now().After(stored.Expires) {
+		if err := p.Store.Delete(txID); err != nil {
+			return err, nil, nil, nil
+		}
+		return notFound, nil, nil, nil
+	}
+
+	wasConfirmed := stored.Confirmed
+	err, message, tx = p.confirm(ctx, stored)
+	if err != nil {
+		if serverErr, ok := err.(ErrMessageServer); ok && serverErr.Code != COINSPARK_MESSAGE_ERR_TX_NOT_FOUND {
+			if err := p.Store.Delete(txID); err != nil {
+				return err, nil, nil, nil
+			}
+		}
+		return err, nil, nil, nil
+	}
+
+	if !wasConfirmed {
+		if err := p.Store.Put(stored); err != nil {
+			return err, nil, nil, nil
+		}
+	}
+	return nil, stored, message, tx
+}
+
+// Checks the stored message against its transaction, marking it confirmed and starting its
+// retention period the first time it matches.
+func (p *CoinSparkMessageServer) confirm(ctx context.Context, stored *CoinSparkStoredMessage) (err error, message *CoinSparkMessage, tx *CoinSparkMessageTx) {
+	err, tx = p.Txs.GetMessageTx(ctx, stored.TxID)
+	if err != nil {
+		return err, nil, nil
+	}
+	if tx == nil {
+		return ErrMessageServer{COINSPARK_MESSAGE_ERR_TX_NOT_FOUND, "transaction not found yet"}, nil, nil
+	}
+
+	message = new(CoinSparkMessage)
+	metadata := ScriptsToMetadata(tx.OutputScripts, true)
+	if metadata == nil || !message.Decode(metadata, len(tx.OutputScripts)) {
+		return invalidMessageParams("transaction has no message metadata"), nil, nil
+	}
+
+	hash := CoinSparkCalcMessageHash(stored.Salt, stored.Parts)
+	if !bytes.Equal(hash[:message.HashLen], message.Hash[:message.HashLen]) {
+		return ErrMessageServer{COINSPARK_MESSAGE_ERR_HASH_MISMATCH, "salt and message do not match the transaction"}, nil, nil
+	}
+
+	senderIsInput := false
+	for _, address := range tx.InputAddresses {
+		senderIsInput = senderIsInput || address == stored.Sender
+	}
+	if !senderIsInput {
+		return ErrMessageServer{COINSPARK_MESSAGE_ERR_SENDER_REJECTED, "sender is not an input of the transaction"}, nil, nil
+	}
+
+	if !stored.Confirmed {
+		stored.Confirmed = true
+		stored.Expires = time.Now().Add(time.Duration(stored.KeepSeconds) * time.Second)
+	}
+	return nil, message, tx
+}
+
+// Returns a nonce for the address and txID to sign, deleting expired nonces if MaxNonces are
+// already waiting, and refusing if they are all still in use.
+func (p *CoinSparkMessageServer) newNonce(address string, txID string) (err error, nonce string) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	nonce = hex.EncodeToString(random)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.nonces == nil {
+		p.nonces = map[string]messageNonce{}
+	}
+	if len(p.nonces) >= p.MaxNonces {
+		p.deleteExpiredNonces()
+		if len(p.nonces) >= p.MaxNonces {
+			return ErrMessageServer{COINSPARK_MESSAGE_ERR_INTERNAL, "too many nonces waiting to be used, try again later"}, ""
+		}
+	}
+	p.nonces[nonce] = messageNonce{address, txID, time.Now().Add(time.Duration(p.NonceSeconds) * time.Second)}
+	return nil, nonce
+}
+
+// Call with mutex held.
+func (p *CoinSparkMessageServer) deleteExpiredNonces() {
+	now := time.Now()
+	for nonce, used := range p.nonces {
+		if now.After(used.expires) {
+			delete(p.nonces, nonce)
+		}
+	}
+}
+
+// Waits until no other request is checking or updating the message for txID, returning the
+// function to call when done.
+func (p *CoinSparkMessageServer) lockTxID(txID string) (unlock func()) {
+	p.mutex.Lock()
+	if p.txLocks == nil {
+		p.txLocks = map[string]*messageTxLock{}
+	}
+	lock := p.txLocks[txID]
+	if lock == nil {
+		lock = new(messageTxLock)
+		p.txLocks[txID] = lock
+	}
+	lock.users++
+	p.mutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if lock.users--; lock.users == 0 {
+			delete(p.txLocks, txID)
+		}
+	}
+}
+
+// Uses up the nonce, which must have been given for the address and txID, and checks its signature.
+func (p *CoinSparkMessageServer) checkSignature(ctx context.Context, address string, txID string, nonce string, pubKey string, signature string) error {
+	p.mutex.Lock()
+	used, found := p.nonces[nonce]
+	delete(p.nonces, nonce)
+	p.mutex.Unlock()
+
+	if !found || used.address != address || used.txID != txID || time.Now().After(used.expires) {
+		return ErrMessageServer{COINSPARK_MESSAGE_ERR_NONCE_NOT_FOUND, "unknown or expired nonce"}
+	}
+
+	err, valid := p.Verifier.VerifyMessage(ctx, address, nonce, pubKey, signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrMessageServer{COINSPARK_MESSAGE_ERR_SIGNATURE, "nonce is not signed by the address"}
+	}
+	return nil
+}
+
+func (p *CoinSparkMessageServer) network() *CoinSparkNetwork {
+	if p.Testnet {
+		return &testNet3
+	}
+	return &mainNet
+}
+
+func decodeMessageParams(params json.RawMessage, request interface{}) error {
+	if err := json.Unmarshal(params, request); err != nil {
+		return invalidMessageParams(err.Error())
+	}
+	return nil
+}
+
+func invalidMessageParams(reason string) ErrMessageServer {
+	return ErrMessageServer{COINSPARK_MESSAGE_ERR_INVALID_PARAMS, "invalid params: " + reason}
+}
+
+func isTxID(txID string) bool {
+	txIDBytes, err := hex.DecodeString(txID)
+	return err == nil && len(txIDBytes) == COINSPARK_TXID_LEN
+}
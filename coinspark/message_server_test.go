@@ -0,0 +1,231 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func messageServerTestCode(err error) int {
+	var serverErr ErrMessageServer
+	if errors.As(err, &serverErr) {
+		return serverErr.Code
+	}
+	return 0
+}
+
+func TestMessageServerOutputRanges(t *testing.T) {
+	server, txs := messageTestServer()
+	tx, send := messageTestTx(t, false)
+	txs.add(send.TxID, tx)
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		recipient string
+		wantCode  int
+	}{
+		{messageTestAddress(0), 0},
+		{messageTestAddress(1), 0},
+		{messageTestAddress(2), COINSPARK_MESSAGE_ERR_NOT_RECIPIENT},
+		{messageTestAddress(3), 0},
+		{send.Sender, COINSPARK_MESSAGE_ERR_NOT_RECIPIENT},
+	} {
+		err, _ := client.Retrieve(ctx, send.TxID, test.recipient)
+		if code := messageServerTestCode(err); code != test.wantCode || (err != nil && code == 0) {
+			t.Errorf("recipient %s: got %v, want code %d", test.recipient, err, test.wantCode)
+		}
+	}
+
+	if len(server.txLocks) != 0 {
+		t.Errorf("%d txid locks left after the requests", len(server.txLocks))
+	}
+}
+
+func TestMessageServerPublicMessage(t *testing.T) {
+	server, txs := messageTestServer()
+	tx, send := messageTestTx(t, true)
+	txs.add(send.TxID, tx)
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+	for _, recipient := range []string{messageTestAddress(2), messageTestAddress(50)} {
+		if err, _ := client.Retrieve(ctx, send.TxID, recipient); err != nil {
+			t.Errorf("public message for %s: %v", recipient, err)
+		}
+	}
+}
+
+func TestMessageServerExpiry(t *testing.T) {
+	server, txs := messageTestServer()
+	tx, send := messageTestTx(t, false)
+	send.KeepSeconds = 60
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	// Held until the transaction shows up, then kept for KeepSeconds.
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := client.Retrieve(ctx, send.TxID, messageTestAddress(0)); messageServerTestCode(err) != COINSPARK_MESSAGE_ERR_TX_NOT_FOUND {
+		t.Errorf("before the transaction: got %v", err)
+	}
+	txs.add(send.TxID, tx)
+	if err, _ := client.Retrieve(ctx, send.TxID, messageTestAddress(0)); err != nil {
+		t.Fatal(err)
+	}
+	_, stored := server.Store.Get(send.TxID)
+	if !stored.Confirmed || stored.Expires.After(time.Now().Add(time.Minute)) || stored.Expires.Before(time.Now().Add(time.Minute/2)) {
+		t.Errorf("confirmed %v, expires %v, want about a minute from now", stored.Confirmed, stored.Expires)
+	}
+
+	stored.Expires = time.Now().Add(-time.Second)
+	server.Store.Put(stored)
+	if err, _ := client.Retrieve(ctx, send.TxID, messageTestAddress(0)); messageServerTestCode(err) != COINSPARK_MESSAGE_ERR_MESSAGE_NOT_FOUND {
+		t.Errorf("after expiry: got %v", err)
+	}
+	if _, stored := server.Store.Get(send.TxID); stored != nil {
+		t.Error("expired message was not deleted")
+	}
+
+	// Given up on if the transaction does not show up.
+	txs.add(send.TxID, nil)
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+	_, stored = server.Store.Get(send.TxID)
+	stored.Expires = time.Now().Add(-time.Second)
+	server.Store.Put(stored)
+	if err := server.Sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, txIDs := server.Store.TxIDs(); len(txIDs) != 0 {
+		t.Errorf("sweep left %v", txIDs)
+	}
+}
+
+func TestMessageServerReplacePending(t *testing.T) {
+	server, txs := messageTestServer()
+	tx, send := messageTestTx(t, false)
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+
+	other := *send
+	other.Sender = messageTestAddress(50)
+	if err := client.Store(ctx, &other); messageServerTestCode(err) != COINSPARK_MESSAGE_ERR_SENDER_REJECTED {
+		t.Errorf("another sender replacing: got %v", err)
+	}
+
+	replacement := *send
+	replacement.Salt = append([]byte(nil), send.Salt...)
+	replacement.Salt[0]++
+	if err := client.Store(ctx, &replacement); err != nil {
+		t.Errorf("sender replacing: %v", err)
+	}
+	if _, stored := server.Store.Get(send.TxID); stored == nil || stored.Salt[0] != replacement.Salt[0] {
+		t.Error("message was not replaced")
+	}
+
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+	txs.add(send.TxID, tx)
+	if err, _ := client.Retrieve(ctx, send.TxID, messageTestAddress(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Store(ctx, send); messageServerTestCode(err) != COINSPARK_MESSAGE_ERR_INVALID_PARAMS {
+		t.Errorf("replacing a confirmed message: got %v", err)
+	}
+}
+
+func TestMessageServerReplaceWrongSender(t *testing.T) {
+	server, txs := messageTestServer()
+	tx, send := messageTestTx(t, false)
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	// Held while the transaction is unknown, since the sender cannot be checked yet.
+	wrongSender := *send
+	wrongSender.Sender = messageTestAddress(50)
+	if err := client.Store(ctx, &wrongSender); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Store(ctx, send); messageServerTestCode(err) != COINSPARK_MESSAGE_ERR_SENDER_REJECTED {
+		t.Errorf("before the transaction: got %v", err)
+	}
+
+	// Once the transaction shows the wrong sender is not an input, the real sender takes over.
+	txs.add(send.TxID, tx)
+	if err := client.Store(ctx, send); err != nil {
+		t.Fatalf("sender after the transaction: %v", err)
+	}
+	if _, stored := server.Store.Get(send.TxID); stored == nil || stored.Sender != send.Sender {
+		t.Fatal("message from the wrong sender was not replaced")
+	}
+	if err, _ := client.Retrieve(ctx, send.TxID, messageTestAddress(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Store(ctx, &wrongSender); messageServerTestCode(err) != COINSPARK_MESSAGE_ERR_INVALID_PARAMS {
+		t.Errorf("wrong sender replacing a confirmed message: got %v", err)
+	}
+}
+
+func TestMessageServerMaxNonces(t *testing.T) {
+	server, _ := messageTestServer()
+	server.MaxNonces = 2
+	_, send := messageTestTx(t, false)
+	client := messageTestClient(t, server)
+	ctx := context.Background()
+
+	server.NonceSeconds = -1
+	for attempt := 0; attempt < 2; attempt++ {
+		if err, _ := client.PreStore(ctx, send); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server.NonceSeconds = COINSPARK_MESSAGE_SERVER_NONCE_SECONDS
+	for attempt := 0; attempt < 2; attempt++ {
+		if err, _ := client.PreStore(ctx, send); err != nil {
+			t.Fatalf("in place of expired nonces: %v", err)
+		}
+	}
+	if err, _ := client.PreStore(ctx, send); messageServerTestCode(err) != COINSPARK_MESSAGE_ERR_INTERNAL {
+		t.Errorf("beyond MaxNonces: got %v", err)
+	}
+	if len(server.nonces) != server.MaxNonces {
+		t.Errorf("%d nonces held, want %d", len(server.nonces), server.MaxNonces)
+	}
+}
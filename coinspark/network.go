@@ -0,0 +1,159 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"strings"
+)
+
+// Parameters of a bitcoin network which determine how its addresses are written.
+// Testnet3, regtest and signet share base58 version bytes, so only segwit addresses
+// can tell them apart.
+type CoinSparkNetwork struct {
+	Name             string
+	PubKeyHashAddrID byte   // base58 version byte for P2PKH addresses
+	ScriptHashAddrID byte   // base58 version byte for P2SH addresses
+	Bech32HRP        string // human-readable part for segwit addresses
+}
+
+var mainNet = CoinSparkNetwork{
+	Name:             "mainnet",
+	PubKeyHashAddrID: COINSPARK_ADDRESS_VERSION_P2PKH,
+	ScriptHashAddrID: COINSPARK_ADDRESS_VERSION_P2SH,
+	Bech32HRP:        "bc",
+}
+
+var testNet3 = CoinSparkNetwork{
+	Name:             "testnet3",
+	PubKeyHashAddrID: COINSPARK_ADDRESS_VERSION_TESTNET_P2PKH,
+	ScriptHashAddrID: COINSPARK_ADDRESS_VERSION_TESTNET_P2SH,
+	Bech32HRP:        "tb",
+}
+
+var regTest = CoinSparkNetwork{
+	Name:             "regtest",
+	PubKeyHashAddrID: COINSPARK_ADDRESS_VERSION_TESTNET_P2PKH,
+	ScriptHashAddrID: COINSPARK_ADDRESS_VERSION_TESTNET_P2SH,
+	Bech32HRP:        "bcrt",
+}
+
+var sigNet = CoinSparkNetwork{
+	Name:             "signet",
+	PubKeyHashAddrID: COINSPARK_ADDRESS_VERSION_TESTNET_P2PKH,
+	ScriptHashAddrID: COINSPARK_ADDRESS_VERSION_TESTNET_P2SH,
+	Bech32HRP:        "tb",
+}
+
+// All networks known to the library, in order of preference when an address could belong to several.
+var knownNetworks = []*CoinSparkNetwork{&mainNet, &testNet3, &regTest, &sigNet}
+
+// The functions below return a new copy of the parameters on each call, so changing them
+// cannot affect other users of the library.
+
+func CoinSparkMainNet() *CoinSparkNetwork {
+	network := mainNet
+	return &network
+}
+
+func CoinSparkTestNet3() *CoinSparkNetwork {
+	network := testNet3
+	return &network
+}
+
+func CoinSparkRegTest() *CoinSparkNetwork {
+	network := regTest
+	return &network
+}
+
+func CoinSparkSigNet() *CoinSparkNetwork {
+	network := sigNet
+	return &network
+}
+
+// Returns all networks known to the library, in order of preference when an address could
+// belong to several.
+func CoinSparkNetworks() []*CoinSparkNetwork {
+	networks := make([]*CoinSparkNetwork, len(knownNetworks))
+	for index, network := range knownNetworks {
+		networkCopy := *network
+		networks[index] = &networkCopy
+	}
+	return networks
+}
+
+// Returns the known network with the given name (case insensitive), or nil if there is none.
+// "testnet" is accepted as an alias for testnet3.
+func CoinSparkNetworkByName(name string) *CoinSparkNetwork {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "testnet" {
+		name = testNet3.Name
+	}
+	for _, network := range knownNetworks {
+		if network.Name == name {
+			networkCopy := *network
+			return &networkCopy
+		}
+	}
+	return nil
+}
+
+func (p *CoinSparkNetwork) String() string {
+	return p.Name
+}
+
+// Base58check-decodes a bitcoin address, verifying its checksum and length, and that its
+// version byte belongs to this network. Returns the address type and hash160 on success.
+func (p *CoinSparkNetwork) DecodeBitcoinAddress(bitcoinAddress string) (success bool, addressType CoinSparkAddressType, hash160 [COINSPARK_HASH160_LEN]byte) {
+	success, version, payload := Base58CheckDecode(bitcoinAddress)
+	if !success || len(payload) != COINSPARK_HASH160_LEN {
+		return false, COINSPARK_ADDRESS_TYPE_UNKNOWN, hash160
+	}
+
+	switch version {
+	case p.PubKeyHashAddrID:
+		addressType = COINSPARK_ADDRESS_TYPE_P2PKH
+	case p.ScriptHashAddrID:
+		addressType = COINSPARK_ADDRESS_TYPE_P2SH
+	default:
+		return false, COINSPARK_ADDRESS_TYPE_UNKNOWN, hash160
+	}
+
+	copy(hash160[:], payload)
+	return true, addressType, hash160
+}
+
+// Encodes a hash160 as a base58check bitcoin address of the given type on this network.
+// Returns empty string if the type has no base58 form.
+func (p *CoinSparkNetwork) EncodeBitcoinAddress(addressType CoinSparkAddressType, hash160 [COINSPARK_HASH160_LEN]byte) string {
+	switch addressType {
+	case COINSPARK_ADDRESS_TYPE_P2PKH:
+		return Base58CheckEncode(p.PubKeyHashAddrID, hash160[:])
+	case COINSPARK_ADDRESS_TYPE_P2SH:
+		return Base58CheckEncode(p.ScriptHashAddrID, hash160[:])
+	}
+	return ""
+}
+
+// Returns true if the bitcoin address is valid on this network.
+func (p *CoinSparkNetwork) IsValidBitcoinAddress(bitcoinAddress string) bool {
+	success, _, _ := p.DecodeBitcoinAddress(bitcoinAddress)
+	return success
+}
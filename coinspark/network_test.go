@@ -0,0 +1,43 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+func TestAddressNetworkDefaultsToMainNet(t *testing.T) {
+	address := CoinSparkAddress{BitcoinAddress: "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"}
+	if err := address.Validate(); err != ErrWrongNetwork {
+		t.Errorf("testnet address with nil Network: got %v, want %v", err, ErrWrongNetwork)
+	}
+
+	address.Network = CoinSparkTestNet3()
+	if err := address.Validate(); err != nil {
+		t.Errorf("testnet address on testnet3: %v", err)
+	}
+}
+
+func TestNetworksAreCopies(t *testing.T) {
+	network := CoinSparkMainNet()
+	network.Bech32HRP = "tb"
+	if CoinSparkMainNet().Bech32HRP != "bc" || CoinSparkNetworkByName("mainnet").Bech32HRP != "bc" {
+		t.Error("changing a returned network changed the library's parameters")
+	}
+}
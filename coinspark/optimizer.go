@@ -0,0 +1,273 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "math"
+
+// Rewrites a transfer list to encode in fewer bytes, keeping what Apply gives every output for
+// every asset. Candidate rewrites are removing a transfer (so the default route does the same
+// job), merging transfers of the same quantity to adjacent outputs, reusing the previous input
+// range, widening input ranges, sending COINSPARK_ASSET_QTY_MAX instead of an exact quantity and
+// swapping transfers of the same asset. Each is checked by running Apply on the balances given,
+// so the result is only equivalent for a transaction with those input balances. A rewrite is
+// also rejected if it would raise the minimum fee given by CalcMinFee.
+
+// An optimized transfer list and how much it saved.
+type CoinSparkTransferOptimization struct {
+	TransferList CoinSparkTransferList // in the order it will be encoded
+	BytesBefore  int                   // encoded length before, including the metadata identifier
+	BytesAfter   int
+	BytesSaved   int
+}
+
+// Optimizes the transfer list for a transaction whose inputs hold the balances in assets, which
+// must include every asset held by any input. Returns ErrOutOfRange if a transfer's asset is
+// missing from assets or the input balances are inconsistent, or ErrBadPacking if the list
+// cannot be encoded at all.
+func (p *CoinSparkTransferList) Optimize(assets []CoinSparkAssetInputs, outputsRegular []bool) (err error, result *CoinSparkTransferOptimization) {
+	countOutputs := len(outputsRegular)
+	countInputs := -1
+	for _, asset := range assets {
+		if asset.Genesis == nil || (countInputs != -1 && len(asset.InputBalances) != countInputs) {
+			return ErrOutOfRange{"Assets"}, nil
+		}
+		countInputs = len(asset.InputBalances)
+	}
+	if countInputs == -1 {
+		countInputs = 0
+	}
+
+	for _, transfer := range p.Transfers {
+		if transfer.AssetRef.BlockNum == COINSPARK_TRANSFER_BLOCK_NUM_DEFAULT_ROUTE {
+			continue
+		}
+		found := false
+		for _, asset := range assets {
+			found = found || asset.AssetRef.Match(&transfer.AssetRef)
+		}
+		if !found {
+			return ErrOutOfRange{"Assets"}, nil
+		}
+	}
+
+	optimizer := transferOptimizer{assets, outputsRegular, countInputs, countOutputs, nil, 0}
+	current := optimizer.encodingOrder(p.Transfers)
+	optimizer.target = optimizer.applyAll(current)
+	optimizer.targetMinFee = optimizer.minFee(current)
+
+	size := optimizer.encodedLen(current)
+	if size < 0 {
+		return ErrBadPacking, nil
+	}
+
+	result = new(CoinSparkTransferOptimization)
+	result.BytesBefore = size
+
+	// Take the best rewrite each time round, until none helps
+
+	for {
+		var best []CoinSparkTransfer
+		bestSize := size
+		for _, candidate := range optimizer.candidates(current) {
+			candidate = optimizer.encodingOrder(candidate)
+			if candidateSize := optimizer.encodedLen(candidate); candidateSize >= 0 && candidateSize < bestSize && optimizer.isEquivalent(candidate) {
+				best, bestSize = candidate, candidateSize
+			}
+		}
+		if best == nil {
+			break
+		}
+		current, size = best, bestSize
+	}
+
+	result.TransferList.Transfers = current
+	result.BytesAfter = size
+	result.BytesSaved = result.BytesBefore - result.BytesAfter
+	return nil, result
+}
+
+type transferOptimizer struct {
+	assets         []CoinSparkAssetInputs
+	outputsRegular []bool
+	countInputs    int
+	countOutputs   int
+	target         [][]CoinSparkAssetQty // what Apply gives each output, for each asset
+	targetMinFee   CoinSparkSatoshiQty   // minFee of the transfers before optimization
+}
+
+// Returns the transfers in the order Encode will write them, which Decode will return.
+func (p *transferOptimizer) encodingOrder(transfers []CoinSparkTransfer) []CoinSparkTransfer {
+	list := CoinSparkTransferList{transfers}
+	ordered := make([]CoinSparkTransfer, len(transfers))
+	for orderIndex, transferIndex := range list.GroupOrdering() {
+		ordered[orderIndex] = transfers[transferIndex]
+	}
+	return ordered
+}
+
+func (p *transferOptimizer) encodedLen(transfers []CoinSparkTransfer) int {
+	list := CoinSparkTransferList{transfers}
+	metadata := list.Encode(p.countInputs, p.countOutputs, math.MaxInt32)
+	if metadata == nil {
+		return -1
+	}
+	return len(metadata)
+}
+
+func (p *transferOptimizer) applyAll(transfers []CoinSparkTransfer) [][]CoinSparkAssetQty {
+	list := CoinSparkTransferList{transfers}
+	results := make([][]CoinSparkAssetQty, len(p.assets))
+	for assetIndex, asset := range p.assets {
+		assetRef := asset.AssetRef
+		results[assetIndex] = list.Apply(&assetRef, asset.Genesis, asset.InputBalances, p.outputsRegular)
+	}
+	return results
+}
+
+// Returns CalcMinFee for outputs of one satoshi each. The fee basis does not depend on the
+// transfers, so this rises and falls with the fee for any output values.
+func (p *transferOptimizer) minFee(transfers []CoinSparkTransfer) CoinSparkSatoshiQty {
+	outputsSatoshis := make([]CoinSparkSatoshiQty, p.countOutputs)
+	for outputIndex := range outputsSatoshis {
+		outputsSatoshis[outputIndex] = 1
+	}
+	list := CoinSparkTransferList{transfers}
+	return list.CalcMinFee(p.countInputs, outputsSatoshis, p.outputsRegular)
+}
+
+func (p *transferOptimizer) isEquivalent(transfers []CoinSparkTransfer) bool {
+	if p.minFee(transfers) > p.targetMinFee {
+		return false
+	}
+	for assetIndex, outputBalances := range p.applyAll(transfers) {
+		for outputIndex, balance := range outputBalances {
+			if balance != p.target[assetIndex][outputIndex] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns every single rewrite of transfers worth trying.
+func (p *transferOptimizer) candidates(transfers []CoinSparkTransfer) [][]CoinSparkTransfer {
+	var candidates [][]CoinSparkTransfer
+
+	replaced := func(index int, transfer CoinSparkTransfer) {
+		if transfer.Match(&transfers[index]) && transfer.Outputs.Count == transfers[index].Outputs.Count {
+			return // no change
+		}
+		candidate := append([]CoinSparkTransfer(nil), transfers...)
+		candidate[index] = transfer
+		candidates = append(candidates, candidate)
+	}
+
+	allInputs := CoinSparkIORange{0, CoinSparkIOIndex(p.countInputs)}
+
+	for index, transfer := range transfers {
+		isDefaultRoute := transfer.AssetRef.BlockNum == COINSPARK_TRANSFER_BLOCK_NUM_DEFAULT_ROUTE
+
+		// Remove it, leaving the default route to do the same job
+
+		candidate := append([]CoinSparkTransfer(nil), transfers[:index]...)
+		candidates = append(candidates, append(candidate, transfers[index+1:]...))
+
+		// Cheaper input ranges
+
+		for _, inputs := range []CoinSparkIORange{
+			allInputs,
+			{0, transfer.Inputs.First + transfer.Inputs.Count},
+			{transfer.Inputs.First, CoinSparkIOIndex(p.countInputs) - transfer.Inputs.First},
+		} {
+			if inputs.Count > 0 {
+				rewritten := transfer
+				rewritten.Inputs = inputs
+				replaced(index, rewritten)
+			}
+		}
+
+		if index > 0 {
+			rewritten := transfer
+			rewritten.Inputs = transfers[index-1].Inputs
+			replaced(index, rewritten)
+
+			if isDefaultRoute && transfers[index-1].Outputs.First == transfer.Outputs.First {
+				rewritten = transfer
+				rewritten.Outputs = transfers[index-1].Outputs
+				replaced(index, rewritten)
+			}
+		}
+
+		if isDefaultRoute {
+			if transfer.Outputs.Count != 1 || transfer.QtyPerOutput != 0 {
+				rewritten := transfer
+				rewritten.Outputs.Count = 1 // only First matters
+				rewritten.QtyPerOutput = 0
+				replaced(index, rewritten)
+			}
+			continue
+		}
+
+		// Send everything the inputs hold
+
+		if transfer.QtyPerOutput != COINSPARK_ASSET_QTY_MAX {
+			rewritten := transfer
+			rewritten.QtyPerOutput = COINSPARK_ASSET_QTY_MAX
+			replaced(index, rewritten)
+		}
+
+		// Match the previous quantity, or swap with the next transfer of the same asset
+
+		if index > 0 && transfers[index-1].AssetRef.Match(&transfer.AssetRef) {
+			rewritten := transfer
+			rewritten.QtyPerOutput = transfers[index-1].QtyPerOutput
+			replaced(index, rewritten)
+		}
+
+		if index+1 < len(transfers) && transfers[index+1].AssetRef.Match(&transfer.AssetRef) {
+			candidate := append([]CoinSparkTransfer(nil), transfers...)
+			candidate[index], candidate[index+1] = candidate[index+1], candidate[index]
+			candidates = append(candidates, candidate)
+		}
+
+		// Merge with a later transfer of the same asset and quantity to the following outputs
+
+		for otherIndex := index + 1; otherIndex < len(transfers); otherIndex++ {
+			other := transfers[otherIndex]
+			if !other.AssetRef.Match(&transfer.AssetRef) || other.QtyPerOutput != transfer.QtyPerOutput ||
+				other.Outputs.First != transfer.Outputs.First+transfer.Outputs.Count {
+				continue
+			}
+
+			merged := transfer
+			firstInput := COINSPARK_MIN(int(transfer.Inputs.First), int(other.Inputs.First))
+			endInput := COINSPARK_MAX(int(transfer.Inputs.First+transfer.Inputs.Count), int(other.Inputs.First+other.Inputs.Count))
+			merged.Inputs = CoinSparkIORange{CoinSparkIOIndex(firstInput), CoinSparkIOIndex(endInput - firstInput)}
+			merged.Outputs.Count += other.Outputs.Count
+
+			candidate := append([]CoinSparkTransfer(nil), transfers...)
+			candidate[index] = merged
+			candidates = append(candidates, append(candidate[:otherIndex], candidate[otherIndex+1:]...))
+		}
+	}
+
+	return candidates
+}
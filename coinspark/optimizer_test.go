@@ -0,0 +1,102 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+func optimizerTestAssets(t *testing.T) []CoinSparkAssetInputs {
+	return []CoinSparkAssetInputs{{quoteTestAssetRef, quoteTestGenesis(t, 0, 0), []CoinSparkAssetQty{100, 50, 0}}}
+}
+
+func TestOptimizeKeepsApplyAndMinFee(t *testing.T) {
+	assets := optimizerTestAssets(t)
+	outputsRegular := []bool{true, true, true, false, true}
+	outputsSatoshis := []CoinSparkSatoshiQty{1000, 2000, 3000, 0, 4000}
+
+	for _, transfers := range [][]CoinSparkTransfer{
+		{ // the same quantity to adjacent outputs, which can be merged
+			{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{0, 1}, 30},
+			{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{1, 1}, 30},
+			{quoteTestAssetRef, CoinSparkIORange{0, 2}, CoinSparkIORange{2, 1}, 60},
+		},
+		{ // everything to the last regular output, which the default route does anyway
+			{quoteTestAssetRef, CoinSparkIORange{0, 3}, CoinSparkIORange{4, 1}, 150},
+		},
+		{ // a transfer which moves nothing but still counts towards the fee
+			{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{0, 1}, 10},
+			{quoteTestAssetRef, CoinSparkIORange{2, 1}, CoinSparkIORange{1, 2}, 0},
+		},
+	} {
+		list := CoinSparkTransferList{transfers}
+		err, result := list.Optimize(assets, outputsRegular)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.BytesAfter > result.BytesBefore || result.BytesSaved != result.BytesBefore-result.BytesAfter {
+			t.Errorf("%s: %d bytes before, %d after", list.String(), result.BytesBefore, result.BytesAfter)
+		}
+
+		before := list.Apply(&quoteTestAssetRef, assets[0].Genesis, append([]CoinSparkAssetQty(nil), assets[0].InputBalances...), outputsRegular)
+		after := result.TransferList.Apply(&quoteTestAssetRef, assets[0].Genesis, append([]CoinSparkAssetQty(nil), assets[0].InputBalances...), outputsRegular)
+		for outputIndex := range before {
+			if before[outputIndex] != after[outputIndex] {
+				t.Errorf("%s: output %d gets %d, was %d", list.String(), outputIndex, after[outputIndex], before[outputIndex])
+			}
+		}
+
+		feeBefore := list.CalcMinFee(3, outputsSatoshis, outputsRegular)
+		feeAfter := result.TransferList.CalcMinFee(3, outputsSatoshis, outputsRegular)
+		if feeAfter > feeBefore {
+			t.Errorf("%s: minimum fee rose from %d to %d", list.String(), feeBefore, feeAfter)
+		}
+	}
+}
+
+func TestOptimizerRejectsHigherMinFee(t *testing.T) {
+	assets := optimizerTestAssets(t)
+	outputsRegular := []bool{true, true, true}
+	original := []CoinSparkTransfer{{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{0, 1}, 10}}
+
+	optimizer := transferOptimizer{assets, outputsRegular, 3, 3, nil, 0}
+	optimizer.target = optimizer.applyAll(original)
+	optimizer.targetMinFee = optimizer.minFee(original)
+
+	// Apply gives the same, since nothing is moved, but the second transfer needs a higher fee
+	withEmpty := append([]CoinSparkTransfer{}, original...)
+	withEmpty = append(withEmpty, CoinSparkTransfer{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{1, 1}, 0})
+	if !optimizer.isEquivalentApply(withEmpty) {
+		t.Fatal("test transfers do not give the same Apply result")
+	}
+	if optimizer.isEquivalent(withEmpty) {
+		t.Error("rewrite with a higher minimum fee accepted as equivalent")
+	}
+	if !optimizer.isEquivalent(original) {
+		t.Error("original transfers not equivalent to themselves")
+	}
+}
+
+// As isEquivalent, ignoring the minimum fee.
+func (p *transferOptimizer) isEquivalentApply(transfers []CoinSparkTransfer) bool {
+	targetMinFee := p.targetMinFee
+	p.targetMinFee = COINSPARK_SATOSHI_QTY_MAX
+	defer func() { p.targetMinFee = targetMinFee }()
+	return p.isEquivalent(transfers)
+}
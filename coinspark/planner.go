@@ -0,0 +1,244 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "sort"
+
+// Plans a transfer list from what should be sent where. Apply drains the inputs of a transfer
+// in order, charges each output on the total it was sent, and passes whatever is left to the
+// default route, so the planner works out gross quantities with CalcGross, picks input ranges
+// by draining the balances in the same way, and checks the result by running Apply.
+//
+// Change is routed by a default route transfer, which the protocol applies to every asset alike,
+// so all assets share one change output. To send the change of one asset elsewhere, Send it to
+// that output explicitly, bearing in mind that it is then charged like any other transfer.
+//
+//	planner := NewCoinSparkTransferPlanner(outputsRegular)
+//	planner.AddAsset(assetRef, genesis, inputBalances)
+//	planner.Send(assetRef, 0, 100)
+//	planner.ChangeOutput = 2
+//	err, plan := planner.Plan()
+
+// The balances of one asset held by each input of the transaction.
+type CoinSparkAssetInputs struct {
+	AssetRef      CoinSparkAssetRef
+	Genesis       *CoinSparkGenesis // for the asset's charges
+	InputBalances []CoinSparkAssetQty
+}
+
+// A net quantity of an asset which an output should receive.
+type CoinSparkTransferIntent struct {
+	AssetRef CoinSparkAssetRef
+	Output   int
+	Qty      CoinSparkAssetQty
+}
+
+type CoinSparkTransferPlanner struct {
+	Assets         []CoinSparkAssetInputs
+	Intents        []CoinSparkTransferIntent
+	OutputsRegular []bool
+	ChangeOutput   int // receives everything not sent explicitly, of every asset, or -1 for the last regular output
+}
+
+// The planned transfers, and what Apply gives each output for each asset.
+type CoinSparkTransferPlan struct {
+	TransferList   CoinSparkTransferList
+	OutputBalances map[CoinSparkAssetRef][]CoinSparkAssetQty
+}
+
+func NewCoinSparkTransferPlanner(outputsRegular []bool) *CoinSparkTransferPlanner {
+	p := new(CoinSparkTransferPlanner)
+	p.OutputsRegular = outputsRegular
+	p.ChangeOutput = -1
+	return p
+}
+
+// Adds the input balances of an asset, which should be given for every input.
+func (p *CoinSparkTransferPlanner) AddAsset(assetRef CoinSparkAssetRef, genesis *CoinSparkGenesis, inputBalances []CoinSparkAssetQty) {
+	p.Assets = append(p.Assets, CoinSparkAssetInputs{assetRef, genesis, inputBalances})
+}
+
+// Asks for output to receive qty units of the asset, after charges.
+func (p *CoinSparkTransferPlanner) Send(assetRef CoinSparkAssetRef, output int, qty CoinSparkAssetQty) {
+	p.Intents = append(p.Intents, CoinSparkTransferIntent{assetRef, output, qty})
+}
+
+// Builds the transfer list. Returns ErrInsufficientBalance if the inputs do not hold enough of an
+// asset (including charges), or ErrOutOfRange if an intent or the change output is not a regular
+// output, or the input balances are inconsistent. ErrPlanMismatch means the transfer list did not
+// apply as planned, which is a bug in the planner.
+func (p *CoinSparkTransferPlanner) Plan() (err error, plan *CoinSparkTransferPlan) {
+	countOutputs := len(p.OutputsRegular)
+	countInputs := -1
+
+	if p.ChangeOutput != -1 && (p.ChangeOutput < 0 || p.ChangeOutput >= countOutputs || !p.OutputsRegular[p.ChangeOutput]) {
+		return ErrOutOfRange{"ChangeOutput"}, nil
+	}
+
+	assetIndexes := map[CoinSparkAssetRef]int{}
+	for assetIndex, asset := range p.Assets {
+		if err := asset.AssetRef.Validate(); err != nil || asset.AssetRef.BlockNum == COINSPARK_TRANSFER_BLOCK_NUM_DEFAULT_ROUTE {
+			return ErrOutOfRange{"AssetRef"}, nil
+		}
+		if _, found := assetIndexes[asset.AssetRef]; found {
+			return ErrOutOfRange{"AssetRef"}, nil // same asset added twice
+		}
+		if asset.Genesis == nil {
+			return ErrOutOfRange{"Genesis"}, nil
+		}
+		if countInputs != -1 && len(asset.InputBalances) != countInputs {
+			return ErrOutOfRange{"InputBalances"}, nil
+		}
+		countInputs = len(asset.InputBalances)
+		assetIndexes[asset.AssetRef] = assetIndex
+	}
+
+	// Total the net quantity wanted by each output of each asset, since charges are per output
+
+	netWanted := make([]map[int]CoinSparkAssetQty, len(p.Assets))
+	for _, intent := range p.Intents {
+		if intent.Qty < 0 {
+			return ErrOutOfRange{"Qty"}, nil
+		}
+		if intent.Output < 0 || intent.Output >= countOutputs || !p.OutputsRegular[intent.Output] {
+			return ErrOutOfRange{"Output"}, nil
+		}
+		assetIndex, found := assetIndexes[intent.AssetRef]
+		if !found {
+			return ErrInsufficientBalance{intent.AssetRef, intent.Qty, 0}, nil
+		}
+		if netWanted[assetIndex] == nil {
+			netWanted[assetIndex] = map[int]CoinSparkAssetQty{}
+		}
+		netWanted[assetIndex][intent.Output] += intent.Qty
+	}
+
+	// Build explicit transfers, draining a copy of the balances as Apply will
+
+	plan = new(CoinSparkTransferPlan)
+	plan.TransferList.Clear()
+	plan.OutputBalances = map[CoinSparkAssetRef][]CoinSparkAssetQty{}
+
+	for assetIndex, asset := range p.Assets {
+		balances := append([]CoinSparkAssetQty(nil), asset.InputBalances...)
+
+		var available CoinSparkAssetQty
+		for _, balance := range balances {
+			if balance < 0 {
+				return ErrOutOfRange{"InputBalances"}, nil
+			}
+			available += balance
+		}
+
+		outputs := make([]int, 0, len(netWanted[assetIndex]))
+		for output := range netWanted[assetIndex] {
+			outputs = append(outputs, output)
+		}
+		sort.Ints(outputs)
+
+		var needed CoinSparkAssetQty
+		for _, output := range outputs {
+			needed += asset.Genesis.CalcGross(netWanted[assetIndex][output])
+		}
+		if needed > available {
+			return ErrInsufficientBalance{asset.AssetRef, needed, available}, nil
+		}
+
+		inputIndex := 0
+		for _, output := range outputs {
+			gross := asset.Genesis.CalcGross(netWanted[assetIndex][output])
+			if gross == 0 {
+				continue
+			}
+			if gross > COINSPARK_ASSET_QTY_MAX {
+				return ErrOutOfRange{"Qty"}, nil
+			}
+
+			for balances[inputIndex] == 0 {
+				inputIndex++
+			}
+			firstInput := inputIndex
+			for remaining := gross; ; inputIndex++ {
+				drained := COINSPARK_MINASSETQTY(remaining, balances[inputIndex])
+				balances[inputIndex] -= drained
+				remaining -= drained
+				if remaining == 0 {
+					break
+				}
+			}
+
+			transfer := CoinSparkTransfer{
+				AssetRef:     asset.AssetRef,
+				Inputs:       CoinSparkIORange{CoinSparkIOIndex(firstInput), CoinSparkIOIndex(inputIndex - firstInput + 1)},
+				Outputs:      CoinSparkIORange{CoinSparkIOIndex(output), 1},
+				QtyPerOutput: gross,
+			}
+			if err := transfer.Validate(); err != nil {
+				return err, nil
+			}
+			plan.TransferList.Transfers = append(plan.TransferList.Transfers, transfer)
+		}
+	}
+
+	if p.ChangeOutput != -1 && countInputs > 0 {
+		plan.TransferList.Transfers = append(plan.TransferList.Transfers, CoinSparkTransfer{
+			AssetRef: CoinSparkAssetRef{BlockNum: COINSPARK_TRANSFER_BLOCK_NUM_DEFAULT_ROUTE},
+			Inputs:   CoinSparkIORange{0, CoinSparkIOIndex(countInputs)},
+			Outputs:  CoinSparkIORange{CoinSparkIOIndex(p.ChangeOutput), 1},
+		})
+	}
+
+	// Check by running Apply that every output gets exactly what was planned: the net of its
+	// explicit transfer, plus everything left over if it is the change output
+
+	changeOutput := p.ChangeOutput
+	if changeOutput == -1 {
+		changeOutput = GetLastRegularOutput(p.OutputsRegular)
+	}
+
+	for assetIndex, asset := range p.Assets {
+		expected := make([]CoinSparkAssetQty, countOutputs)
+		var leftOver CoinSparkAssetQty
+		for _, balance := range asset.InputBalances {
+			leftOver += balance
+		}
+		for output, net := range netWanted[assetIndex] {
+			gross := asset.Genesis.CalcGross(net)
+			expected[output] += asset.Genesis.CalcNet(gross)
+			leftOver -= gross
+		}
+		if changeOutput >= 0 && changeOutput < countOutputs {
+			expected[changeOutput] += leftOver
+		}
+
+		balances := append([]CoinSparkAssetQty(nil), asset.InputBalances...)
+		assetRef := asset.AssetRef
+		outputBalances := plan.TransferList.Apply(&assetRef, asset.Genesis, balances, p.OutputsRegular)
+		for output := range outputBalances {
+			if outputBalances[output] != expected[output] {
+				return ErrPlanMismatch{asset.AssetRef, output, expected[output], outputBalances[output]}, nil // should never happen
+			}
+		}
+		plan.OutputBalances[asset.AssetRef] = outputBalances
+	}
+
+	return nil, plan
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+func TestPlannerExactBalances(t *testing.T) {
+	genesis1 := quoteTestGenesis(t, 10, 250)
+	genesis2 := quoteTestGenesis(t, 0, 0)
+	assetRef2 := quoteTestAssetRef
+	assetRef2.TxOffset++
+
+	for _, changeOutput := range []int{-1, 1} {
+		outputsRegular := []bool{true, true, false, true}
+		planner := NewCoinSparkTransferPlanner(outputsRegular)
+		planner.AddAsset(quoteTestAssetRef, genesis1, []CoinSparkAssetQty{300, 0, 500})
+		planner.AddAsset(assetRef2, genesis2, []CoinSparkAssetQty{0, 40, 0})
+		planner.Send(quoteTestAssetRef, 0, 350)
+		planner.Send(quoteTestAssetRef, 3, 20)
+		planner.Send(quoteTestAssetRef, 0, 50) // adds to the first intent, charged once
+		planner.Send(assetRef2, 0, 15)
+		planner.ChangeOutput = changeOutput
+
+		err, plan := planner.Plan()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		change := changeOutput
+		if change == -1 {
+			change = 3
+		}
+		gross0, gross3 := genesis1.CalcGross(400), genesis1.CalcGross(20)
+		want1 := []CoinSparkAssetQty{genesis1.CalcNet(gross0), 0, 0, genesis1.CalcNet(gross3)}
+		want1[change] += 800 - gross0 - gross3
+		want2 := []CoinSparkAssetQty{15, 0, 0, 0}
+		want2[change] += 25
+
+		for _, test := range []struct {
+			assetRef CoinSparkAssetRef
+			genesis  *CoinSparkGenesis
+			inputs   []CoinSparkAssetQty
+			want     []CoinSparkAssetQty
+		}{
+			{quoteTestAssetRef, genesis1, planner.Assets[0].InputBalances, want1},
+			{assetRef2, genesis2, planner.Assets[1].InputBalances, want2},
+		} {
+			outputBalances := plan.TransferList.Apply(&test.assetRef, test.genesis, test.inputs, outputsRegular)
+			for output, want := range test.want {
+				if outputBalances[output] != want || plan.OutputBalances[test.assetRef][output] != want {
+					t.Errorf("change output %d, asset %s output %d: Apply gives %d, plan says %d, want %d", changeOutput,
+						test.assetRef.Encode(), output, outputBalances[output], plan.OutputBalances[test.assetRef][output], want)
+				}
+			}
+		}
+	}
+}
+
+func TestPlannerErrors(t *testing.T) {
+	genesis := quoteTestGenesis(t, 10, 0)
+	planner := NewCoinSparkTransferPlanner([]bool{true, false})
+	planner.AddAsset(quoteTestAssetRef, genesis, []CoinSparkAssetQty{100})
+
+	planner.Send(quoteTestAssetRef, 0, 91)
+	err, _ := planner.Plan()
+	if err != (ErrInsufficientBalance{quoteTestAssetRef, 101, 100}) {
+		t.Errorf("not enough for the charge: got %v", err)
+	}
+
+	planner.Intents = nil
+	planner.Send(quoteTestAssetRef, 1, 10)
+	if err, _ := planner.Plan(); err != (ErrOutOfRange{"Output"}) {
+		t.Errorf("send to a non-regular output: got %v", err)
+	}
+
+	planner.Intents = nil
+	planner.ChangeOutput = 1
+	if err, _ := planner.Plan(); err != (ErrOutOfRange{"ChangeOutput"}) {
+		t.Errorf("change to a non-regular output: got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "encoding/hex"
+
+// The full asset outcome of a transaction, from its inputs' asset balances, output scripts, output
+// values and fee. The rules follow the CoinSpark specification:
+//
+// - Metadata is read from the first OP_RETURN output, via ScriptsToMetadata.
+// - If the metadata holds a valid genesis, the transaction is a genesis transaction and any
+//   transfers in it are ignored. The new asset is created only if the fee is at least the
+//   genesis CalcMinFee, and assets in the inputs go to the last regular output.
+// - Otherwise the transfers are applied if the fee is at least the transfer list's CalcMinFee,
+//   or else every asset goes to the last regular output, as in ApplyAssets.
+//
+//	processor := CoinSparkTxProcessor{Geneses: geneses}
+//	err, outcome := processor.Process(&tx)
+//	if outcome.Genesis != nil {
+//		outcome.SetGenesisAssetRef(blockNum, txOffset, txID) // once the transaction is confirmed
+//	}
+
+// The parts of a transaction which determine its asset outcome.
+type CoinSparkTx struct {
+	InputBalances   []CoinSparkAssetBalances // for each input, may be nil
+	OutputScripts   []string                 // scriptPubKey of each output
+	ScriptsAreHex   bool
+	OutputsSatoshis []CoinSparkSatoshiQty
+	FeeSatoshis     CoinSparkSatoshiQty
+}
+
+type CoinSparkTxOutcome struct {
+	Genesis          *CoinSparkGenesis  // the asset created, or nil if none
+	GenesisAssetRef  *CoinSparkAssetRef // set by SetGenesisAssetRef
+	GenesisOutputs   []CoinSparkAssetQty
+	TransferList     *CoinSparkTransferList // transfers read from the metadata, or nil if none
+	TransfersApplied bool                   // false if there were none or the fee was too low
+	MinFee           CoinSparkSatoshiQty    // for the genesis or transfers to take effect
+	OutputsRegular   []bool
+
+	// Assets held by each output, including the new asset once SetGenesisAssetRef is called.
+	OutputBalances []CoinSparkAssetBalances
+	Charges        CoinSparkAssetBalances // payment charges deducted from the outputs
+	Burns          CoinSparkAssetBalances // everything in the inputs which reached no output, including charges
+}
+
+type CoinSparkTxProcessor struct {
+	Geneses map[CoinSparkAssetRef]*CoinSparkGenesis // every asset which the inputs may hold
+}
+
+// Works out the asset outcome of tx. Returns ErrOutOfRange if the outputs do not line up or an
+// input balance is invalid, or ErrMissingGenesis for an asset not in p.Geneses.
+func (p *CoinSparkTxProcessor) Process(tx *CoinSparkTx) (err error, outcome *CoinSparkTxOutcome) {
+	countInputs := len(tx.InputBalances)
+	countOutputs := len(tx.OutputScripts)
+	if len(tx.OutputsSatoshis) != countOutputs {
+		return ErrOutOfRange{"OutputsSatoshis"}, nil
+	}
+
+	outcome = new(CoinSparkTxOutcome)
+	outcome.OutputsRegular = make([]bool, countOutputs)
+	for outputIndex, script := range tx.OutputScripts {
+		outcome.OutputsRegular[outputIndex] = ScriptIsRegular(script, tx.ScriptsAreHex)
+	}
+
+	metadata := ScriptsToMetadata(tx.OutputScripts, tx.ScriptsAreHex)
+
+	var transferList *CoinSparkTransferList
+	genesis := new(CoinSparkGenesis)
+	if metadata != nil && genesis.Decode(metadata) {
+		outcome.MinFee = genesis.CalcMinFee(tx.OutputsSatoshis, outcome.OutputsRegular)
+		if tx.FeeSatoshis >= outcome.MinFee {
+			outcome.Genesis = genesis
+			outcome.GenesisOutputs = genesis.Apply(outcome.OutputsRegular)
+		}
+	} else if metadata != nil {
+		transferList = new(CoinSparkTransferList)
+		if transferList.Decode(metadata, countInputs, countOutputs) == 0 {
+			transferList = nil
+		} else {
+			outcome.TransferList = transferList
+			outcome.MinFee = transferList.CalcMinFee(countInputs, tx.OutputsSatoshis, outcome.OutputsRegular)
+		}
+	}
+
+	err, outputBalances, traces := transferList.applyAssets(tx.InputBalances, p.Geneses, tx.OutputsSatoshis, outcome.OutputsRegular, tx.FeeSatoshis)
+	if err != nil {
+		return err, nil
+	}
+	outcome.OutputBalances = outputBalances
+	outcome.TransfersApplied = transferList != nil && tx.FeeSatoshis >= outcome.MinFee
+
+	outcome.Charges = CoinSparkAssetBalances{}
+	for _, trace := range traces {
+		for _, step := range trace.Steps {
+			if step.Kind == COINSPARK_STEP_CHARGE {
+				outcome.Charges[trace.AssetRef] += step.Charge
+			}
+		}
+	}
+
+	outcome.Burns = CoinSparkAssetBalances{}
+	for _, input := range tx.InputBalances {
+		for assetRef, qty := range input {
+			outcome.Burns[assetRef] += qty
+		}
+	}
+	for _, output := range outcome.OutputBalances {
+		for assetRef, qty := range output {
+			outcome.Burns[assetRef] -= qty
+		}
+	}
+	for assetRef, qty := range outcome.Burns {
+		if qty == 0 {
+			delete(outcome.Burns, assetRef)
+		}
+	}
+
+	return nil, outcome
+}
+
+// Sets the asset reference of the new asset from the position of the transaction in its block,
+// as found by BlockToAssetRef, and adds the new asset to OutputBalances.
+func (p *CoinSparkTxOutcome) SetGenesisAssetRef(blockNum int64, txOffset int64, txID string) error {
+	if p.Genesis == nil {
+		return ErrNoMetadata
+	}
+	if txIDBytes, err := hex.DecodeString(txID); err != nil || len(txIDBytes) != COINSPARK_TXID_LEN {
+		return ErrBadFormat
+	}
+
+	assetRef := CoinSparkAssetRef{BlockNum: blockNum, TxOffset: txOffset, TxIDPrefix: txIDToPrefix(txID)}
+	if err := assetRef.Validate(); err != nil {
+		return err
+	}
+
+	for outputIndex, qty := range p.GenesisOutputs {
+		if p.GenesisAssetRef != nil {
+			delete(p.OutputBalances[outputIndex], *p.GenesisAssetRef) // set again, e.g. after a reorg
+		}
+		if qty > 0 {
+			p.OutputBalances[outputIndex][assetRef] = qty
+		}
+	}
+	p.GenesisAssetRef = &assetRef
+	return nil
+}
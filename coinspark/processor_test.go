@@ -0,0 +1,124 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+const processorTestP2PKH = "76a914000102030405060708090a0b0c0d0e0f1011121388ac"
+
+func TestProcessTransfers(t *testing.T) {
+	genesis := quoteTestGenesis(t, 5, 0)
+	transferList := CoinSparkTransferList{[]CoinSparkTransfer{{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{0, 1}, 30}}}
+	metadata := transferList.Encode(2, 3, 40)
+	if metadata == nil {
+		t.Fatal("transfer list could not be encoded")
+	}
+
+	tx := CoinSparkTx{
+		InputBalances:   []CoinSparkAssetBalances{{quoteTestAssetRef: 100}, nil},
+		OutputScripts:   []string{processorTestP2PKH, processorTestP2PKH, MetadataToScript(metadata, true)},
+		ScriptsAreHex:   true,
+		OutputsSatoshis: []CoinSparkSatoshiQty{10000, 10000, 0},
+	}
+	processor := CoinSparkTxProcessor{Geneses: map[CoinSparkAssetRef]*CoinSparkGenesis{quoteTestAssetRef: genesis}}
+
+	for _, test := range []struct {
+		feeOffset CoinSparkSatoshiQty // from the minimum fee
+		applied   bool
+		outputs   [2]CoinSparkAssetQty
+		charge    CoinSparkAssetQty
+	}{
+		{0, true, [2]CoinSparkAssetQty{25, 70}, 5},
+		{-1, false, [2]CoinSparkAssetQty{0, 100}, 0},
+	} {
+		tx.FeeSatoshis = transferList.CalcMinFee(2, tx.OutputsSatoshis, []bool{true, true, false}) + test.feeOffset
+		err, outcome := processor.Process(&tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if outcome.TransfersApplied != test.applied || outcome.Genesis != nil || outcome.TransferList == nil {
+			t.Errorf("fee %d: applied %v, genesis %v, transfers %v", tx.FeeSatoshis, outcome.TransfersApplied, outcome.Genesis, outcome.TransferList)
+		}
+		for outputIndex, want := range test.outputs {
+			if outcome.OutputBalances[outputIndex][quoteTestAssetRef] != want {
+				t.Errorf("fee %d: output %d holds %d, want %d", tx.FeeSatoshis, outputIndex, outcome.OutputBalances[outputIndex][quoteTestAssetRef], want)
+			}
+		}
+		if outcome.Charges[quoteTestAssetRef] != test.charge || outcome.Burns[quoteTestAssetRef] != test.charge {
+			t.Errorf("fee %d: charges %v, burns %v, want %d", tx.FeeSatoshis, outcome.Charges, outcome.Burns, test.charge)
+		}
+	}
+
+	delete(processor.Geneses, quoteTestAssetRef)
+	if err, _ := processor.Process(&tx); err != (ErrMissingGenesis{quoteTestAssetRef}) {
+		t.Errorf("missing genesis: got %v", err)
+	}
+}
+
+func TestProcessGenesis(t *testing.T) {
+	genesis := quoteTestGenesis(t, 0, 0)
+	err, metadata := genesis.Encode(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := CoinSparkTx{
+		InputBalances:   []CoinSparkAssetBalances{{quoteTestAssetRef: 100}},
+		OutputScripts:   []string{processorTestP2PKH, MetadataToScript(metadata, true), processorTestP2PKH},
+		ScriptsAreHex:   true,
+		OutputsSatoshis: []CoinSparkSatoshiQty{10000, 0, 10000},
+	}
+	tx.FeeSatoshis = genesis.CalcMinFee(tx.OutputsSatoshis, []bool{true, false, true})
+
+	processor := CoinSparkTxProcessor{Geneses: map[CoinSparkAssetRef]*CoinSparkGenesis{quoteTestAssetRef: genesis}}
+	err, outcome := processor.Process(&tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcome.Genesis == nil || outcome.TransferList != nil {
+		t.Fatalf("genesis %v, transfers %v", outcome.Genesis, outcome.TransferList)
+	}
+	if outcome.OutputBalances[2][quoteTestAssetRef] != 100 {
+		t.Errorf("last regular output holds %d of the input asset, want 100", outcome.OutputBalances[2][quoteTestAssetRef])
+	}
+
+	newAssetRef := CoinSparkAssetRef{BlockNum: 200000, TxOffset: 81, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x4a, 0x5e}}
+	if err := outcome.SetGenesisAssetRef(newAssetRef.BlockNum, newAssetRef.TxOffset, blockTestTxID); err != nil {
+		t.Fatal(err)
+	}
+	var issued CoinSparkAssetQty
+	for outputIndex, qty := range outcome.GenesisOutputs {
+		if outcome.OutputBalances[outputIndex][newAssetRef] != qty {
+			t.Errorf("output %d holds %d of the new asset, want %d", outputIndex, outcome.OutputBalances[outputIndex][newAssetRef], qty)
+		}
+		issued += qty
+	}
+	if issued != genesis.GetQty() {
+		t.Errorf("issued %d, want %d", issued, genesis.GetQty())
+	}
+
+	tx.FeeSatoshis--
+	if err, outcome := processor.Process(&tx); err != nil {
+		t.Error(err)
+	} else if outcome.Genesis != nil {
+		t.Error("fee below the minimum, but the genesis took effect")
+	}
+}
@@ -0,0 +1,751 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// A self-contained QR code encoder (ISO/IEC 18004) for CoinSpark addresses and payment URIs.
+// Only byte and alphanumeric modes are supported, which is all these strings need.
+
+type CoinSparkQRErrorLevel int
+
+const (
+	COINSPARK_QR_ERROR_LEVEL_L CoinSparkQRErrorLevel = iota // recovers ~7% of codewords
+	COINSPARK_QR_ERROR_LEVEL_M                              // ~15%
+	COINSPARK_QR_ERROR_LEVEL_Q                              // ~25%
+	COINSPARK_QR_ERROR_LEVEL_H                              // ~30%
+)
+
+const (
+	COINSPARK_QR_VERSION_MIN   = 1
+	COINSPARK_QR_VERSION_MAX   = 40
+	COINSPARK_QR_QUIET_ZONE    = 4 // light modules around the symbol
+	COINSPARK_QR_MODULE_SIZE   = 8 // default pixels per module for PNG output
+	COINSPARK_QR_MODE_BYTE     = 0x4
+	COINSPARK_QR_MODE_ALPHANUM = 0x2
+)
+
+const qrAlphanumericChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// Indexed by error level then version, from the tables in ISO/IEC 18004.
+var qrECCCodewordsPerBlock = [4][COINSPARK_QR_VERSION_MAX + 1]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var qrNumErrorCorrectionBlocks = [4][COINSPARK_QR_VERSION_MAX + 1]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// The two format bits which identify each error level.
+var qrErrorLevelFormatBits = [4]int{1, 0, 3, 2}
+
+type CoinSparkQRCode struct {
+	Text         string // exactly as encoded, which may be uppercased from the original
+	Version      int    // 1 to 40
+	ErrorLevel   CoinSparkQRErrorLevel
+	Alphanumeric bool // true if alphanumeric mode was used, otherwise byte mode
+	Mask         int  // 0 to 7
+	Size         int  // modules per side, excluding the quiet zone
+
+	modules    [][]bool // [y][x], true is dark
+	isFunction [][]bool // [y][x], true for finder, timing, alignment, format and version modules
+}
+
+func (level CoinSparkQRErrorLevel) String() string {
+	if level >= COINSPARK_QR_ERROR_LEVEL_L && level <= COINSPARK_QR_ERROR_LEVEL_H {
+		return string("LMQH"[level])
+	}
+	return "?"
+}
+
+// Returns true if text can be encoded in QR alphanumeric mode as is.
+func IsQRAlphanumeric(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if strings.IndexByte(qrAlphanumericChars, text[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Creates a QR code for text, choosing the mode, smallest version and then the highest
+// error correction level that fits in that version. Returns nil if the text is too long.
+func NewCoinSparkQRCode(text string) *CoinSparkQRCode {
+	return NewCoinSparkQRCodeWithLevel(text, COINSPARK_QR_ERROR_LEVEL_L, true)
+}
+
+// As NewCoinSparkQRCode, but with a minimum error correction level. If boost is true, the
+// level is raised as far as possible without increasing the version.
+func NewCoinSparkQRCodeWithLevel(text string, minLevel CoinSparkQRErrorLevel, boost bool) *CoinSparkQRCode {
+	if minLevel < COINSPARK_QR_ERROR_LEVEL_L || minLevel > COINSPARK_QR_ERROR_LEVEL_H {
+		return nil
+	}
+
+	alphanumeric := IsQRAlphanumeric(text)
+
+	var version int
+	var dataBits int
+	for version = COINSPARK_QR_VERSION_MIN; ; version++ {
+		if version > COINSPARK_QR_VERSION_MAX {
+			return nil
+		}
+		dataBits = qrSegmentBits(len(text), alphanumeric, version)
+		if dataBits <= qrNumDataCodewords(version, minLevel)*8 {
+			break
+		}
+	}
+
+	level := minLevel
+	if boost {
+		for level < COINSPARK_QR_ERROR_LEVEL_H && dataBits <= qrNumDataCodewords(version, level+1)*8 {
+			level++
+		}
+	}
+
+	return newQRCode(text, alphanumeric, version, level, -1)
+}
+
+// Returns a QR code of the address, or nil if it cannot be encoded. Segwit CoinSpark addresses
+// are uppercased so they can use the denser alphanumeric mode.
+func (p *CoinSparkAddress) QRCode() *CoinSparkQRCode {
+	addressString := p.Encode()
+	if addressString == "" {
+		return nil
+	}
+
+	if upper := strings.ToUpper(addressString); IsQRAlphanumeric(upper) && isBech32CoinSparkAddress(addressString) {
+		addressString = upper
+	}
+
+	return NewCoinSparkQRCode(addressString)
+}
+
+// Returns a QR code of the payment URI, or nil if it cannot be encoded. A URI without parameters
+// for a segwit CoinSpark address is uppercased so it can use alphanumeric mode.
+func (p *CoinSparkURI) QRCode() *CoinSparkQRCode {
+	uri := p.Encode()
+	if uri == "" {
+		return nil
+	}
+
+	if upper := strings.ToUpper(uri); IsQRAlphanumeric(upper) && isBech32CoinSparkAddress(p.Address.Encode()) {
+		uri = upper
+	}
+
+	return NewCoinSparkQRCode(uri)
+}
+
+// Returns true if the module at column x, row y is dark. Coordinates outside the symbol are light.
+func (p *CoinSparkQRCode) Module(x, y int) bool {
+	return x >= 0 && x < p.Size && y >= 0 && y < p.Size && p.modules[y][x]
+}
+
+// Renders the QR code with a quiet zone, moduleSize pixels per module (or the default if 0).
+func (p *CoinSparkQRCode) Image(moduleSize int) image.Image {
+	if moduleSize < 1 {
+		moduleSize = COINSPARK_QR_MODULE_SIZE
+	}
+
+	dimension := (p.Size + 2*COINSPARK_QR_QUIET_ZONE) * moduleSize
+	img := image.NewPaletted(image.Rect(0, 0, dimension, dimension), color.Palette{color.White, color.Black})
+
+	for y := 0; y < dimension; y++ {
+		for x := 0; x < dimension; x++ {
+			if p.Module(x/moduleSize-COINSPARK_QR_QUIET_ZONE, y/moduleSize-COINSPARK_QR_QUIET_ZONE) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	return img
+}
+
+// Returns the QR code as a PNG image, moduleSize pixels per module (or the default if 0),
+// or nil on failure.
+func (p *CoinSparkQRCode) PNG(moduleSize int) []byte {
+	buffer := bytes.Buffer{}
+	if png.Encode(&buffer, p.Image(moduleSize)) != nil {
+		return nil
+	}
+	return buffer.Bytes()
+}
+
+// Renders the QR code as plain ASCII, two characters per module, dark modules as '#'.
+func (p *CoinSparkQRCode) ASCII() string {
+	buffer := bytes.Buffer{}
+	for y := -COINSPARK_QR_QUIET_ZONE; y < p.Size+COINSPARK_QR_QUIET_ZONE; y++ {
+		for x := -COINSPARK_QR_QUIET_ZONE; x < p.Size+COINSPARK_QR_QUIET_ZONE; x++ {
+			if p.Module(x, y) {
+				buffer.WriteString("##")
+			} else {
+				buffer.WriteString("  ")
+			}
+		}
+		buffer.WriteByte('\n')
+	}
+	return buffer.String()
+}
+
+// Renders the QR code for a terminal using Unicode half blocks, two rows of modules per line.
+// Dark modules are drawn in the foreground color, so a dark-on-light terminal scans best.
+func (p *CoinSparkQRCode) Terminal() string {
+	blocks := [4]string{" ", "▀", "▄", "█"} // none, upper, lower, both
+
+	buffer := bytes.Buffer{}
+	for y := -COINSPARK_QR_QUIET_ZONE; y < p.Size+COINSPARK_QR_QUIET_ZONE; y += 2 {
+		for x := -COINSPARK_QR_QUIET_ZONE; x < p.Size+COINSPARK_QR_QUIET_ZONE; x++ {
+			var index int
+			if p.Module(x, y) {
+				index |= 1
+			}
+			if p.Module(x, y+1) {
+				index |= 2
+			}
+			buffer.WriteString(blocks[index])
+		}
+		buffer.WriteByte('\n')
+	}
+	return buffer.String()
+}
+
+// Outputs the QR code parameters and ASCII rendering to a string for debugging.
+func (p *CoinSparkQRCode) String() string {
+	mode := "byte"
+	if p.Alphanumeric {
+		mode = "alphanumeric"
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString("COINSPARK QR CODE\n")
+	buffer.WriteString(fmt.Sprintf("      Text: %s\n", p.Text))
+	buffer.WriteString(fmt.Sprintf("   Version: %d (%dx%d modules)\n", p.Version, p.Size, p.Size))
+	buffer.WriteString(fmt.Sprintf("Error level: %s\n", p.ErrorLevel))
+	buffer.WriteString(fmt.Sprintf("      Mode: %s\n", mode))
+	buffer.WriteString(fmt.Sprintf("      Mask: %d\n", p.Mask))
+	buffer.WriteString(p.ASCII())
+	buffer.WriteString("END COINSPARK QR CODE\n\n")
+
+	return buffer.String()
+}
+
+// Builds the symbol. If mask is -1 the mask with the lowest penalty score is chosen.
+func newQRCode(text string, alphanumeric bool, version int, level CoinSparkQRErrorLevel, mask int) *CoinSparkQRCode {
+	p := new(CoinSparkQRCode)
+	p.Text = text
+	p.Version = version
+	p.ErrorLevel = level
+	p.Alphanumeric = alphanumeric
+	p.Size = version*4 + 17
+
+	p.modules = make([][]bool, p.Size)
+	p.isFunction = make([][]bool, p.Size)
+	for y := range p.modules {
+		p.modules[y] = make([]bool, p.Size)
+		p.isFunction[y] = make([]bool, p.Size)
+	}
+
+	p.drawFunctionPatterns()
+	p.drawCodewords(p.addECCAndInterleave(qrEncodeData(text, alphanumeric, version, level)))
+
+	if mask < 0 {
+		minPenalty := -1
+		for tryMask := 0; tryMask < 8; tryMask++ {
+			p.applyMask(tryMask)
+			p.drawFormatBits(tryMask)
+			penalty := p.penaltyScore()
+			if minPenalty < 0 || penalty < minPenalty {
+				mask = tryMask
+				minPenalty = penalty
+			}
+			p.applyMask(tryMask) // masking is its own inverse
+		}
+	}
+
+	p.Mask = mask
+	p.applyMask(mask)
+	p.drawFormatBits(mask)
+
+	p.isFunction = nil
+	return p
+}
+
+// Number of bits needed for a single segment of textLen characters, including header.
+func qrSegmentBits(textLen int, alphanumeric bool, version int) int {
+	var dataBits int
+	if alphanumeric {
+		dataBits = (textLen/2)*11 + (textLen%2)*6
+	} else {
+		dataBits = textLen * 8
+	}
+
+	countBits := qrCharCountBits(alphanumeric, version)
+	if textLen >= 1<<uint(countBits) {
+		return 1 << 30 // cannot be represented
+	}
+
+	return 4 + countBits + dataBits
+}
+
+func qrCharCountBits(alphanumeric bool, version int) int {
+	var sizeClass int
+	switch {
+	case version <= 9:
+		sizeClass = 0
+	case version <= 26:
+		sizeClass = 1
+	default:
+		sizeClass = 2
+	}
+
+	if alphanumeric {
+		return [3]int{9, 11, 13}[sizeClass]
+	}
+	return [3]int{8, 16, 16}[sizeClass]
+}
+
+// Number of modules available for data and error correction, after all function patterns.
+func qrNumRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func qrNumDataCodewords(version int, level CoinSparkQRErrorLevel) int {
+	return qrNumRawDataModules(version)/8 - qrECCCodewordsPerBlock[level][version]*qrNumErrorCorrectionBlocks[level][version]
+}
+
+// Returns the data codewords: mode, character count, data, terminator and padding.
+func qrEncodeData(text string, alphanumeric bool, version int, level CoinSparkQRErrorLevel) []byte {
+	var bits qrBitBuffer
+
+	if alphanumeric {
+		bits.append(COINSPARK_QR_MODE_ALPHANUM, 4)
+		bits.append(len(text), qrCharCountBits(true, version))
+		for i := 0; i+1 < len(text); i += 2 {
+			bits.append(strings.IndexByte(qrAlphanumericChars, text[i])*45+strings.IndexByte(qrAlphanumericChars, text[i+1]), 11)
+		}
+		if len(text)%2 == 1 {
+			bits.append(strings.IndexByte(qrAlphanumericChars, text[len(text)-1]), 6)
+		}
+	} else {
+		bits.append(COINSPARK_QR_MODE_BYTE, 4)
+		bits.append(len(text), qrCharCountBits(false, version))
+		for i := 0; i < len(text); i++ {
+			bits.append(int(text[i]), 8)
+		}
+	}
+
+	capacityBits := qrNumDataCodewords(version, level) * 8
+
+	terminatorBits := capacityBits - len(bits)
+	if terminatorBits > 4 {
+		terminatorBits = 4
+	}
+	bits.append(0, terminatorBits)
+	bits.append(0, (8-len(bits)%8)%8)
+
+	for padByte := 0xEC; len(bits) < capacityBits; padByte ^= 0xEC ^ 0x11 {
+		bits.append(padByte, 8)
+	}
+
+	data := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			data[i>>3] |= 1 << uint(7-(i&7))
+		}
+	}
+	return data
+}
+
+type qrBitBuffer []bool
+
+func (p *qrBitBuffer) append(value int, numBits int) {
+	for i := numBits - 1; i >= 0; i-- {
+		*p = append(*p, (value>>uint(i))&1 != 0)
+	}
+}
+
+// Splits data into blocks, appends Reed-Solomon error correction to each, and interleaves them.
+func (p *CoinSparkQRCode) addECCAndInterleave(data []byte) []byte {
+	numBlocks := qrNumErrorCorrectionBlocks[p.ErrorLevel][p.Version]
+	blockECCLen := qrECCCodewordsPerBlock[p.ErrorLevel][p.Version]
+	rawCodewords := qrNumRawDataModules(p.Version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := qrReedSolomonDivisor(blockECCLen)
+
+	blocks := make([][]byte, numBlocks)
+	for i, offset := 0, 0; i < numBlocks; i++ {
+		dataLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[offset:offset+dataLen]...)
+		offset += dataLen
+
+		ecc := qrReedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0) // placeholder, skipped when interleaving
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := 0; i < len(blocks[0]); i++ {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// Multiplies two elements of GF(2^8) modulo the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1.
+func qrGFMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// Returns the coefficients of the Reed-Solomon generator polynomial of the given degree,
+// highest power first and excluding the leading 1.
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = qrGFMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrGFMultiply(root, 0x02)
+	}
+	return result
+}
+
+func qrReedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= qrGFMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+func (p *CoinSparkQRCode) setFunctionModule(x, y int, dark bool) {
+	p.modules[y][x] = dark
+	p.isFunction[y][x] = true
+}
+
+func (p *CoinSparkQRCode) drawFunctionPatterns() {
+	for i := 0; i < p.Size; i++ {
+		p.setFunctionModule(6, i, i%2 == 0)
+		p.setFunctionModule(i, 6, i%2 == 0)
+	}
+
+	p.drawFinderPattern(3, 3)
+	p.drawFinderPattern(p.Size-4, 3)
+	p.drawFinderPattern(3, p.Size-4)
+
+	positions := qrAlignmentPatternPositions(p.Version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // overlaps a finder pattern
+			}
+			p.drawAlignmentPattern(x, y)
+		}
+	}
+
+	p.drawFormatBits(0) // reserves the area, redrawn once the mask is known
+	p.drawVersion()
+}
+
+func (p *CoinSparkQRCode) drawFinderPattern(centerX, centerY int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := centerX+dx, centerY+dy
+			if x >= 0 && x < p.Size && y >= 0 && y < p.Size {
+				distance := qrMaxInt(qrAbsInt(dx), qrAbsInt(dy))
+				p.setFunctionModule(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+}
+
+func (p *CoinSparkQRCode) drawAlignmentPattern(centerX, centerY int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			p.setFunctionModule(centerX+dx, centerY+dy, qrMaxInt(qrAbsInt(dx), qrAbsInt(dy)) != 1)
+		}
+	}
+}
+
+func qrAlignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	size := version*4 + 17
+
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, position := numAlign-1, size-7; i >= 1; i, position = i-1, position-step {
+		result[i] = position
+	}
+	return result
+}
+
+// Draws both copies of the format information (error level and mask) with BCH error correction.
+func (p *CoinSparkQRCode) drawFormatBits(mask int) {
+	data := qrErrorLevelFormatBits[p.ErrorLevel]<<3 | mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		p.setFunctionModule(8, i, qrGetBit(bits, i))
+	}
+	p.setFunctionModule(8, 7, qrGetBit(bits, 6))
+	p.setFunctionModule(8, 8, qrGetBit(bits, 7))
+	p.setFunctionModule(7, 8, qrGetBit(bits, 8))
+	for i := 9; i < 15; i++ {
+		p.setFunctionModule(14-i, 8, qrGetBit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		p.setFunctionModule(p.Size-1-i, 8, qrGetBit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		p.setFunctionModule(8, p.Size-15+i, qrGetBit(bits, i))
+	}
+	p.setFunctionModule(8, p.Size-8, true) // always dark
+}
+
+// Draws both copies of the version information, for version 7 and above.
+func (p *CoinSparkQRCode) drawVersion() {
+	if p.Version < 7 {
+		return
+	}
+
+	remainder := p.Version
+	for i := 0; i < 12; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 11) * 0x1F25)
+	}
+	bits := p.Version<<12 | remainder
+
+	for i := 0; i < 18; i++ {
+		bit := qrGetBit(bits, i)
+		a, b := p.Size-11+i%3, i/3
+		p.setFunctionModule(a, b, bit)
+		p.setFunctionModule(b, a, bit)
+	}
+}
+
+// Places the codewords in the zigzag pattern, two columns at a time from the bottom right.
+func (p *CoinSparkQRCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := p.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vertical := 0; vertical < p.Size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vertical
+				if (right+1)&2 == 0 {
+					y = p.Size - 1 - vertical // upward
+				}
+				if !p.isFunction[y][x] && i < len(codewords)*8 {
+					p.modules[y][x] = qrGetBit(int(codewords[i>>3]), 7-(i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+// XORs the data modules with the given mask pattern.
+func (p *CoinSparkQRCode) applyMask(mask int) {
+	for y := 0; y < p.Size; y++ {
+		for x := 0; x < p.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !p.isFunction[y][x] {
+				p.modules[y][x] = !p.modules[y][x]
+			}
+		}
+	}
+}
+
+// Scores the symbol using the four penalty rules of ISO/IEC 18004, lower is better.
+func (p *CoinSparkQRCode) penaltyScore() int {
+	var result int
+
+	// runs of five or more modules of the same color, in rows and columns
+	for pass := 0; pass < 2; pass++ {
+		for a := 0; a < p.Size; a++ {
+			runLength := 0
+			var runColor bool
+			for b := 0; b < p.Size; b++ {
+				dark := p.transposedModule(pass, a, b)
+				if b > 0 && dark == runColor {
+					runLength++
+					if runLength == 5 {
+						result += 3
+					} else if runLength > 5 {
+						result++
+					}
+				} else {
+					runColor = dark
+					runLength = 1
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same color
+	for y := 0; y+1 < p.Size; y++ {
+		for x := 0; x+1 < p.Size; x++ {
+			dark := p.modules[y][x]
+			if dark == p.modules[y][x+1] && dark == p.modules[y+1][x] && dark == p.modules[y+1][x+1] {
+				result += 3
+			}
+		}
+	}
+
+	// finder-like 1:1:3:1:1 patterns with four light modules on either side
+	finderLike := [2][11]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for pass := 0; pass < 2; pass++ {
+		for a := 0; a < p.Size; a++ {
+			for b := 0; b+11 <= p.Size; b++ {
+				for _, pattern := range finderLike {
+					matched := true
+					for k := 0; k < 11 && matched; k++ {
+						matched = p.transposedModule(pass, a, b+k) == pattern[k]
+					}
+					if matched {
+						result += 40
+					}
+				}
+			}
+		}
+	}
+
+	// balance of dark and light modules
+	var dark int
+	for y := 0; y < p.Size; y++ {
+		for x := 0; x < p.Size; x++ {
+			if p.modules[y][x] {
+				dark++
+			}
+		}
+	}
+	total := p.Size * p.Size
+	k := (qrAbsInt(dark*20-total*10)+total-1)/total - 1
+	result += k * 10
+
+	return result
+}
+
+// Returns the module at row a, column b in pass 0, or column a, row b in pass 1.
+func (p *CoinSparkQRCode) transposedModule(pass, a, b int) bool {
+	if pass == 0 {
+		return p.modules[a][b]
+	}
+	return p.modules[b][a]
+}
+
+func qrGetBit(value int, i int) bool {
+	return (value>>uint(i))&1 != 0
+}
+
+func qrAbsInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func qrMaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
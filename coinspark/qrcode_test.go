@@ -0,0 +1,230 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQRVersionAndLevel(t *testing.T) {
+	for _, test := range []struct {
+		text         string
+		minLevel     CoinSparkQRErrorLevel
+		boost        bool
+		version      int
+		level        CoinSparkQRErrorLevel
+		alphanumeric bool
+	}{
+		{"HELLO WORLD", COINSPARK_QR_ERROR_LEVEL_L, true, 1, COINSPARK_QR_ERROR_LEVEL_Q, true},
+		{"hello world", COINSPARK_QR_ERROR_LEVEL_L, true, 1, COINSPARK_QR_ERROR_LEVEL_Q, false},
+		{"HELLO WORLD", COINSPARK_QR_ERROR_LEVEL_L, false, 1, COINSPARK_QR_ERROR_LEVEL_L, true},
+		{"HELLO WORLD", COINSPARK_QR_ERROR_LEVEL_H, true, 2, COINSPARK_QR_ERROR_LEVEL_H, true},
+		{"hello world", COINSPARK_QR_ERROR_LEVEL_H, true, 2, COINSPARK_QR_ERROR_LEVEL_H, false},
+		{"S0QZC7R06LL46WTMYGYWJMSW702SE2S3U9PNMTRE5K7CZ", COINSPARK_QR_ERROR_LEVEL_L, true, 2, COINSPARK_QR_ERROR_LEVEL_L, true},
+		{strings.Repeat("A1", 200), COINSPARK_QR_ERROR_LEVEL_L, true, 11, COINSPARK_QR_ERROR_LEVEL_L, true},
+		{strings.Repeat("a", 150), COINSPARK_QR_ERROR_LEVEL_L, true, 7, COINSPARK_QR_ERROR_LEVEL_L, false},
+	} {
+		code := NewCoinSparkQRCodeWithLevel(test.text, test.minLevel, test.boost)
+		if code == nil {
+			t.Errorf("%.20s: not encoded", test.text)
+			continue
+		}
+		if code.Version != test.version || code.ErrorLevel != test.level || code.Alphanumeric != test.alphanumeric {
+			t.Errorf("%.20s at %s: version %d-%s alphanumeric %v, want %d-%s %v", test.text, test.minLevel,
+				code.Version, code.ErrorLevel, code.Alphanumeric, test.version, test.level, test.alphanumeric)
+		}
+		if code.Size != 4*code.Version+17 {
+			t.Errorf("%.20s: size %d for version %d", test.text, code.Size, code.Version)
+		}
+	}
+
+	if code := NewCoinSparkQRCode(strings.Repeat("x", 2954)); code != nil {
+		t.Errorf("2954 bytes encoded as version %d", code.Version)
+	}
+	if code := NewCoinSparkQRCode(strings.Repeat("x", 2953)); code == nil || code.Version != COINSPARK_QR_VERSION_MAX {
+		t.Error("2953 bytes do not fill version 40-L")
+	}
+}
+
+// Checks the finder, separator and timing patterns, and the dark module next to the lower format bits.
+func qrTestCheckFunctionPatterns(t *testing.T, code *CoinSparkQRCode) {
+	t.Helper()
+	for _, center := range [][2]int{{3, 3}, {code.Size - 4, 3}, {3, code.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= code.Size || y < 0 || y >= code.Size {
+					continue
+				}
+				distance := qrMaxInt(qrAbsInt(dx), qrAbsInt(dy))
+				if wantDark := distance != 2 && distance != 4; code.Module(x, y) != wantDark {
+					t.Errorf("version %d: finder module (%d, %d) is dark %v", code.Version, x, y, !wantDark)
+				}
+			}
+		}
+	}
+
+	for i := 8; i < code.Size-8; i++ {
+		if code.Module(i, 6) != (i%2 == 0) || code.Module(6, i) != (i%2 == 0) {
+			t.Errorf("version %d: timing module %d is wrong", code.Version, i)
+		}
+	}
+
+	if !code.Module(8, code.Size-8) {
+		t.Errorf("version %d: dark module is light", code.Version)
+	}
+	if code.Module(-1, 0) || code.Module(0, code.Size) {
+		t.Errorf("version %d: modules outside the symbol are dark", code.Version)
+	}
+}
+
+// Reads both copies of the format bits, checking they match, are a BCH codeword and hold the
+// error level and mask.
+func qrTestCheckFormatBits(t *testing.T, code *CoinSparkQRCode) {
+	t.Helper()
+	var first, second int
+	firstPositions := [15][2]int{{8, 0}, {8, 1}, {8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 7}, {8, 8}, {7, 8}, {5, 8}, {4, 8}, {3, 8}, {2, 8}, {1, 8}, {0, 8}}
+	for bit, position := range firstPositions {
+		if code.Module(position[0], position[1]) {
+			first |= 1 << uint(bit)
+		}
+	}
+	for bit := 0; bit < 15; bit++ {
+		x, y := code.Size-1-bit, 8
+		if bit >= 8 {
+			x, y = 8, code.Size-15+bit
+		}
+		if code.Module(x, y) {
+			second |= 1 << uint(bit)
+		}
+	}
+	if first != second {
+		t.Fatalf("format bits %015b and %015b differ", first, second)
+	}
+
+	unmasked := first ^ 0x5412
+	remainder := unmasked
+	for bit := 14; bit >= 10; bit-- {
+		if remainder&(1<<uint(bit)) != 0 {
+			remainder ^= 0x537 << uint(bit-10)
+		}
+	}
+	if remainder != 0 {
+		t.Errorf("format bits %015b are not a BCH codeword", first)
+	}
+
+	levelBits := map[CoinSparkQRErrorLevel]int{COINSPARK_QR_ERROR_LEVEL_L: 1, COINSPARK_QR_ERROR_LEVEL_M: 0, COINSPARK_QR_ERROR_LEVEL_Q: 3, COINSPARK_QR_ERROR_LEVEL_H: 2}
+	if unmasked>>10 != levelBits[code.ErrorLevel]<<3|code.Mask {
+		t.Errorf("format bits %015b do not hold level %s and mask %d", first, code.ErrorLevel, code.Mask)
+	}
+}
+
+func TestQRFunctionPatterns(t *testing.T) {
+	for _, text := range []string{"HELLO WORLD", "hello world", strings.Repeat("a", 150), strings.Repeat("A1", 200)} {
+		code := NewCoinSparkQRCode(text)
+		qrTestCheckFunctionPatterns(t, code)
+		qrTestCheckFormatBits(t, code)
+	}
+
+	// Version 7 is the first with version information, 0x07C94 in both corners
+	code := NewCoinSparkQRCode(strings.Repeat("a", 150))
+	for bit := 0; bit < 18; bit++ {
+		wantDark := 0x07C94&(1<<uint(bit)) != 0
+		a, b := code.Size-11+bit%3, bit/3
+		if code.Module(a, b) != wantDark || code.Module(b, a) != wantDark {
+			t.Errorf("version bit %d is not %v in both corners", bit, wantDark)
+		}
+	}
+}
+
+// Produced by an independent QR encoder from the same text, level and mode.
+var qrTestURIGolden = []string{
+	"#######..#..####..###..#..#...#######",
+	"#.....#.....#..#.#..###..###..#.....#",
+	"#.###.#.#..#..###..#.#..#.##..#.###.#",
+	"#.###.#.#.#..####.......#####.#.###.#",
+	"#.###.#.###...#.#...###....##.#.###.#",
+	"#.....#.###.#.##......#.#..#..#.....#",
+	"#######.#.#.#.#.#.#.#.#.#.#.#.#######",
+	"........#.#..#.#...#.##.#..##........",
+	"#.#####..#.#...#.###..####.##.#####..",
+	".##.#.....##..##..####.#.##..#.#.#...",
+	"#####.#####..###....###....#...##..##",
+	"..####.#.##.#..##.#..#.##...##.###.#.",
+	".##...#.#.#..#.##..#....##..#.#.#.##.",
+	"##..##.#....#..##.#####...#..#.#.###.",
+	".#.######.#..#.#.....##....####.#..##",
+	".####.....##...#...#.###..##.##.....#",
+	"#####.#.###...#.####.....#...##.###..",
+	"#.#..#..#....#...#.#####..#....#.....",
+	"#.##..#.#.#..#.###..#....###...#.####",
+	"##.###.#.####.....####.##.##...##..#.",
+	"###..####.#.##.##..####.###########.#",
+	"..####.#####...##.###..#.....#.#..#..",
+	"#.#.#####..#..#####.###...##.#.#.####",
+	".###.#....#.##....#..##.#.#.........#",
+	"..#.#.#.###..#.#####.##..#.####.#.###",
+	"#.###....#.#.##....###.#.....#.#.##..",
+	"#...#.##.....#.#.....##...###.##..###",
+	"#.#..#..#.##..#...#####...####...#..#",
+	"#.#####.##..#..###..#...#.#.#####.###",
+	"........#..#.#..#.##..##..###...##.#.",
+	"#######..#..#.###.#.##..#####.#.#.#.#",
+	"#.....#.#.#...###.##.##.....#...#...#",
+	"#.###.#.#...#.#####.#.#.#########.###",
+	"#.###.#.#..###.....###.#.#.####.#.###",
+	"#.###.#.#####..##.#..##..#...#.#..###",
+	"#.....#........#...###......###.....#",
+	"#######.###....###.#.###..##..#..####",
+}
+
+func TestQRURIGolden(t *testing.T) {
+	uri := CoinSparkURI{}
+	uri.Address.BitcoinAddress = "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS"
+	uri.Address.AddressFlags = COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES
+	uri.Amount = 150000
+	uri.Message = "Invoice 1234"
+
+	code := uri.QRCode()
+	if code == nil {
+		t.Fatal("not encoded")
+	}
+	if code.Text != uri.Encode() || code.Version != 5 || code.ErrorLevel != COINSPARK_QR_ERROR_LEVEL_M || code.Alphanumeric {
+		t.Errorf("%s as version %d-%s, alphanumeric %v", code.Text, code.Version, code.ErrorLevel, code.Alphanumeric)
+	}
+
+	if code.Size != len(qrTestURIGolden) {
+		t.Fatalf("size %d, want %d", code.Size, len(qrTestURIGolden))
+	}
+	for y, goldenRow := range qrTestURIGolden {
+		row := make([]byte, code.Size)
+		for x := range row {
+			row[x] = '.'
+			if code.Module(x, y) {
+				row[x] = '#'
+			}
+		}
+		if string(row) != goldenRow {
+			t.Errorf("row %2d is %s\n          want %s", y, row, goldenRow)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+// Payment quotes. Each regular output which receives an explicit transfer is charged separately,
+// by CalcNet on the total it was sent, as in CoinSparkTransferList.Apply. A quote gives the
+// quantity to send to each output (gross) and what each will hold afterwards (net). Charged
+// quantities are destroyed, so the inputs must cover the total gross quantity.
+
+type CoinSparkQuote struct {
+	Gross         []CoinSparkAssetQty // quantity to send to each output, before charges
+	Net           []CoinSparkAssetQty // quantity each output receives, after charges
+	Charges       []CoinSparkAssetQty // charge taken from each output
+	TotalGross    CoinSparkAssetQty
+	TotalNet      CoinSparkAssetQty
+	TotalCharge   CoinSparkAssetQty
+	InputRequired CoinSparkAssetQty // input balance the transfers consume, equal to TotalGross
+}
+
+// Quotes the gross quantity to send to each output so that it receives at least the given net
+// quantity. Because charges are rounded, an output may receive slightly more than requested;
+// Net holds the exact quantities received.
+func (p *CoinSparkGenesis) QuoteNet(netAmounts []CoinSparkAssetQty) (err error, quote *CoinSparkQuote) {
+	if err := p.Validate(); err != nil {
+		return err, nil
+	}
+
+	grossAmounts := make([]CoinSparkAssetQty, len(netAmounts))
+	for outputIndex, net := range netAmounts {
+		if net < 0 || net > COINSPARK_ASSET_QTY_MAX {
+			return ErrOutOfRange{"Qty"}, nil
+		}
+		grossAmounts[outputIndex] = p.CalcGross(net)
+	}
+
+	return p.quoteGross(grossAmounts)
+}
+
+// Quotes the net quantity each output receives if sent the given gross quantity.
+func (p *CoinSparkGenesis) QuoteGross(grossAmounts []CoinSparkAssetQty) (err error, quote *CoinSparkQuote) {
+	if err := p.Validate(); err != nil {
+		return err, nil
+	}
+	return p.quoteGross(append([]CoinSparkAssetQty(nil), grossAmounts...))
+}
+
+// Quotes spending all of balance, split as evenly as possible between countOutputs outputs,
+// with earlier outputs sent one more unit where the split is uneven.
+func (p *CoinSparkGenesis) QuoteBalance(balance CoinSparkAssetQty, countOutputs int) (err error, quote *CoinSparkQuote) {
+	if err := p.Validate(); err != nil {
+		return err, nil
+	}
+	if balance < 0 || balance > COINSPARK_ASSET_QTY_MAX {
+		return ErrOutOfRange{"Qty"}, nil
+	}
+	if countOutputs <= 0 {
+		return ErrOutOfRange{"countOutputs"}, nil
+	}
+
+	grossAmounts := make([]CoinSparkAssetQty, countOutputs)
+	for outputIndex := range grossAmounts {
+		grossAmounts[outputIndex] = balance / CoinSparkAssetQty(countOutputs)
+		if CoinSparkAssetQty(outputIndex) < balance%CoinSparkAssetQty(countOutputs) {
+			grossAmounts[outputIndex]++
+		}
+	}
+
+	return p.quoteGross(grossAmounts)
+}
+
+func (p *CoinSparkGenesis) quoteGross(grossAmounts []CoinSparkAssetQty) (err error, quote *CoinSparkQuote) {
+	quote = new(CoinSparkQuote)
+	quote.Gross = grossAmounts
+	quote.Net = make([]CoinSparkAssetQty, len(grossAmounts))
+	quote.Charges = make([]CoinSparkAssetQty, len(grossAmounts))
+
+	for outputIndex, gross := range grossAmounts {
+		if gross < 0 || gross > COINSPARK_ASSET_QTY_MAX {
+			return ErrOutOfRange{"Qty"}, nil
+		}
+
+		quote.Net[outputIndex] = p.CalcNet(gross)
+		quote.Charges[outputIndex] = gross - quote.Net[outputIndex]
+
+		quote.TotalGross += gross
+		quote.TotalNet += quote.Net[outputIndex]
+		quote.TotalCharge += quote.Charges[outputIndex]
+		if quote.TotalGross > COINSPARK_ASSET_QTY_MAX {
+			return ErrOutOfRange{"Qty"}, nil
+		}
+	}
+
+	quote.InputRequired = quote.TotalGross
+	return nil, quote
+}
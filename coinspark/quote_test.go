@@ -0,0 +1,106 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+var quoteTestAssetRef = CoinSparkAssetRef{BlockNum: 123456, TxOffset: 1000, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x4a, 0x5e}}
+
+// Returns a valid genesis with the given charges, shared by the tests of quotes, plans and optimization.
+func quoteTestGenesis(t *testing.T, chargeFlat CoinSparkAssetQty, chargeBasisPoints int16) *CoinSparkGenesis {
+	builder := NewCoinSparkGenesisBuilder()
+	builder.Qty = 1000000
+	builder.ChargeFlat = chargeFlat
+	builder.ChargeBasisPoints = chargeBasisPoints
+	builder.DomainName = "example.com"
+	builder.AssetHash = make([]byte, 32)
+	err, _, report := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ChargeFlat != chargeFlat {
+		t.Fatalf("flat charge %d was rounded to %d", chargeFlat, report.ChargeFlat)
+	}
+	return report.Genesis
+}
+
+func TestQuoteNetMatchesApply(t *testing.T) {
+	genesis := quoteTestGenesis(t, 10, 250)
+	netAmounts := []CoinSparkAssetQty{100, 250, 0, 7}
+
+	err, quote := genesis.QuoteNet(netAmounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transferList := CoinSparkTransferList{}
+	for outputIndex, gross := range quote.Gross {
+		transferList.Transfers = append(transferList.Transfers, CoinSparkTransfer{quoteTestAssetRef,
+			CoinSparkIORange{0, 1}, CoinSparkIORange{CoinSparkIOIndex(outputIndex), 1}, gross})
+	}
+
+	const extra = 5 // left over in the input, so routed by default to the last output
+	outputsRegular := []bool{true, true, true, true, true}
+	outputBalances := transferList.Apply(&quoteTestAssetRef, genesis, []CoinSparkAssetQty{quote.InputRequired + extra}, outputsRegular)
+
+	for outputIndex, net := range netAmounts {
+		if outputBalances[outputIndex] != quote.Net[outputIndex] {
+			t.Errorf("output %d received %d, quote says %d", outputIndex, outputBalances[outputIndex], quote.Net[outputIndex])
+		}
+		if quote.Net[outputIndex] < net {
+			t.Errorf("output %d receives %d, less than the %d requested", outputIndex, quote.Net[outputIndex], net)
+		}
+		if quote.Gross[outputIndex]-quote.Charges[outputIndex] != quote.Net[outputIndex] {
+			t.Errorf("output %d: gross %d less charge %d is not net %d", outputIndex, quote.Gross[outputIndex], quote.Charges[outputIndex], quote.Net[outputIndex])
+		}
+	}
+	if outputBalances[len(netAmounts)] != extra {
+		t.Errorf("last output received %d, want the %d left over", outputBalances[len(netAmounts)], extra)
+	}
+	if quote.TotalGross != quote.TotalNet+quote.TotalCharge || quote.InputRequired != quote.TotalGross {
+		t.Errorf("totals do not add up: %+v", quote)
+	}
+}
+
+func TestQuoteBalance(t *testing.T) {
+	genesis := quoteTestGenesis(t, 0, 100)
+
+	err, quote := genesis.QuoteBalance(1001, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGross := []CoinSparkAssetQty{334, 334, 333}
+	for outputIndex, gross := range wantGross {
+		if quote.Gross[outputIndex] != gross {
+			t.Errorf("output %d sent %d, want %d", outputIndex, quote.Gross[outputIndex], gross)
+		}
+	}
+	if quote.TotalGross != 1001 || quote.TotalCharge != 2*genesis.CalcCharge(334)+genesis.CalcCharge(333) {
+		t.Errorf("total gross %d charge %d", quote.TotalGross, quote.TotalCharge)
+	}
+
+	if err, _ := genesis.QuoteBalance(1001, 0); err != (ErrOutOfRange{"countOutputs"}) {
+		t.Errorf("no outputs: got %v", err)
+	}
+	if err, _ := genesis.QuoteGross([]CoinSparkAssetQty{-1}); err != (ErrOutOfRange{"Qty"}) {
+		t.Errorf("negative quantity: got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+)
+
+// Output scripts for the bitcoin address inside a CoinSpark address, and the reverse.
+// As elsewhere in this library, scripts are passed as strings, either hex or raw binary.
+
+const (
+	COINSPARK_OP_0           = 0x00
+	COINSPARK_OP_1           = 0x51
+	COINSPARK_OP_16          = 0x60
+	COINSPARK_OP_DUP         = 0x76
+	COINSPARK_OP_EQUAL       = 0x87
+	COINSPARK_OP_EQUALVERIFY = 0x88
+	COINSPARK_OP_HASH160     = 0xa9
+	COINSPARK_OP_CHECKSIG    = 0xac
+)
+
+// Returns the raw output script paying to the bitcoin address, or nil if the address is not valid.
+// The bitcoin address must be valid on p.Network (mainnet if it is nil).
+func (p *CoinSparkAddress) ScriptPubKeyRaw() []byte {
+	script := bytes.Buffer{}
+
+	if isSegwitAddress(p.BitcoinAddress) {
+		success, witnessVersion, witnessProgram := p.decodeSegwitAddress()
+		if !success {
+			return nil
+		}
+
+		if witnessVersion == 0 {
+			script.WriteByte(COINSPARK_OP_0)
+		} else {
+			script.WriteByte(byte(COINSPARK_OP_1 + witnessVersion - 1))
+		}
+		script.WriteByte(byte(len(witnessProgram)))
+		script.Write(witnessProgram)
+		return script.Bytes()
+	}
+
+	success, addressType, hash160 := p.decodeBitcoinAddress()
+	if !success {
+		return nil
+	}
+
+	switch addressType {
+	case COINSPARK_ADDRESS_TYPE_P2PKH:
+		script.WriteByte(COINSPARK_OP_DUP)
+		script.WriteByte(COINSPARK_OP_HASH160)
+		script.WriteByte(COINSPARK_HASH160_LEN)
+		script.Write(hash160[:])
+		script.WriteByte(COINSPARK_OP_EQUALVERIFY)
+		script.WriteByte(COINSPARK_OP_CHECKSIG)
+
+	case COINSPARK_ADDRESS_TYPE_P2SH:
+		script.WriteByte(COINSPARK_OP_HASH160)
+		script.WriteByte(COINSPARK_HASH160_LEN)
+		script.Write(hash160[:])
+		script.WriteByte(COINSPARK_OP_EQUAL)
+
+	default:
+		return nil
+	}
+
+	return script.Bytes()
+}
+
+// Returns the output script paying to the bitcoin address, as uppercase hex if toHexScript
+// is true, otherwise as raw binary. Returns empty string if the address is not valid.
+func (p *CoinSparkAddress) ScriptPubKey(toHexScript bool) string {
+	script := p.ScriptPubKeyRaw()
+	if script == nil {
+		return ""
+	}
+	if toHexScript {
+		return strings.ToUpper(hex.EncodeToString(script))
+	}
+	return string(script)
+}
+
+// Returns the bitcoin address which a regular output script pays to, written for network
+// (mainnet if nil). Returns empty string if the script is not P2PKH, P2SH or segwit.
+func ScriptToBitcoinAddress(scriptPubKey string, scriptIsHex bool, network *CoinSparkNetwork) string {
+	if network == nil {
+		network = &mainNet
+	}
+
+	if !ScriptIsRegular(scriptPubKey, scriptIsHex) {
+		return ""
+	}
+
+	script := GetRawScript(scriptPubKey, scriptIsHex)
+	scriptLen := len(script)
+
+	var hash160 [COINSPARK_HASH160_LEN]byte
+
+	if scriptLen == 25 && script[0] == COINSPARK_OP_DUP && script[1] == COINSPARK_OP_HASH160 &&
+		script[2] == COINSPARK_HASH160_LEN && script[23] == COINSPARK_OP_EQUALVERIFY && script[24] == COINSPARK_OP_CHECKSIG {
+		copy(hash160[:], script[3:23])
+		return network.EncodeBitcoinAddress(COINSPARK_ADDRESS_TYPE_P2PKH, hash160)
+	}
+
+	if scriptLen == 23 && script[0] == COINSPARK_OP_HASH160 && script[1] == COINSPARK_HASH160_LEN && script[22] == COINSPARK_OP_EQUAL {
+		copy(hash160[:], script[2:22])
+		return network.EncodeBitcoinAddress(COINSPARK_ADDRESS_TYPE_P2SH, hash160)
+	}
+
+	if scriptLen >= 2+COINSPARK_WITNESS_PROGRAM_MIN_LEN && scriptLen <= 2+COINSPARK_WITNESS_PROGRAM_MAX_LEN &&
+		int(script[1]) == scriptLen-2 {
+		var witnessVersion int
+		switch {
+		case script[0] == COINSPARK_OP_0:
+			witnessVersion = 0
+		case script[0] >= COINSPARK_OP_1 && script[0] <= COINSPARK_OP_16:
+			witnessVersion = int(script[0]) - COINSPARK_OP_1 + 1
+		default:
+			return ""
+		}
+		return network.EncodeSegwitAddress(witnessVersion, script[2:])
+	}
+
+	return ""
+}
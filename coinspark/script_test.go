@@ -0,0 +1,97 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"strings"
+	"testing"
+)
+
+var scriptTestVectors = []struct {
+	network        *CoinSparkNetwork
+	bitcoinAddress string
+	scriptPubKey   string
+}{
+	{nil, "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS", "76a914229904dfe83e32b12d576d4b83f02565f9c1084b88ac"},
+	{nil, "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", "a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87"},
+	{nil, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+	{nil, "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+	{nil, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	{CoinSparkTestNet3(), "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", "76a914243f1394f44554f4ce3fd68649c19adc483ce92488ac"},
+	{CoinSparkTestNet3(), "2N9hLwkSqr1cPQAPxbrGVUjxyjD11G2e1he", "a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87"},
+	{CoinSparkTestNet3(), "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+	{CoinSparkTestNet3(), "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+	{CoinSparkTestNet3(), "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+}
+
+func TestScriptRoundTrip(t *testing.T) {
+	for _, test := range scriptTestVectors {
+		address := CoinSparkAddress{BitcoinAddress: test.bitcoinAddress, Network: test.network}
+		if script := address.ScriptPubKey(true); script != strings.ToUpper(test.scriptPubKey) {
+			t.Errorf("%s: script %s, want %s", test.bitcoinAddress, script, strings.ToUpper(test.scriptPubKey))
+		}
+		if bitcoinAddress := ScriptToBitcoinAddress(test.scriptPubKey, true, test.network); bitcoinAddress != test.bitcoinAddress {
+			t.Errorf("%s: hex script gave %q", test.bitcoinAddress, bitcoinAddress)
+		}
+		if bitcoinAddress := ScriptToBitcoinAddress(address.ScriptPubKey(false), false, test.network); bitcoinAddress != test.bitcoinAddress {
+			t.Errorf("%s: raw script gave %q", test.bitcoinAddress, bitcoinAddress)
+		}
+	}
+}
+
+func TestScriptWrongNetwork(t *testing.T) {
+	for _, test := range scriptTestVectors {
+		otherNetwork := CoinSparkTestNet3()
+		if test.network != nil {
+			otherNetwork = nil
+		}
+		address := CoinSparkAddress{BitcoinAddress: test.bitcoinAddress, Network: otherNetwork}
+		if script := address.ScriptPubKey(true); script != "" {
+			t.Errorf("%s on the wrong network gave script %s", test.bitcoinAddress, script)
+		}
+		if bitcoinAddress := ScriptToBitcoinAddress(test.scriptPubKey, true, otherNetwork); bitcoinAddress == test.bitcoinAddress {
+			t.Errorf("%s: script gave the same address on the other network", test.bitcoinAddress)
+		}
+	}
+}
+
+func TestScriptNonStandard(t *testing.T) {
+	for _, script := range []string{
+		"",
+		"6a0b68656c6c6f20776f726c64", // OP_RETURN
+		"2102a1633cafcc01ebfb6d78e39f687a1f0995c62fc95f51ead10a02ee0be551b5dcac", // pay to public key
+		"76a914229904dfe83e32b12d576d4b83f02565f9c1084b88ad",                     // OP_CHECKSIGVERIFY
+		"a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb88",                         // OP_EQUALVERIFY
+		"0013751e76e8199196d454941c45d1b3a323f1433b",                             // version 0 program of 19 bytes
+		"0015751e76e8199196d454941c45d1b3a323f1433bd6",                           // push length mismatch
+		"6120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433",   // OP_NOP is not a witness version
+		"zz14751e76e8199196d454941c45d1b3a323f1433bd6",                           // not hex
+	} {
+		if bitcoinAddress := ScriptToBitcoinAddress(script, true, nil); bitcoinAddress != "" {
+			t.Errorf("script %s gave address %s", script, bitcoinAddress)
+		}
+	}
+
+	address := CoinSparkAddress{BitcoinAddress: "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnT"} // bad checksum
+	if script := address.ScriptPubKey(true); script != "" {
+		t.Errorf("invalid address gave script %s", script)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"sort"
+)
+
+// The state transition of a whole transaction, for every asset held by its inputs. Per the
+// CoinSpark specification, the transfers only take effect if the bitcoin fee is at least
+// CalcMinFee, otherwise every asset goes to the last regular output as if there were no
+// transfers at all.
+//
+//	err, outputs := transferList.ApplyAssets(inputs, geneses, outputsSatoshis, outputsRegular, fee)
+//	for assetRef, qty := range outputs[0] { ... }
+
+// Asset quantities held by one transaction input or output. Assets with a zero quantity may be
+// left out.
+type CoinSparkAssetBalances map[CoinSparkAssetRef]CoinSparkAssetQty
+
+// Applies the transfers to every asset in inputs, which has an entry (possibly nil) for each
+// transaction input, and returns the assets received by each output. The genesis of each asset
+// held by the inputs must be in geneses. The list may be nil or empty if the transaction has no
+// transfer metadata. Outputs never hold zero quantities in the result.
+func (p *CoinSparkTransferList) ApplyAssets(inputs []CoinSparkAssetBalances, geneses map[CoinSparkAssetRef]*CoinSparkGenesis,
+	outputsSatoshis []CoinSparkSatoshiQty, outputsRegular []bool, feeSatoshis CoinSparkSatoshiQty) (err error, outputs []CoinSparkAssetBalances) {
+
+	err, outputs, _ = p.applyAssets(inputs, geneses, outputsSatoshis, outputsRegular, feeSatoshis)
+	return err, outputs
+}
+
+// Performs ApplyAssets, also returning what Apply did for each asset, in the order of
+// sortAssetRefs, or nil traces if the fee was too low for the transfers to take effect.
+func (p *CoinSparkTransferList) applyAssets(inputs []CoinSparkAssetBalances, geneses map[CoinSparkAssetRef]*CoinSparkGenesis,
+	outputsSatoshis []CoinSparkSatoshiQty, outputsRegular []bool, feeSatoshis CoinSparkSatoshiQty) (err error, outputs []CoinSparkAssetBalances, traces []*CoinSparkTransferTrace) {
+
+	countInputs := len(inputs)
+	countOutputs := len(outputsRegular)
+	if len(outputsSatoshis) != countOutputs {
+		return ErrOutOfRange{"OutputsSatoshis"}, nil, nil
+	}
+
+	assetRefs := []CoinSparkAssetRef{}
+	seen := map[CoinSparkAssetRef]bool{}
+	for _, input := range inputs {
+		for assetRef, qty := range input {
+			if qty < 0 || qty > COINSPARK_ASSET_QTY_MAX {
+				return ErrOutOfRange{"Inputs"}, nil, nil
+			}
+			if qty == 0 || seen[assetRef] {
+				continue
+			}
+			seen[assetRef] = true
+			assetRefs = append(assetRefs, assetRef)
+		}
+	}
+
+	sortAssetRefs(assetRefs)
+	for _, assetRef := range assetRefs {
+		if geneses[assetRef] == nil {
+			return ErrMissingGenesis{assetRef}, nil, nil
+		}
+	}
+
+	transferList := p
+	if transferList == nil {
+		transferList = new(CoinSparkTransferList)
+	}
+	validFee := feeSatoshis >= transferList.CalcMinFee(countInputs, outputsSatoshis, outputsRegular)
+
+	outputs = make([]CoinSparkAssetBalances, countOutputs)
+	for outputIndex := range outputs {
+		outputs[outputIndex] = CoinSparkAssetBalances{}
+	}
+
+	for assetIndex := range assetRefs {
+		assetRef := &assetRefs[assetIndex]
+
+		inputBalances := make([]CoinSparkAssetQty, countInputs)
+		for inputIndex, input := range inputs {
+			inputBalances[inputIndex] = input[*assetRef]
+		}
+
+		var outputBalances []CoinSparkAssetQty
+		if validFee {
+			var trace *CoinSparkTransferTrace
+			outputBalances, trace = transferList.ApplyWithTrace(assetRef, geneses[*assetRef], inputBalances, outputsRegular)
+			traces = append(traces, trace)
+		} else {
+			outputBalances = transferList.ApplyNone(inputBalances, outputsRegular)
+		}
+
+		for outputIndex, qty := range outputBalances {
+			if qty > 0 {
+				outputs[outputIndex][*assetRef] = qty
+			}
+		}
+	}
+
+	return nil, outputs, traces
+}
+
+// Sorts asset references by block, then offset, then txid prefix, so that results do not depend
+// on the order of map iteration.
+func sortAssetRefs(assetRefs []CoinSparkAssetRef) {
+	sort.Slice(assetRefs, func(i, j int) bool {
+		if assetRefs[i].BlockNum != assetRefs[j].BlockNum {
+			return assetRefs[i].BlockNum < assetRefs[j].BlockNum
+		}
+		if assetRefs[i].TxOffset != assetRefs[j].TxOffset {
+			return assetRefs[i].TxOffset < assetRefs[j].TxOffset
+		}
+		return bytes.Compare(assetRefs[i].TxIDPrefix[:], assetRefs[j].TxIDPrefix[:]) < 0
+	})
+}
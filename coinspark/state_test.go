@@ -0,0 +1,93 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+func TestApplyAssetsSortsAssets(t *testing.T) {
+	genesis := quoteTestGenesis(t, 0, 0)
+	assetRefs := []CoinSparkAssetRef{
+		{BlockNum: 100, TxOffset: 500, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x01, 0x02}},
+		{BlockNum: 100, TxOffset: 500, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x01, 0x03}},
+		{BlockNum: 100, TxOffset: 600, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x00, 0x00}},
+		{BlockNum: 200, TxOffset: 100, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x00, 0x00}},
+	}
+	geneses := map[CoinSparkAssetRef]*CoinSparkGenesis{}
+	inputs := []CoinSparkAssetBalances{{}, {}}
+	for index, assetRef := range assetRefs {
+		geneses[assetRef] = genesis
+		inputs[index%2][assetRef] = CoinSparkAssetQty(10 * (index + 1))
+	}
+
+	for attempt := 0; attempt < 20; attempt++ { // map iteration order varies between runs
+		var transferList *CoinSparkTransferList
+		err, _, traces := transferList.applyAssets(inputs, geneses, []CoinSparkSatoshiQty{1000}, []bool{true}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(traces) != len(assetRefs) {
+			t.Fatalf("got %d traces, want %d", len(traces), len(assetRefs))
+		}
+		for index, trace := range traces {
+			if trace.AssetRef != assetRefs[index] {
+				t.Fatalf("trace %d is for %s, want %s", index, trace.AssetRef.Encode(), assetRefs[index].Encode())
+			}
+		}
+	}
+
+	delete(geneses, assetRefs[1])
+	delete(geneses, assetRefs[3])
+	var transferList *CoinSparkTransferList
+	if err, _ := transferList.ApplyAssets(inputs, geneses, []CoinSparkSatoshiQty{1000}, []bool{true}, 0); err != (ErrMissingGenesis{assetRefs[1]}) {
+		t.Errorf("got %v, want the first missing genesis", err)
+	}
+}
+
+func TestApplyAssetsMinFee(t *testing.T) {
+	genesis := quoteTestGenesis(t, 0, 0)
+	geneses := map[CoinSparkAssetRef]*CoinSparkGenesis{quoteTestAssetRef: genesis}
+	inputs := []CoinSparkAssetBalances{{quoteTestAssetRef: 100}}
+	outputsSatoshis := []CoinSparkSatoshiQty{1000, 1000}
+	outputsRegular := []bool{true, true}
+	transferList := CoinSparkTransferList{[]CoinSparkTransfer{{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{0, 1}, 30}}}
+	minFee := transferList.CalcMinFee(1, outputsSatoshis, outputsRegular)
+
+	for _, test := range []struct {
+		fee  CoinSparkSatoshiQty
+		want [2]CoinSparkAssetQty
+	}{
+		{minFee, [2]CoinSparkAssetQty{30, 70}},
+		{minFee - 1, [2]CoinSparkAssetQty{0, 100}},
+	} {
+		err, outputs := transferList.ApplyAssets(inputs, geneses, outputsSatoshis, outputsRegular, test.fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for outputIndex, want := range test.want {
+			if outputs[outputIndex][quoteTestAssetRef] != want {
+				t.Errorf("fee %d: output %d holds %d, want %d", test.fee, outputIndex, outputs[outputIndex][quoteTestAssetRef], want)
+			}
+		}
+		if _, found := outputs[0][quoteTestAssetRef]; found && test.want[0] == 0 {
+			t.Errorf("fee %d: output 0 holds a zero quantity", test.fee)
+		}
+	}
+}
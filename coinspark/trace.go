@@ -0,0 +1,150 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+)
+
+// A record of what Apply did, to explain where each unit of an asset went. Explicit transfers
+// move quantities from inputs to outputs, each regular output then pays the asset's charges on
+// what it was sent, and whatever is left in each input goes to its default route.
+//
+//	outputBalances, trace := transferList.ApplyWithTrace(assetRef, genesis, inputBalances, outputsRegular)
+//	fmt.Print(trace.Table())
+
+type CoinSparkTransferStepKind int
+
+const (
+	COINSPARK_STEP_TRANSFER      CoinSparkTransferStepKind = iota // explicit transfer from an input to an output
+	COINSPARK_STEP_CHARGE                                         // payment charge deducted from an output
+	COINSPARK_STEP_DEFAULT_ROUTE                                  // leftover sent by a default route transfer
+	COINSPARK_STEP_LAST_REGULAR                                   // leftover sent to the last regular output
+	COINSPARK_STEP_LOST                                           // leftover with no regular output to go to
+)
+
+func (k CoinSparkTransferStepKind) String() string {
+	switch k {
+	case COINSPARK_STEP_TRANSFER:
+		return "transfer"
+	case COINSPARK_STEP_CHARGE:
+		return "charge"
+	case COINSPARK_STEP_DEFAULT_ROUTE:
+		return "default route"
+	case COINSPARK_STEP_LAST_REGULAR:
+		return "last regular output"
+	case COINSPARK_STEP_LOST:
+		return "lost"
+	}
+	return fmt.Sprintf("step%d", int(k))
+}
+
+func (k CoinSparkTransferStepKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// One movement made by Apply. Indexes are -1 where they do not apply.
+type CoinSparkTransferStep struct {
+	Kind          CoinSparkTransferStepKind `json:"rule"`
+	TransferIndex int                       `json:"transfer"` // in the list, for explicit and default route transfers
+	InputIndex    int                       `json:"input"`
+	OutputIndex   int                       `json:"output"`
+	Qty           CoinSparkAssetQty         `json:"qty"`    // moved, or left in the output after a charge
+	Charge        CoinSparkAssetQty         `json:"charge"` // deducted, for COINSPARK_STEP_CHARGE
+}
+
+type CoinSparkTransferTrace struct {
+	AssetRef       CoinSparkAssetRef       `json:"assetRef"`
+	Steps          []CoinSparkTransferStep `json:"steps"`
+	OutputBalances []CoinSparkAssetQty     `json:"outputBalances"`
+}
+
+// As Apply, but also returns each movement it made.
+func (p *CoinSparkTransferList) ApplyWithTrace(assetRef *CoinSparkAssetRef, genesis *CoinSparkGenesis, inputBalances []CoinSparkAssetQty, outputsRegular []bool) (outputBalances []CoinSparkAssetQty, trace *CoinSparkTransferTrace) {
+	trace = new(CoinSparkTransferTrace)
+	trace.AssetRef = *assetRef
+	trace.Steps = []CoinSparkTransferStep{}
+
+	outputBalances = p.apply(assetRef, genesis, inputBalances, outputsRegular, trace)
+	return outputBalances, trace
+}
+
+// Renders the trace as a table, one row per step, followed by the resulting output balances.
+func (p *CoinSparkTransferTrace) Table() string {
+	buffer := bytes.Buffer{}
+	buffer.WriteString(fmt.Sprintf("Asset reference: %s\n", p.AssetRef.Encode()))
+
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(writer, "Step\tRule\tTransfer\tInput\tOutput\tQty\tCharge\t\n")
+	for stepIndex, step := range p.Steps {
+		charge := "-"
+		if step.Kind == COINSPARK_STEP_CHARGE {
+			charge = fmt.Sprintf("%d", step.Charge)
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t\n", stepIndex, step.Kind, traceIndex(step.TransferIndex),
+			traceIndex(step.InputIndex), traceIndex(step.OutputIndex), step.Qty, charge)
+	}
+	writer.Flush()
+
+	for outputIndex, qty := range p.OutputBalances {
+		buffer.WriteString(fmt.Sprintf("Output %d: %d\n", outputIndex, qty))
+	}
+
+	return buffer.String()
+}
+
+// Renders the trace as indented JSON. Fails if AssetRef is not valid, since it is written in
+// text form.
+func (p *CoinSparkTransferTrace) JSON() (err error, encoded string) {
+	encodedBytes, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err, ""
+	}
+	return nil, string(encodedBytes)
+}
+
+func (p *CoinSparkTransferTrace) String() string {
+	return p.Table()
+}
+
+// Both of these do nothing for a nil trace, so that Apply can run without one.
+
+func (p *CoinSparkTransferTrace) add(step CoinSparkTransferStep) {
+	if p != nil {
+		p.Steps = append(p.Steps, step)
+	}
+}
+
+func (p *CoinSparkTransferTrace) setOutputBalances(outputBalances []CoinSparkAssetQty) {
+	if p != nil {
+		p.OutputBalances = append([]CoinSparkAssetQty(nil), outputBalances...)
+	}
+}
+
+func traceIndex(index int) string {
+	if index < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", index)
+}
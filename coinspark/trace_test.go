@@ -0,0 +1,93 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyWithTraceSteps(t *testing.T) {
+	genesis := quoteTestGenesis(t, 5, 0)
+	defaultRoute := CoinSparkAssetRef{BlockNum: COINSPARK_TRANSFER_BLOCK_NUM_DEFAULT_ROUTE}
+	transferList := CoinSparkTransferList{[]CoinSparkTransfer{
+		{quoteTestAssetRef, CoinSparkIORange{0, 1}, CoinSparkIORange{0, 1}, 30},
+		{defaultRoute, CoinSparkIORange{1, 1}, CoinSparkIORange{1, 1}, 0},
+	}}
+	inputBalances := []CoinSparkAssetQty{100, 20, 7}
+	outputsRegular := []bool{true, true, true}
+
+	outputBalances, trace := transferList.ApplyWithTrace(&quoteTestAssetRef, genesis, inputBalances, outputsRegular)
+	if applied := transferList.Apply(&quoteTestAssetRef, genesis, inputBalances, outputsRegular); !reflect.DeepEqual(outputBalances, applied) {
+		t.Errorf("ApplyWithTrace gave %v, Apply gave %v", outputBalances, applied)
+	}
+
+	wantSteps := []CoinSparkTransferStep{
+		{COINSPARK_STEP_TRANSFER, 0, 0, 0, 30, 0},
+		{COINSPARK_STEP_CHARGE, -1, -1, 0, 25, 5},
+		{COINSPARK_STEP_LAST_REGULAR, -1, 0, 2, 70, 0},
+		{COINSPARK_STEP_DEFAULT_ROUTE, 1, 1, 1, 20, 0},
+		{COINSPARK_STEP_LAST_REGULAR, -1, 2, 2, 7, 0},
+	}
+	if !reflect.DeepEqual(trace.Steps, wantSteps) {
+		t.Errorf("got steps %+v, want %+v", trace.Steps, wantSteps)
+	}
+	if !reflect.DeepEqual(trace.OutputBalances, []CoinSparkAssetQty{25, 20, 77}) {
+		t.Errorf("trace output balances %v", trace.OutputBalances)
+	}
+	if table := trace.Table(); !strings.Contains(table, "last regular output") || !strings.Contains(table, "Output 2: 77") {
+		t.Errorf("table is missing steps or balances:\n%s", table)
+	}
+
+	_, lostTrace := transferList.ApplyWithTrace(&quoteTestAssetRef, genesis, []CoinSparkAssetQty{9}, []bool{false})
+	if len(lostTrace.Steps) != 1 || lostTrace.Steps[0].Kind != COINSPARK_STEP_LOST {
+		t.Errorf("no regular outputs: got steps %+v", lostTrace.Steps)
+	}
+}
+
+func TestTraceJSON(t *testing.T) {
+	transferList := CoinSparkTransferList{}
+	_, trace := transferList.ApplyWithTrace(&quoteTestAssetRef, quoteTestGenesis(t, 0, 0), []CoinSparkAssetQty{10}, []bool{true})
+
+	err, encoded := trace.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		AssetRef string `json:"assetRef"`
+		Steps    []struct {
+			Rule string `json:"rule"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(encoded), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.AssetRef != string(quoteTestAssetRef.Encode()) || len(decoded.Steps) != 1 || decoded.Steps[0].Rule != "last regular output" {
+		t.Errorf("unexpected JSON:\n%s", encoded)
+	}
+
+	trace.AssetRef.BlockNum = -2
+	if err, encoded := trace.JSON(); err == nil || encoded != "" {
+		t.Errorf("invalid asset reference: got %q, %v", encoded, err)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CoinSpark payment URIs follow BIP21, for example:
+//
+//	coinspark:s6GUHy...?asset=456789-65432-1234&qty=100&amount=0.001&message=Thanks
+//
+// asset is an asset reference, qty the number of units of that asset, amount a number
+// of bitcoins and message a text message for the recipient.
+
+const (
+	COINSPARK_URI_SCHEME            = "coinspark"
+	COINSPARK_URI_PARAM_ASSET       = "asset"
+	COINSPARK_URI_PARAM_QTY         = "qty"
+	COINSPARK_URI_PARAM_AMOUNT      = "amount"
+	COINSPARK_URI_PARAM_MESSAGE     = "message"
+	COINSPARK_URI_REQUIRED_PREFIX   = "req-" // BIP21 parameters which must be understood
+	COINSPARK_SATOSHIS_PER_BITCOIN  = 100000000
+	COINSPARK_BITCOIN_AMOUNT_DIGITS = 8
+)
+
+type CoinSparkURI struct {
+	Address  CoinSparkAddress
+	AssetRef *CoinSparkAssetRef  // nil if no asset is requested
+	AssetQty CoinSparkAssetQty   // units of AssetRef requested, 0 if not specified
+	Amount   CoinSparkSatoshiQty // bitcoin amount in satoshis, 0 if not specified
+	Message  string              // text message, empty if none
+}
+
+// Set all fields in the URI to their default/zero values, which are not necessarily valid.
+// The Network setting of the address is kept.
+func (p *CoinSparkURI) Clear() {
+	p.Address.Clear()
+	p.AssetRef = nil
+	p.AssetQty = 0
+	p.Amount = 0
+	p.Message = ""
+}
+
+// Returns true if all values in the URI are in their permitted ranges, and the address
+// flags allow the asset and message requested, false otherwise.
+func (p *CoinSparkURI) IsValid() bool {
+	return p.Validate() == nil
+}
+
+// As IsValid, but returns the reason the URI is not valid, or nil if it is.
+func (p *CoinSparkURI) Validate() error {
+	if err := p.Address.Validate(); err != nil {
+		return err
+	}
+
+	if p.AssetRef != nil {
+		if p.AssetRef.BlockNum == COINSPARK_TRANSFER_BLOCK_NUM_DEFAULT_ROUTE {
+			return ErrOutOfRange{"AssetRef"}
+		}
+		if err := p.AssetRef.Validate(); err != nil {
+			return err
+		}
+		if p.Address.AddressFlags&COINSPARK_ADDRESS_FLAG_ASSETS == 0 {
+			return ErrNotPermitted
+		}
+	}
+
+	if p.AssetQty < 0 || p.AssetQty > COINSPARK_ASSET_QTY_MAX {
+		return ErrOutOfRange{"AssetQty"}
+	}
+	if p.AssetQty > 0 && p.AssetRef == nil {
+		return ErrOutOfRange{"AssetQty"} // a quantity without an asset is meaningless
+	}
+
+	if p.Amount < 0 || p.Amount > COINSPARK_SATOSHI_QTY_MAX {
+		return ErrOutOfRange{"Amount"}
+	}
+
+	if p.Message != "" && p.Address.AddressFlags&COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES == 0 {
+		return ErrNotPermitted
+	}
+
+	return nil
+}
+
+// Returns true if the two CoinSparkURI structures are identical.
+func (p *CoinSparkURI) Match(other *CoinSparkURI) bool {
+	if (p.AssetRef == nil) != (other.AssetRef == nil) {
+		return false
+	}
+	if p.AssetRef != nil && !p.AssetRef.Match(other.AssetRef) {
+		return false
+	}
+	return p.Address.Match(&other.Address) && p.AssetQty == other.AssetQty && p.Amount == other.Amount && p.Message == other.Message
+}
+
+// Encodes the URI to a string. Returns empty string if the URI is not valid.
+func (p *CoinSparkURI) Encode() string {
+	if !p.IsValid() {
+		return ""
+	}
+
+	addressString := p.Address.Encode()
+	if addressString == "" {
+		return ""
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString(COINSPARK_URI_SCHEME)
+	buffer.WriteByte(':')
+	buffer.WriteString(addressString)
+
+	separator := byte('?')
+	writeParam := func(name string, value string) {
+		buffer.WriteByte(separator)
+		buffer.WriteString(name)
+		buffer.WriteByte('=')
+		buffer.WriteString(uriEscape(value))
+		separator = '&'
+	}
+
+	if p.AssetRef != nil {
+		writeParam(COINSPARK_URI_PARAM_ASSET, string(p.AssetRef.Encode()))
+	}
+	if p.AssetQty > 0 {
+		writeParam(COINSPARK_URI_PARAM_QTY, strconv.FormatInt(int64(p.AssetQty), 10))
+	}
+	if p.Amount > 0 {
+		writeParam(COINSPARK_URI_PARAM_AMOUNT, FormatBitcoinAmount(p.Amount))
+	}
+	if p.Message != "" {
+		writeParam(COINSPARK_URI_PARAM_MESSAGE, p.Message)
+	}
+
+	return buffer.String()
+}
+
+// Decodes a CoinSpark payment URI into the fields of p. Unknown parameters are ignored
+// unless they start with "req-", in which case the URI is rejected as BIP21 requires.
+// Returns true if the URI could be successfully read and is valid, otherwise false.
+func (p *CoinSparkURI) Decode(uri string) bool {
+	return p.DecodeErr(uri) == nil
+}
+
+// As Decode, but returns the reason the URI could not be read, or nil on success.
+func (p *CoinSparkURI) DecodeErr(uri string) error {
+	p.Clear()
+
+	schemeLen := len(COINSPARK_URI_SCHEME) + 1
+	if len(uri) <= schemeLen || !strings.EqualFold(uri[:schemeLen], COINSPARK_URI_SCHEME+":") {
+		return ErrBadPrefix
+	}
+	uri = uri[schemeLen:]
+
+	addressString := uri
+	query := ""
+	if queryPos := strings.IndexByte(uri, '?'); queryPos >= 0 {
+		addressString = uri[:queryPos]
+		query = uri[queryPos+1:]
+	}
+
+	if err := p.Address.DecodeErr(addressString); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, param := range strings.Split(query, "&") {
+		if param == "" {
+			continue
+		}
+
+		name := param
+		value := ""
+		if equalsPos := strings.IndexByte(param, '='); equalsPos >= 0 {
+			name = param[:equalsPos]
+			value = param[equalsPos+1:]
+		}
+
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			return ErrBadFormat
+		}
+
+		if seen[name] {
+			return ErrDuplicateParam // each parameter may only appear once
+		}
+		seen[name] = true
+
+		switch name {
+		case COINSPARK_URI_PARAM_ASSET:
+			assetRef := new(CoinSparkAssetRef)
+			if err := assetRef.DecodeErr(value); err != nil {
+				return err
+			}
+			p.AssetRef = assetRef
+
+		case COINSPARK_URI_PARAM_QTY:
+			qty, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || qty <= 0 {
+				return ErrOutOfRange{"AssetQty"}
+			}
+			p.AssetQty = CoinSparkAssetQty(qty)
+
+		case COINSPARK_URI_PARAM_AMOUNT:
+			success, amount := ParseBitcoinAmount(value)
+			if !success {
+				return ErrOutOfRange{"Amount"}
+			}
+			p.Amount = amount
+
+		case COINSPARK_URI_PARAM_MESSAGE:
+			p.Message = value
+
+		default:
+			if strings.HasPrefix(name, COINSPARK_URI_REQUIRED_PREFIX) {
+				return ErrRequiredParam
+			}
+		}
+	}
+
+	return p.Validate()
+}
+
+// Outputs the URI to a string for debugging.
+func (p *CoinSparkURI) String() string {
+	buffer := bytes.Buffer{}
+	buffer.WriteString("COINSPARK URI\n")
+	buffer.WriteString(p.Address.String())
+
+	if p.AssetRef != nil {
+		buffer.WriteString(p.AssetRef.String())
+	} else {
+		buffer.WriteString("Asset reference: none\n")
+	}
+
+	buffer.WriteString(fmt.Sprintf("   Asset quantity: %d\n", p.AssetQty))
+	buffer.WriteString(fmt.Sprintf("   Bitcoin amount: %s (%d satoshis)\n", FormatBitcoinAmount(p.Amount), p.Amount))
+	buffer.WriteString(fmt.Sprintf("          Message: %s\n", p.Message))
+	buffer.WriteString("END COINSPARK URI\n\n")
+
+	return buffer.String()
+}
+
+// Convenience constructor
+func NewCoinSparkURI(address CoinSparkAddress, assetRef *CoinSparkAssetRef, assetQty CoinSparkAssetQty, amount CoinSparkSatoshiQty, message string) *CoinSparkURI {
+	p := new(CoinSparkURI)
+	p.Address = address
+	p.AssetRef = assetRef
+	p.AssetQty = assetQty
+	p.Amount = amount
+	p.Message = message
+	return p
+}
+
+// Formats a number of satoshis as a decimal number of bitcoins, without trailing zeros.
+func FormatBitcoinAmount(satoshis CoinSparkSatoshiQty) string {
+	sign := ""
+	if satoshis < 0 {
+		sign = "-"
+		satoshis = -satoshis
+	}
+
+	whole := satoshis / COINSPARK_SATOSHIS_PER_BITCOIN
+	fraction := satoshis % COINSPARK_SATOSHIS_PER_BITCOIN
+	if fraction == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+
+	fractionString := strings.TrimRight(fmt.Sprintf("%08d", fraction), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, fractionString)
+}
+
+// Parses a decimal number of bitcoins into satoshis, with at most 8 decimal places.
+// Returns false if the amount is not a valid non-negative number.
+func ParseBitcoinAmount(amount string) (bool, CoinSparkSatoshiQty) {
+	whole := amount
+	fraction := ""
+	if pointPos := strings.IndexByte(amount, '.'); pointPos >= 0 {
+		whole = amount[:pointPos]
+		fraction = amount[pointPos+1:]
+	}
+
+	if (whole == "" && fraction == "") || len(fraction) > COINSPARK_BITCOIN_AMOUNT_DIGITS {
+		return false, 0
+	}
+	for _, digits := range []string{whole, fraction} {
+		for i := 0; i < len(digits); i++ {
+			if digits[i] < '0' || digits[i] > '9' {
+				return false, 0
+			}
+		}
+	}
+
+	var satoshis CoinSparkSatoshiQty
+	if whole != "" {
+		wholeValue, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || wholeValue > COINSPARK_SATOSHI_QTY_MAX/COINSPARK_SATOSHIS_PER_BITCOIN {
+			return false, 0
+		}
+		satoshis = CoinSparkSatoshiQty(wholeValue) * COINSPARK_SATOSHIS_PER_BITCOIN
+	}
+	if fraction != "" {
+		fractionValue, _ := strconv.ParseInt(fraction+strings.Repeat("0", COINSPARK_BITCOIN_AMOUNT_DIGITS-len(fraction)), 10, 64)
+		satoshis += CoinSparkSatoshiQty(fractionValue)
+	}
+
+	if satoshis > COINSPARK_SATOSHI_QTY_MAX {
+		return false, 0
+	}
+	return true, satoshis
+}
+
+// Percent-encodes everything except unreserved characters, so spaces become %20 rather than +.
+func uriEscape(value string) string {
+	buffer := bytes.Buffer{}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' {
+			buffer.WriteByte(c)
+		} else {
+			buffer.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return buffer.String()
+}
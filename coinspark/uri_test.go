@@ -0,0 +1,145 @@
+// Copyright 2015 Simon Liu.  All rights reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package coinspark
+
+import "testing"
+
+var uriTestAssetRef = CoinSparkAssetRef{BlockNum: 123456, TxOffset: 1000, TxIDPrefix: [COINSPARK_ASSETREF_TXID_PREFIX_LEN]byte{0x4a, 0x5e}}
+
+func uriTestAddress(addressFlags CoinSparkAddressFlags) CoinSparkAddress {
+	return CoinSparkAddress{BitcoinAddress: "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS", AddressFlags: addressFlags}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	address := uriTestAddress(COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES)
+	assetRef := uriTestAssetRef
+
+	for _, test := range []struct {
+		uri         *CoinSparkURI
+		wantEncoded string // after the address, empty to skip the check
+	}{
+		{NewCoinSparkURI(address, nil, 0, 0, ""), ""},
+		{NewCoinSparkURI(address, &assetRef, 100, 0, ""), "?asset=" + string(assetRef.Encode()) + "&qty=100"},
+		{NewCoinSparkURI(address, &assetRef, 0, 0, ""), "?asset=" + string(assetRef.Encode())},
+		{NewCoinSparkURI(address, nil, 0, 150000, ""), "?amount=0.0015"},
+		{NewCoinSparkURI(address, nil, 0, 2*COINSPARK_SATOSHIS_PER_BITCOIN, ""), "?amount=2"},
+		{NewCoinSparkURI(address, nil, 0, 0, "Invoice #12 & 50% off/café"), "?message=Invoice%20%2312%20%26%2050%25%20off%2Fcaf%C3%A9"},
+		{NewCoinSparkURI(address, &assetRef, 7, 1, "a=b?c"), "?asset=" + string(assetRef.Encode()) + "&qty=7&amount=0.00000001&message=a%3Db%3Fc"},
+	} {
+		encoded := test.uri.Encode()
+		if encoded != COINSPARK_URI_SCHEME+":"+address.Encode()+test.wantEncoded {
+			t.Errorf("%+v encoded as %s, want query %q", test.uri, encoded, test.wantEncoded)
+		}
+
+		var decoded CoinSparkURI
+		if err := decoded.DecodeErr(encoded); err != nil {
+			t.Errorf("%s: %v", encoded, err)
+		} else if !decoded.Match(test.uri) {
+			t.Errorf("%s decoded to %s", encoded, decoded.String())
+		}
+	}
+
+	// Scheme in any case, '+' kept as it is, and unknown optional parameters ignored
+	var decoded CoinSparkURI
+	uri := "CoinSpark:" + address.Encode() + "?label=shop&message=1+1"
+	if err := decoded.DecodeErr(uri); err != nil || decoded.Message != "1+1" {
+		t.Errorf("%s: message %q, error %v", uri, decoded.Message, err)
+	}
+}
+
+func TestURIRejected(t *testing.T) {
+	address := uriTestAddress(COINSPARK_ADDRESS_FLAG_ASSETS | COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES)
+	prefix := COINSPARK_URI_SCHEME + ":" + address.Encode()
+	assetRef := string(uriTestAssetRef.Encode())
+
+	for _, test := range []struct {
+		uri     string
+		wantErr error
+	}{
+		{"bitcoin:149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS", ErrBadPrefix},
+		{prefix + "?req-expires=1700000000", ErrRequiredParam},
+		{prefix + "?amount=1&amount=2", ErrDuplicateParam},
+		{prefix + "?message=a&message=a", ErrDuplicateParam},
+		{prefix + "?amount=0.123456789", ErrOutOfRange{"Amount"}},
+		{prefix + "?amount=-1", ErrOutOfRange{"Amount"}},
+		{prefix + "?amount=1e3", ErrOutOfRange{"Amount"}},
+		{prefix + "?amount=.", ErrOutOfRange{"Amount"}},
+		{prefix + "?amount=", ErrOutOfRange{"Amount"}},
+		{prefix + "?amount=99999999", ErrOutOfRange{"Amount"}},
+		{prefix + "?qty=5", ErrOutOfRange{"AssetQty"}},
+		{prefix + "?asset=" + assetRef + "&qty=0", ErrOutOfRange{"AssetQty"}},
+		{prefix + "?message=%zz", ErrBadFormat},
+	} {
+		var decoded CoinSparkURI
+		if err := decoded.DecodeErr(test.uri); err != test.wantErr {
+			t.Errorf("%s: got %v, want %v", test.uri, err, test.wantErr)
+		}
+	}
+}
+
+func TestURIAddressFlags(t *testing.T) {
+	assetRef := uriTestAssetRef
+
+	for _, test := range []struct {
+		name  string
+		uri   *CoinSparkURI
+		query string
+	}{
+		{"message without TEXT_MESSAGES", NewCoinSparkURI(uriTestAddress(COINSPARK_ADDRESS_FLAG_ASSETS), nil, 0, 0, "hello"), "?message=hello"},
+		{"asset without ASSETS", NewCoinSparkURI(uriTestAddress(COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES), &assetRef, 10, 0, ""), "?asset=" + string(assetRef.Encode()) + "&qty=10"},
+	} {
+		if err := test.uri.Validate(); err != ErrNotPermitted {
+			t.Errorf("%s: Validate got %v, want %v", test.name, err, ErrNotPermitted)
+		}
+		if encoded := test.uri.Encode(); encoded != "" {
+			t.Errorf("%s: encoded as %s", test.name, encoded)
+		}
+
+		var decoded CoinSparkURI
+		uri := COINSPARK_URI_SCHEME + ":" + test.uri.Address.Encode() + test.query
+		if err := decoded.DecodeErr(uri); err != ErrNotPermitted {
+			t.Errorf("%s: DecodeErr got %v, want %v", test.name, err, ErrNotPermitted)
+		}
+	}
+}
+
+func TestBitcoinAmount(t *testing.T) {
+	for _, test := range []struct {
+		satoshis CoinSparkSatoshiQty
+		amount   string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{150000, "0.0015"},
+		{10000000, "0.1"},
+		{COINSPARK_SATOSHIS_PER_BITCOIN, "1"},
+		{COINSPARK_SATOSHI_QTY_MAX, FormatBitcoinAmount(COINSPARK_SATOSHI_QTY_MAX)},
+	} {
+		amount := FormatBitcoinAmount(test.satoshis)
+		success, satoshis := ParseBitcoinAmount(amount)
+		if amount != test.amount || !success || satoshis != test.satoshis {
+			t.Errorf("%d satoshis formatted as %s and parsed as %v %d", test.satoshis, amount, success, satoshis)
+		}
+	}
+	if success, satoshis := ParseBitcoinAmount("0.10"); !success || satoshis != 10000000 {
+		t.Errorf("trailing zero: %v %d", success, satoshis)
+	}
+}
@@ -61,16 +61,42 @@ func DecodeCoinSparkAddress() {
 
 	address := coinspark.CoinSparkAddress{}
 
-	if address.Decode("s6GUHy69HWkwFqzFhJCY49seL8EFv") {
+	if address.Decode("st75zSd3aVPWcDGzxAzA7xhERLBYsqVR2fo4i") {
 		fmt.Println("Bitcoin address: ", address.BitcoinAddress)
 		fmt.Println("Address flags: ", address.AddressFlags)
 		fmt.Println("Payment reference: ", address.PaymentRef.Ref)
+		fmt.Println("Hash160: ", hex.EncodeToString(address.Hash160[:]))
 		fmt.Printf(address.String())
 	} else {
 		fmt.Println("CoinSpark address decode failed!")
 	}
 }
 
+func CreatePaymentURIQRCode() {
+	fmt.Println("\nCreating a payment URI and its QR code...\n")
+
+	uri := coinspark.CoinSparkURI{}
+	uri.Address.BitcoinAddress = "149wHUMa41Xm2jnZtqgRx94uGbZD9kPXnS"
+	uri.Address.AddressFlags = coinspark.COINSPARK_ADDRESS_FLAG_ASSETS | coinspark.COINSPARK_ADDRESS_FLAG_TEXT_MESSAGES
+	uri.Amount = 150000 // satoshis
+	uri.Message = "Invoice 1234"
+
+	uriString := uri.Encode()
+	if uriString == "" {
+		fmt.Println("Payment URI encode failed!")
+		return
+	}
+	fmt.Println("Payment URI: ", uriString)
+
+	qrCode := uri.QRCode()
+	if qrCode == nil {
+		fmt.Println("QR code encode failed!")
+		return
+	}
+	fmt.Printf("QR code version %d, error level %s, PNG size %d bytes\n", qrCode.Version, qrCode.ErrorLevel, len(qrCode.PNG(0)))
+	fmt.Print(qrCode.Terminal())
+}
+
 func ProcessTransactionRawBinary(scriptPubKeys [][]byte, countInputs int) {
 	fmt.Println("\nExtracting CoinSpark metadata from a transaction...\n")
 
@@ -442,6 +468,7 @@ func CalculateMessageHash() []byte {
 func main() {
 	CreateCoinSparkAddress()
 	DecodeCoinSparkAddress()
+	CreatePaymentURIQRCode()
 
 	ProcessTransaction([]string{"6A2853504B6750A4AE00F454956DF4C7D6DE7BF8192486006A4ADF65B048BF847FE26D70588E9FA828D5"}, 15856)
 	ProcessTransaction([]string{"abc", "6A2053504B743F282321E438188C4B381807227C10812B47920642B32E12417D8279", "def"}, 59364)